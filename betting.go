@@ -0,0 +1,334 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	betsFile = "bets.json"
+
+	betPollInterval  = 30 * time.Second
+	betWindow        = 3 * time.Minute // bets are taken for this long once a game is spotted
+	betResultTimeout = time.Hour       // refund if match-v5 never has the result
+)
+
+// Betting on the streamer's games, started in main
+var bets *BetTracker
+
+// ---------- Types ----------
+
+// Lets viewers bet points on the current League game. The spectator API is
+// polled for the streamer's accounts: a new game opens betting in every live
+// channel for betWindow, and once the game is gone the match-v5 result
+// settles it. Rounds are saved to bets.json so a restart mid-game picks up
+// where it left off, staked points included.
+type BetTracker struct {
+	d    *Dispatcher
+	path string
+
+	mu     sync.Mutex
+	rounds []*betRound
+}
+
+type betRound struct {
+	Channel  string         `json:"channel"`
+	MatchID  string         `json:"matchId"`
+	PUUID    string         `json:"puuid,omitempty"`   // account playing it, the main one if unset
+	OpenedAt int64          `json:"openedAt"`          // unix seconds
+	EndedAt  int64          `json:"endedAt,omitempty"` // when the game left the spectator API
+	Bets     map[string]bet `json:"bets"`              // by ChatUser.Key
+}
+
+type bet struct {
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName,omitempty"`
+	UserID      string `json:"userId,omitempty"`
+	Win         bool   `json:"win"`
+	Amount      int    `json:"amount"`
+}
+
+func (b bet) user() ChatUser {
+	return ChatUser{Login: b.Login, DisplayName: b.DisplayName, UserID: b.UserID}
+}
+
+func NewBetTracker(d *Dispatcher, path string) *BetTracker {
+	t := &BetTracker{d: d, path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return t
+	}
+	if err := json.Unmarshal(data, &t.rounds); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	if len(t.rounds) > 0 {
+		log.Printf("Recovered %d betting rounds from %s", len(t.rounds), path)
+	}
+	return t
+}
+
+// Caller holds t.mu
+func (t *BetTracker) saveLocked() {
+	data, err := json.MarshalIndent(t.rounds, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(t.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", t.path, err)
+	}
+}
+
+// The channel's round for the game still being played. Caller holds t.mu.
+func (t *BetTracker) currentLocked(channel string) *betRound {
+	for _, r := range t.rounds {
+		if r.Channel == channel && r.EndedAt == 0 {
+			return r
+		}
+	}
+	return nil
+}
+
+// ---------- Running ----------
+
+// Disabled with BETTING=0
+func (t *BetTracker) Run(ctx context.Context) {
+	if os.Getenv("BETTING") == "0" {
+		return
+	}
+	ticker := time.NewTicker(betPollInterval)
+	defer ticker.Stop()
+	for {
+		t.tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *BetTracker) tick() {
+	var live []string
+	for _, channel := range t.d.bot.Channels {
+		if start, err := CachedStreamStart(channel); err == nil && start != 0 {
+			live = append(live, channel)
+		}
+	}
+	t.mu.Lock()
+	idle := len(live) == 0 && len(t.rounds) == 0
+	t.mu.Unlock()
+	if idle {
+		return
+	}
+
+	game, account, err := t.d.riot.GetActiveGameOf(t.d.Accounts(), riotBackgroundWait)
+	if err != nil {
+		log.Printf("Betting: checking for an active game: %v", err)
+		return
+	}
+	now := time.Now()
+	matchID := ""
+	if game != nil {
+		matchID = game.MatchID()
+	}
+
+	t.mu.Lock()
+	var ended []*betRound
+	for _, r := range t.rounds {
+		if r.MatchID != matchID {
+			if r.EndedAt == 0 {
+				r.EndedAt = now.Unix()
+			}
+			ended = append(ended, r)
+		}
+	}
+	var opened []string
+	// a game that was already well underway when first seen isn't opened
+	if game != nil && (game.GameStartTime == 0 || now.Sub(time.UnixMilli(game.GameStartTime)) < betWindow) {
+		for _, channel := range live {
+			if r := t.currentLocked(channel); r == nil {
+				t.rounds = append(t.rounds, &betRound{Channel: channel, MatchID: matchID, PUUID: account.PUUID, OpenedAt: now.Unix(), Bets: map[string]bet{}})
+				opened = append(opened, channel)
+			}
+		}
+	}
+	if len(ended) > 0 || len(opened) > 0 {
+		t.saveLocked()
+	}
+	t.mu.Unlock()
+
+	prefix := t.d.Config().Prefix
+	for _, channel := range opened {
+		log.Printf("[#%s] Betting opened for %s", channel, matchID)
+		t.d.bot.Say(channel, fmt.Sprintf("A new game has started! Bet your points with %sbet win <points> or %sbet lose <points>, betting closes in %s.",
+			prefix, prefix, formatDuration(betWindow)))
+	}
+	for _, r := range ended {
+		t.settle(r, now)
+	}
+}
+
+// ---------- Settling ----------
+
+// Pay out or refund a round whose game has ended. The round stays put while
+// match-v5 doesn't have the result yet, until betResultTimeout.
+func (t *BetTracker) settle(r *betRound, now time.Time) {
+	var (
+		result MatchResult
+		found  bool
+	)
+	if len(r.Bets) > 0 {
+		var err error
+		puuid := cmp.Or(r.PUUID, t.d.Accounts()[0].PUUID)
+		result, found, err = t.d.riot.GetMatchResult(r.MatchID, puuid, riotBackgroundWait)
+		if err != nil {
+			log.Printf("Betting: fetching the result of %s: %v", r.MatchID, err)
+		}
+		if !found && now.Sub(time.Unix(r.EndedAt, 0)) < betResultTimeout {
+			return // try again next tick
+		}
+	}
+
+	t.mu.Lock()
+	i := slices.Index(t.rounds, r)
+	if i < 0 {
+		t.mu.Unlock()
+		return
+	}
+	t.rounds = slices.Delete(t.rounds, i, i+1)
+	var announcement string
+	switch {
+	case len(r.Bets) == 0:
+	case !found:
+		r.refundLocked()
+		announcement = "Couldn't find how the last game ended, so all bets were refunded."
+	case result.Remake:
+		r.refundLocked()
+		announcement = "The last game was a remake, so all bets were refunded."
+	default:
+		announcement = r.payOutLocked(result.Win)
+	}
+	t.saveLocked()
+	t.mu.Unlock()
+
+	if announcement != "" {
+		log.Printf("[#%s] Betting on %s settled: %s", r.Channel, r.MatchID, announcement)
+		t.d.bot.Say(r.Channel, announcement)
+	}
+}
+
+// Caller holds the tracker's lock
+func (r *betRound) refundLocked() {
+	for _, b := range r.Bets {
+		points.Add(b.user(), b.Amount)
+	}
+}
+
+// Give each winner their stake back plus a share of the losing side's points
+// in proportion to what they bet, returning the announcement. Caller holds
+// the tracker's lock.
+func (r *betRound) payOutLocked(won bool) string {
+	var winPool, losePool, winners int
+	for _, b := range r.Bets {
+		if b.Win == won {
+			winPool += b.Amount
+			winners++
+		} else {
+			losePool += b.Amount
+		}
+	}
+	outcome := "Defeat"
+	if won {
+		outcome = "Victory"
+	}
+	if winners == 0 {
+		return fmt.Sprintf("%s! Nobody called it, %s went to waste.", outcome, plural(losePool, "point", "points"))
+	}
+	for _, b := range r.Bets {
+		if b.Win == won {
+			points.Add(b.user(), b.Amount+int(int64(b.Amount)*int64(losePool)/int64(winPool)))
+		}
+	}
+	return fmt.Sprintf("%s! %s split %s from %s.", outcome, plural(winners, "winner", "winners"),
+		plural(winPool+losePool, "point", "points"), plural(len(r.Bets)-winners, "losing bet", "losing bets"))
+}
+
+// ---------- !bet ----------
+func init() {
+	registerBuiltin("bet", "bet", 0, "", func(d *Dispatcher, c *CommandContext) {
+		usage := fmt.Sprintf("Usage: %sbet win <points> or %sbet lose <points>", d.Config().Prefix, d.Config().Prefix)
+		if len(c.Args) < 2 {
+			c.Reply(usage)
+			return
+		}
+		var win bool
+		switch strings.ToLower(c.Args[0]) {
+		case "win":
+			win = true
+		case "lose", "loss":
+		default:
+			c.Reply(usage)
+			return
+		}
+		amount := -1
+		if !strings.EqualFold(c.Args[1], "all") {
+			n, err := strconv.Atoi(c.Args[1])
+			if err != nil || n <= 0 {
+				c.Reply(usage)
+				return
+			}
+			amount = n
+		}
+		c.Reply(bets.place(c.Channel, c.Sender, win, amount))
+	})
+}
+
+// Take a bet on the channel's current game, returning the reply. An amount
+// of -1 bets everything. Betting more on the same side adds to the bet.
+func (t *BetTracker) place(channel string, u ChatUser, win bool, amount int) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.currentLocked(channel)
+	if r == nil {
+		return "There's no game to bet on right now."
+	}
+	left := time.Until(time.Unix(r.OpenedAt, 0).Add(betWindow))
+	if left <= 0 {
+		return fmt.Sprintf("Betting closed %s ago and is locked until this game ends.", formatDuration(-left))
+	}
+	prev, ok := r.Bets[u.Key()]
+	if ok && prev.Win != win {
+		return fmt.Sprintf("%s already bet on a %s.", u.Name(), outcomeWord(prev.Win))
+	}
+	if amount < 0 {
+		amount = points.Balance(u)
+	}
+	balance, ok := points.Deduct(u, amount)
+	if !ok || amount == 0 {
+		return fmt.Sprintf("%s only has %s.", u.Name(), plural(balance, "point", "points"))
+	}
+	r.Bets[u.Key()] = bet{Login: u.Login, DisplayName: u.DisplayName, UserID: u.UserID, Win: win, Amount: prev.Amount + amount}
+	t.saveLocked()
+	return fmt.Sprintf("%s bet %s on a %s, betting closes in %s.", u.Name(), plural(prev.Amount+amount, "point", "points"),
+		outcomeWord(win), formatDuration(left))
+}
+
+func outcomeWord(win bool) string {
+	if win {
+		return "win"
+	}
+	return "loss"
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const blockedUsersFile = "ignored_users.json"
+
+// Users ignored from chat with !ignoreuser, opened in main. Unlike
+// IGNORED_USERS these are keyed by user-id, so a rename doesn't escape it.
+var blockedUsers *UserStore[blockEntry]
+
+// ---------- Types ----------
+
+type blockEntry struct {
+	By string `json:"by"` // mod who added the user
+	At int64  `json:"at"` // unix seconds
+}
+
+// Checked before anything else looks at a message, so ignored users can't
+// run commands, start cooldowns, enter raffles or vote. Mods and the
+// broadcaster are never ignored, even if they were added before being
+// modded.
+func isBlocked(u ChatUser) bool {
+	if hasPermission(u, "moderator") {
+		return false
+	}
+	_, blocked := blockedUsers.Get(u)
+	return blocked
+}
+
+// ---------- !ignoreuser / !unignoreuser ----------
+func init() {
+	registerBuiltin("ignoreuser", "ignoreuser", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		target, ok := userArg(d, c, "ignoreuser")
+		if !ok {
+			return
+		}
+		if strings.EqualFold(target.Login, c.Channel) || strings.EqualFold(target.Login, d.bot.Username) {
+			c.Reply(fmt.Sprintf("%s can't be ignored.", target.Login))
+			return
+		}
+		if target.UserID != "" {
+			if isMod, err := isChannelModerator(c, target.UserID); err != nil {
+				log.Printf("ignoreuser: checking if %s is a mod: %v", target.Login, err)
+			} else if isMod {
+				c.Reply(fmt.Sprintf("%s is a moderator and can't be ignored.", target.Name()))
+				return
+			}
+		}
+		if _, ok := blockedUsers.Get(target); ok {
+			c.Reply(fmt.Sprintf("%s is already ignored.", target.Name()))
+			return
+		}
+		blockedUsers.Update(target, func(e *blockEntry) {
+			*e = blockEntry{By: c.Sender.Login, At: time.Now().Unix()}
+		})
+		log.Printf("%s ignored %s (%s)", c.Sender.Login, target.Login, target.Key())
+		c.Reply(fmt.Sprintf("Ignoring %s.", target.Name()))
+	})
+
+	registerBuiltin("unignoreuser", "unignoreuser", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		target, ok := userArg(d, c, "unignoreuser")
+		if !ok {
+			return
+		}
+		if !blockedUsers.Delete(target) {
+			c.Reply(fmt.Sprintf("%s isn't ignored.", target.Name()))
+			return
+		}
+		log.Printf("%s unignored %s", c.Sender.Login, target.Login)
+		c.Reply(fmt.Sprintf("No longer ignoring %s.", target.Name()))
+	})
+}
+
+// The user named in the first argument, with their id from Helix when it
+// can be looked up. Replies and returns false when there is no such user.
+func userArg(d *Dispatcher, c *CommandContext, command string) (ChatUser, bool) {
+	if len(c.Args) < 1 {
+		c.Reply(fmt.Sprintf("Usage: %s%s <user>", d.Config().Prefix, command))
+		return ChatUser{}, false
+	}
+	login := strings.ToLower(strings.TrimPrefix(c.Args[0], "@"))
+	user, err := GetTwitchUser(login)
+	if err != nil {
+		// fall back to the login; the store moves it to their id once they chat
+		log.Printf("Looking up %s: %v", login, err)
+		return ChatUser{Login: login}, true
+	}
+	if user == nil {
+		c.Reply(fmt.Sprintf("There's no Twitch user called %s.", login))
+		return ChatUser{}, false
+	}
+	return ChatUser{Login: user.Login, DisplayName: user.DisplayName, UserID: user.ID}, true
+}
+
+// Whether userID moderates the channel, which needs the broadcaster's token
+// with moderation:read. Mods are never ignored anyway, this just stops
+// !ignoreuser claiming otherwise.
+func isChannelModerator(c *CommandContext, userID string) (bool, error) {
+	broadcasterID, err := channelID(c)
+	if err != nil {
+		return false, err
+	}
+	token, err := userTokens.For(c.Channel, "moderation:read")
+	if err != nil {
+		return false, err
+	}
+	var res struct {
+		Data []struct {
+			UserID string `json:"user_id"`
+		} `json:"data"`
+	}
+	path := "moderation/moderators?broadcaster_id=" + url.QueryEscape(broadcasterID) + "&user_id=" + url.QueryEscape(userID)
+	if err := helixAs(token, "GET", path, nil, &res); err != nil {
+		return false, err
+	}
+	return len(res.Data) > 0, nil
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ---------- Config & Globals ----------
+const (
+	ircHost           = "irc.chat.twitch.tv"
+	ircTLSPort        = "6697"
+	ircPlainPort      = "6667"
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 2 * time.Minute
+	loginTimeout      = 15 * time.Second
+	defaultKeepalive  = 5 * time.Minute
+	pongTimeout       = 10 * time.Second
+	latencyTimeout    = 5 * time.Second
+	joinTimeout       = 15 * time.Second
+	maxMessageLength  = 500
+	anonymousNick     = "justinfan12345"
+)
+
+var (
+	errLoginFailed     = errors.New("login authentication failed")
+	errServerReconnect = errors.New("server requested reconnect")
+)
+
+// ---------- Types ----------
+
+// Live connection to Twitch IRC with its buffered reader
+type ircConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read one line, recording it in the raw traffic log
+func (c *ircConn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if line != "" {
+		logRaw("<", line)
+	}
+	return line, err
+}
+
+// Every outgoing line passes through here, so log it on the way out
+func (c *ircConn) Write(p []byte) (int, error) {
+	logRaw(">", string(p))
+	return c.Conn.Write(p)
+}
+
+// Twitch IRC client that keeps itself connected and hands incoming
+// messages to the registered handlers
+type Bot struct {
+	Username string
+	OAuth    string
+	Channels []string
+	ReadOnly bool // log outgoing chat instead of sending it
+
+	connMu sync.Mutex
+	conn   *ircConn // nil while disconnected
+
+	joinMu     sync.Mutex
+	joined     map[string]bool // channels confirmed on the current connection
+	joinedConn *ircConn
+
+	pingMu       sync.Mutex
+	pendingPings map[string]pendingPing // keyed by PING payload
+	pingSeq      int
+
+	onConnect    []func()
+	onMessage    []func(Message)
+	onNotice     []func(Message)
+	onUserNotice []func(Message)
+	onCommand    map[string][]func(Message)
+}
+
+func NewBot(username, oauth string, channels []string) *Bot {
+	return &Bot{
+		Username:     username,
+		OAuth:        oauth,
+		Channels:     channels,
+		onCommand:    make(map[string][]func(Message)),
+		pendingPings: make(map[string]pendingPing),
+		joined:       make(map[string]bool),
+	}
+}
+
+// A latency probe waiting for its PONG
+type pendingPing struct {
+	sentAt time.Time
+	done   func(time.Duration, error)
+}
+
+// ---------- Handlers ----------
+
+// Called after every successful (re)connect, once the channels are joined
+func (b *Bot) OnConnect(h func()) { b.onConnect = append(b.onConnect, h) }
+
+// Called for every PRIVMSG
+func (b *Bot) OnMessage(h func(Message)) { b.onMessage = append(b.onMessage, h) }
+
+// Called for every NOTICE
+func (b *Bot) OnNotice(h func(Message)) { b.onNotice = append(b.onNotice, h) }
+
+// Called for every USERNOTICE (subs, raids, ...)
+func (b *Bot) OnUserNotice(h func(Message)) { b.onUserNotice = append(b.onUserNotice, h) }
+
+// Called for any other IRC command, e.g. "USERSTATE" or "CLEARCHAT"
+func (b *Bot) On(command string, h func(Message)) {
+	command = strings.ToUpper(command)
+	b.onCommand[command] = append(b.onCommand[command], h)
+}
+
+// Parse a raw line and run the matching handlers. PING and RECONNECT are
+// handled by the connection itself and never reach here.
+func (b *Bot) HandleLine(line string) {
+	msg, ok := parseMessage(strings.TrimSpace(line))
+	if !ok {
+		return
+	}
+	b.dispatch(msg)
+}
+
+func (b *Bot) dispatch(msg Message) {
+	var handlers []func(Message)
+	switch msg.Command {
+	case "PRIVMSG":
+		handlers = b.onMessage
+	case "NOTICE":
+		handlers = b.onNotice
+	case "USERNOTICE":
+		handlers = b.onUserNotice
+	case "CAP":
+		if len(msg.Params) >= 2 && msg.Params[1] == "NAK" {
+			log.Println("Twitch refused the tags/commands capabilities, continuing without tags")
+		}
+	}
+	for _, h := range handlers {
+		h(msg)
+	}
+	for _, h := range b.onCommand[msg.Command] {
+		h(msg)
+	}
+}
+
+// ---------- Sending ----------
+
+// Queue msg for the channel, split into several messages if it is too long
+func (b *Bot) Say(channel, msg string) {
+	b.sendPrivmsg(channel, "", false, msg)
+}
+
+// Like Say, but rendered by Twitch as a threaded reply to parentID
+func (b *Bot) SayReply(channel, parentID, msg string) {
+	b.sendPrivmsg(channel, replyTags(parentID), false, msg)
+}
+
+// Like Say, but sent as a /me action
+func (b *Bot) SayAction(channel, msg string) {
+	b.sendPrivmsg(channel, "", true, msg)
+}
+
+// Tag prefix that makes a PRIVMSG a threaded reply
+func replyTags(parentID string) string {
+	if parentID == "" {
+		return ""
+	}
+	return "@reply-parent-msg-id=" + parentID + " "
+}
+
+// Queue msg with optional tags, wrapping every chunk in CTCP ACTION framing
+// when action is set
+func (b *Bot) sendPrivmsg(channel, tags string, action bool, msg string) {
+	if b.ReadOnly {
+		log.Printf("[read-only] Would send to #%s: %s%s", channel, tags, msg)
+		return
+	}
+	if emoteOnlyBlocks(channel) {
+		log.Printf("[debug] #%s is in emote-only mode, not sending: %q", channel, msg)
+		return
+	}
+	if b.currentConn() == nil {
+		log.Printf("Not connected, dropping message to #%s: %q", channel, msg)
+		return
+	}
+	// leave room for the sender to add duplicateBreaker
+	limit := maxMessageLength - utf8.RuneCountInString(duplicateBreaker)
+	if action {
+		limit -= len(actionPrefix) + len(actionSuffix)
+	}
+	for _, chunk := range splitMessage(msg, limit) {
+		if action {
+			chunk = actionPrefix + chunk + actionSuffix
+		}
+		enqueue(b, channel, fmt.Sprintf("%sPRIVMSG #%s :%s\r\n", tags, channel, chunk))
+	}
+}
+
+func (b *Bot) currentConn() *ircConn {
+	b.connMu.Lock()
+	defer b.connMu.Unlock()
+	return b.conn
+}
+
+func (b *Bot) setConn(conn *ircConn) {
+	b.connMu.Lock()
+	b.conn = conn
+	b.connMu.Unlock()
+}
+
+// Split msg on word boundaries into chunks of at most limit characters.
+// A leading "@user " mention is repeated at the start of every chunk.
+func splitMessage(msg string, limit int) []string {
+	if utf8.RuneCountInString(msg) <= limit {
+		return []string{msg}
+	}
+
+	prefix, body := "", msg
+	if strings.HasPrefix(msg, "@") {
+		if mention, rest, ok := strings.Cut(msg, " "); ok {
+			prefix, body = mention+" ", rest
+		}
+	}
+	room := limit - utf8.RuneCountInString(prefix)
+	if room <= 0 {
+		prefix, body, room = "", msg, limit
+	}
+
+	var chunks []string
+	var current strings.Builder
+	currentLen := 0
+	flush := func() {
+		if currentLen > 0 {
+			chunks = append(chunks, prefix+current.String())
+			current.Reset()
+			currentLen = 0
+		}
+	}
+
+	for _, word := range strings.Fields(body) {
+		// words that can never fit are cut at the limit
+		for utf8.RuneCountInString(word) > room {
+			flush()
+			runes := []rune(word)
+			chunks = append(chunks, prefix+string(runes[:room]))
+			word = string(runes[room:])
+		}
+
+		wordLen := utf8.RuneCountInString(word)
+		if currentLen > 0 && currentLen+1+wordLen > room {
+			flush()
+		}
+		if currentLen > 0 {
+			current.WriteByte(' ')
+			currentLen++
+		}
+		current.WriteString(word)
+		currentLen += wordLen
+	}
+	flush()
+
+	return chunks
+}
+
+// ---------- Joins ----------
+
+// Start waiting for every channel's JOIN on conn, logging the ones that
+// aren't confirmed within joinTimeout
+func (b *Bot) watchJoins(conn *ircConn) {
+	b.joinMu.Lock()
+	b.joined = make(map[string]bool)
+	b.joinedConn = conn
+	b.joinMu.Unlock()
+
+	time.AfterFunc(joinTimeout, func() {
+		b.joinMu.Lock()
+		defer b.joinMu.Unlock()
+		if b.joinedConn != conn {
+			return // reconnected in the meantime
+		}
+		for _, channel := range b.Channels {
+			if !b.joined[channel] {
+				log.Printf("Failed to join #%s: no response within %s (check the channel name in TWITCH_CHANNEL)", channel, joinTimeout)
+			}
+		}
+	})
+}
+
+func (b *Bot) confirmJoin(conn *ircConn, channel string) {
+	b.joinMu.Lock()
+	defer b.joinMu.Unlock()
+	if b.joinedConn != conn || b.joined[channel] {
+		return
+	}
+	b.joined[channel] = true
+	log.Printf("Joined #%s", channel)
+	if len(b.joined) == len(b.Channels) {
+		log.Printf("Connected to Twitch IRC as %s in %d channel(s)", b.Username, len(b.joined))
+	}
+}
+
+// Whether the bot's JOIN to channel was confirmed on the current connection
+func (b *Bot) IsJoined(channel string) bool {
+	b.joinMu.Lock()
+	defer b.joinMu.Unlock()
+	return b.joinedConn == b.currentConn() && b.joined[channel]
+}
+
+// ---------- Latency ----------
+
+// Send a PING with a unique payload and call done with the round trip time
+// once the matching PONG arrives, or with an error after latencyTimeout.
+// done runs on another goroutine, never the caller's.
+func (b *Bot) MeasureLatency(done func(time.Duration, error)) {
+	conn := b.currentConn()
+	if conn == nil {
+		go done(0, errors.New("not connected"))
+		return
+	}
+
+	b.pingMu.Lock()
+	b.pingSeq++
+	payload := fmt.Sprintf("latency-%d-%d", time.Now().UnixNano(), b.pingSeq)
+	b.pendingPings[payload] = pendingPing{sentAt: time.Now(), done: done}
+	b.pingMu.Unlock()
+
+	sendControl(conn, fmt.Sprintf("PING :%s\r\n", payload))
+
+	time.AfterFunc(latencyTimeout, func() {
+		if p, ok := b.takePendingPing(payload); ok {
+			p.done(0, fmt.Errorf("no PONG within %s", latencyTimeout))
+		}
+	})
+}
+
+func (b *Bot) handlePong(payload string) {
+	if p, ok := b.takePendingPing(payload); ok {
+		go p.done(time.Since(p.sentAt), nil)
+	}
+}
+
+func (b *Bot) takePendingPing(payload string) (pendingPing, bool) {
+	b.pingMu.Lock()
+	defer b.pingMu.Unlock()
+	p, ok := b.pendingPings[payload]
+	delete(b.pendingPings, payload)
+	return p, ok
+}
+
+// ---------- Connection ----------
+
+// Connect and keep reconnecting with exponential backoff until ctx is
+// cancelled, then leave the channels and return
+func (b *Bot) Run(ctx context.Context) {
+	delay := reconnectMinDelay
+	for attempt := 1; ; attempt++ {
+		log.Printf("Connecting to Twitch IRC (attempt %d)", attempt)
+		conn, err := connect(b.Username, b.OAuth, b.Channels)
+		if errors.Is(err, errLoginFailed) {
+			log.Fatalf("Twitch rejected the login (%v). TWITCH_OAUTH_TOKEN is invalid or expired, generate a new one with the oauth: prefix", err)
+		}
+		if err != nil {
+			log.Printf("Connect attempt %d failed: %v (retrying in %s)", attempt, err, delay)
+			if !sleepContext(ctx, delay) {
+				b.shutdown(nil)
+				return
+			}
+			delay = nextBackoff(delay)
+			continue
+		}
+		log.Println("Logged in to Twitch IRC as", b.Username)
+
+		b.setConn(conn)
+		b.watchJoins(conn)
+		for _, h := range b.onConnect {
+			h()
+		}
+
+		connectedAt := time.Now()
+		err = b.readLoop(ctx, conn)
+		b.setConn(nil)
+		if ctx.Err() != nil {
+			b.shutdown(conn)
+			return
+		}
+		conn.Close()
+
+		if errors.Is(err, errServerReconnect) {
+			log.Println("Twitch sent RECONNECT (server-initiated), reconnecting now")
+			delay = reconnectMinDelay
+			attempt = 0
+			continue
+		}
+
+		// a connection that stayed up for a while resets the backoff
+		if time.Since(connectedAt) > reconnectMaxDelay {
+			delay = reconnectMinDelay
+			attempt = 0
+		}
+		log.Printf("Read error: %v (reconnecting in %s)", err, delay)
+		if !sleepContext(ctx, delay) {
+			b.shutdown(nil)
+			return
+		}
+		delay = nextBackoff(delay)
+	}
+}
+
+// Leave the channels, close the connection and flush caches to disk
+func (b *Bot) shutdown(conn *ircConn) {
+	log.Println("Shutting down...")
+	if conn != nil {
+		// PARTs go through the sender like every other write, so they can't
+		// interleave with a line it's halfway through
+		parts := make([]string, len(b.Channels))
+		for i, channel := range b.Channels {
+			parts[i] = fmt.Sprintf("PART #%s\r\n", channel)
+		}
+		if !flushControl(conn, parts, partTimeout) {
+			log.Printf("Leaving the channels took over %s, closing the connection anyway", partTimeout)
+		}
+		conn.Close()
+	}
+	FlushCaches()
+	log.Println("Shutdown complete")
+}
+
+// Handle lines from the reader goroutine until the connection fails, goes
+// silent or ctx is cancelled
+func (b *Bot) readLoop(ctx context.Context, conn *ircConn) error {
+	done := make(chan struct{})
+	defer close(done)
+	lines, readErr := startReader(conn, done)
+
+	keepalive := keepaliveInterval()
+	idle := time.NewTimer(keepalive)
+	defer idle.Stop()
+	awaitingPong := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-readErr:
+			return err
+		case <-idle.C:
+			if awaitingPong {
+				return fmt.Errorf("no PONG within %s, connection is stale", pongTimeout)
+			}
+			// the connection has been silent, make sure it is still alive
+			sendControl(conn, "PING :keepalive\r\n")
+			awaitingPong = true
+			idle.Reset(pongTimeout)
+		case line := <-lines:
+			awaitingPong = false
+			idle.Reset(keepalive)
+			if err := b.processLine(conn, line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Read lines from conn on their own goroutine until a read fails or done is
+// closed. A read blocked when done closes returns once conn is closed.
+func startReader(conn *ircConn, done <-chan struct{}) (<-chan string, <-chan error) {
+	lines := make(chan string, 64)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			line, err := conn.readLine()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case lines <- line:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return lines, readErr
+}
+
+// Handle one line, returning an error when the connection has to be dropped
+func (b *Bot) processLine(conn *ircConn, line string) error {
+	msg, ok := parseMessage(strings.TrimSpace(line))
+	if !ok {
+		return nil
+	}
+
+	switch msg.Command {
+	case "PING":
+		sendControl(conn, fmt.Sprintf("PONG :%s\r\n", msg.Trailing))
+	case "PONG":
+		b.handlePong(msg.Trailing)
+	case "RECONNECT":
+		return errServerReconnect
+	case "366": // end of NAMES, sent once a JOIN went through
+		if len(msg.Params) >= 2 {
+			b.confirmJoin(conn, strings.TrimPrefix(msg.Params[1], "#"))
+		}
+		b.dispatch(msg)
+	case "JOIN":
+		if strings.EqualFold(msg.Nick(), b.Username) {
+			b.confirmJoin(conn, msg.Channel())
+		}
+		b.dispatch(msg)
+	default:
+		b.dispatch(msg)
+	}
+	return nil
+}
+
+// Dial Twitch IRC, authenticate and join every channel
+func connect(username, oauth string, channels []string) (*ircConn, error) {
+	netConn, err := dialIRC()
+	if err != nil {
+		return nil, err
+	}
+	conn := &ircConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if oauth != "" {
+		fmt.Fprintf(conn, "PASS %s\r\n", oauth)
+	}
+	fmt.Fprintf(conn, "NICK %s\r\n", username)
+	fmt.Fprintf(conn, "CAP REQ :twitch.tv/tags twitch.tv/commands\r\n")
+
+	if err := waitForWelcome(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	for _, channel := range channels {
+		waitForJoin(channel)
+		fmt.Fprintf(conn, "JOIN #%s\r\n", channel)
+	}
+
+	return conn, nil
+}
+
+// Read until the 001 welcome numeric, failing on an auth NOTICE or timeout
+func waitForWelcome(conn *ircConn) error {
+	conn.SetReadDeadline(time.Now().Add(loginTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		line, err := conn.readLine()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no welcome from Twitch within %s", loginTimeout)
+			}
+			return err
+		}
+		msg, ok := parseMessage(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+
+		switch msg.Command {
+		case "001":
+			return nil
+		case "PING":
+			fmt.Fprintf(conn, "PONG :%s\r\n", msg.Trailing)
+		case "NOTICE":
+			if strings.Contains(msg.Trailing, "Login authentication failed") ||
+				strings.Contains(msg.Trailing, "Improperly formatted auth") {
+				return fmt.Errorf("%w: %s", errLoginFailed, msg.Trailing)
+			}
+		}
+	}
+}
+
+// Dial over TLS by default; TWITCH_IRC_INSECURE=1 falls back to plain TCP
+func dialIRC() (net.Conn, error) {
+	if os.Getenv("TWITCH_IRC_INSECURE") == "1" {
+		log.Println("TWITCH_IRC_INSECURE=1, connecting without TLS")
+		return net.Dial("tcp", net.JoinHostPort(ircHost, ircPlainPort))
+	}
+
+	conn, err := tls.Dial("tcp", net.JoinHostPort(ircHost, ircTLSPort), &tls.Config{ServerName: ircHost})
+	if err != nil {
+		var verifyErr *tls.CertificateVerificationError
+		if errors.As(err, &verifyErr) {
+			log.Fatalf("TLS certificate verification failed for %s: %v (check the system clock and CA certificates, or set TWITCH_IRC_INSECURE=1 to debug)", ircHost, verifyErr.Err)
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Idle time before a keepalive PING, from IRC_KEEPALIVE_SECONDS
+func keepaliveInterval() time.Duration {
+	if s, err := strconv.Atoi(os.Getenv("IRC_KEEPALIVE_SECONDS")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultKeepalive
+}
+
+func nextBackoff(d time.Duration) time.Duration {
+	return min(d*2, reconnectMaxDelay)
+}
+
+// Sleep for d, returning false early if the context is cancelled
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	long := strings.TrimSpace(strings.Repeat("lorem ipsum ", 100)) // 1199 characters
+	tests := []struct {
+		name   string
+		msg    string
+		limit  int
+		prefix string // repeated at the start of every chunk
+		chunks int
+	}{
+		{"short", "hello there", maxMessageLength, "", 1},
+		{"exactly the limit", strings.Repeat("a", maxMessageLength), maxMessageLength, "", 1},
+		{"1200 characters with a mention", "@viewer " + long[:1200-len("@viewer ")], maxMessageLength, "@viewer ", 3},
+		{"1200 characters without one", long, maxMessageLength, "", 3},
+		{"word longer than the limit", strings.Repeat("x", 1200), maxMessageLength, "", 3},
+		{"multibyte", strings.TrimSpace(strings.Repeat("héllo wörld ", 100)), maxMessageLength, "", 3},
+		{"mention longer than the limit", "@" + strings.Repeat("u", 20) + " " + long, 15, "", 0},
+	}
+	for _, tt := range tests {
+		chunks := splitMessage(tt.msg, tt.limit)
+		if tt.chunks > 0 && len(chunks) != tt.chunks {
+			t.Errorf("%s: %d chunks, want %d", tt.name, len(chunks), tt.chunks)
+		}
+		var rebuilt []string
+		for i, c := range chunks {
+			if n := utf8.RuneCountInString(c); n > tt.limit {
+				t.Errorf("%s: chunk %d is %d characters, over %d", tt.name, i, n, tt.limit)
+			}
+			if c == "" || c != strings.TrimSpace(c) {
+				t.Errorf("%s: chunk %d is %q, want no surrounding space", tt.name, i, c)
+			}
+			if !strings.HasPrefix(c, tt.prefix) {
+				t.Errorf("%s: chunk %d doesn't start with %q", tt.name, i, tt.prefix)
+			}
+			rebuilt = append(rebuilt, strings.TrimPrefix(c, tt.prefix))
+		}
+		// nothing is lost: words survive, only the spaces chunks broke on go
+		want := strings.Join(strings.Fields(strings.TrimPrefix(tt.msg, tt.prefix)), "")
+		if got := strings.ReplaceAll(strings.Join(rebuilt, ""), " ", ""); got != want {
+			t.Errorf("%s: chunks don't add back up to the message", tt.name)
+		}
+	}
+}
+
+// Drain whatever sendPrivmsg queued
+func queuedChat() []outgoingMessage {
+	var queued []outgoingMessage
+	for {
+		select {
+		case m := <-sendQueue:
+			queued = append(queued, m)
+		default:
+			return queued
+		}
+	}
+}
+
+func TestSayReplySplitsLongResponses(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	b.setConn(&ircConn{})
+	queuedChat()
+
+	long := strings.TrimSpace(strings.Repeat("lorem ipsum ", 100))
+	tests := []struct {
+		name   string
+		send   func()
+		prefix string // on the wire, before the chunk's text
+		chunks int
+	}{
+		{"mention", func() { b.Say("streamer", "@viewer "+long[:1200-len("@viewer ")]) }, "PRIVMSG #streamer :@viewer ", 3},
+		{"threaded reply", func() { b.SayReply("streamer", "abc-123", long) }, "@reply-parent-msg-id=abc-123 PRIVMSG #streamer :", 3},
+		{"action", func() { b.SayAction("streamer", long) }, "PRIVMSG #streamer :\x01ACTION ", 3},
+	}
+	for _, tt := range tests {
+		tt.send()
+		queued := queuedChat()
+		if len(queued) != tt.chunks {
+			t.Errorf("%s: %d messages queued, want %d", tt.name, len(queued), tt.chunks)
+		}
+		for i, m := range queued {
+			if m.channel != "streamer" || !strings.HasPrefix(m.line, tt.prefix) || !strings.HasSuffix(m.line, "\r\n") {
+				t.Errorf("%s: message %d is malformed: %q", tt.name, i, m.line)
+				continue
+			}
+			// the sender may still add duplicateBreaker to the text
+			text := chatText(strings.TrimSuffix(m.line, "\r\n"))
+			if n := utf8.RuneCountInString(text + duplicateBreaker); n >= maxMessageLength {
+				t.Errorf("%s: message %d has %d characters of text, want under %d", tt.name, i, n, maxMessageLength)
+			}
+		}
+	}
+}
+
+func TestProcessLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		fired   []string // handlers that ran, in order
+		err     error
+		control string // line queued ahead of chat, if any
+		joined  string // channel confirmed joined, if any
+	}{
+		{name: "privmsg", line: "@user-id=1 :alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :!rank", fired: []string{"message #streamer alice: !rank"}},
+		{name: "notice", line: "@msg-id=emote_only_on :tmi.twitch.tv NOTICE #streamer :This room is now in emote-only mode.", fired: []string{"notice emote_only_on"}},
+		{name: "usernotice", line: "@msg-id=raid;login=raider :tmi.twitch.tv USERNOTICE #streamer", fired: []string{"usernotice raid"}},
+		{name: "other command", line: ":tmi.twitch.tv CLEARCHAT #streamer :bob", fired: []string{"CLEARCHAT bob"}},
+		{name: "unhandled command", line: ":tmi.twitch.tv HOSTTARGET #streamer :- 0"},
+		{name: "ping", line: "PING :tmi.twitch.tv", control: "PONG :tmi.twitch.tv\r\n"},
+		{name: "unsolicited pong", line: ":tmi.twitch.tv PONG tmi.twitch.tv :unknown"},
+		{name: "reconnect", line: ":tmi.twitch.tv RECONNECT", err: errServerReconnect},
+		{name: "own join", line: ":bot!bot@bot.tmi.twitch.tv JOIN #streamer", fired: []string{"JOIN bot"}, joined: "streamer"},
+		{name: "someone else's join", line: ":alice!alice@alice.tmi.twitch.tv JOIN #other", fired: []string{"JOIN alice"}},
+		{name: "end of names", line: ":bot.tmi.twitch.tv 366 bot #other :End of /NAMES list", fired: []string{"366"}, joined: "other"},
+		{name: "garbage", line: "   "},
+	}
+	for _, tt := range tests {
+		b := NewBot("bot", "", []string{"streamer", "other"})
+		var fired []string
+		b.OnMessage(func(m Message) { fired = append(fired, "message #"+m.Channel()+" "+m.Nick()+": "+m.Trailing) })
+		b.OnNotice(func(m Message) { fired = append(fired, "notice "+m.Tags["msg-id"]) })
+		b.OnUserNotice(func(m Message) { fired = append(fired, "usernotice "+m.Tags["msg-id"]) })
+		b.On("clearchat", func(m Message) { fired = append(fired, "CLEARCHAT "+m.Trailing) })
+		b.On("JOIN", func(m Message) { fired = append(fired, "JOIN "+m.Nick()) })
+		b.On("366", func(m Message) { fired = append(fired, "366") })
+
+		conn := &ircConn{}
+		b.setConn(conn)
+		b.joinedConn = conn
+		err := b.processLine(conn, tt.line)
+
+		if err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+		if strings.Join(fired, "|") != strings.Join(tt.fired, "|") {
+			t.Errorf("%s: handlers %q, want %q", tt.name, fired, tt.fired)
+		}
+		var control string
+		select {
+		case m := <-controlQueue:
+			control = m.line
+		default:
+		}
+		if control != tt.control {
+			t.Errorf("%s: queued %q, want %q", tt.name, control, tt.control)
+		}
+		for _, channel := range b.Channels {
+			if got, want := b.IsJoined(channel), channel == tt.joined; got != want {
+				t.Errorf("%s: IsJoined(%s) = %v, want %v", tt.name, channel, got, want)
+			}
+		}
+	}
+}
+
+func TestHandleLineRunsEveryHandler(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	var order []string
+	for _, name := range []string{"first", "second", "third"} {
+		b.OnMessage(func(Message) { order = append(order, name) })
+	}
+	b.On("PRIVMSG", func(Message) { order = append(order, "command") })
+
+	lines := []string{
+		":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :hi\r\n",
+		":bob!bob@bob.tmi.twitch.tv PRIVMSG #streamer :\x01ACTION waves\x01\r\n",
+	}
+	for _, line := range lines {
+		b.HandleLine(line)
+	}
+	if got, want := strings.Join(order, ","), "first,second,third,command,first,second,third,command"; got != want {
+		t.Errorf("handlers ran as %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// ---------- Config & Globals ----------
+const (
+	maxTitleLength  = 140 // Helix rejects longer titles
+	manageBroadcast = "channel:manage:broadcast"
+)
+
+// ---------- Types ----------
+
+type twitchCategory struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ---------- !settitle / !setgame ----------
+func init() {
+	registerBuiltin("settitle", "settitle", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		title := strings.Join(c.Args, " ")
+		if title == "" {
+			c.Reply(fmt.Sprintf("Usage: %s%s <new title>", d.Config().Prefix, c.Command))
+			return
+		}
+		if utf8.RuneCountInString(title) > maxTitleLength {
+			c.Reply(fmt.Sprintf("Titles can be at most %d characters.", maxTitleLength))
+			return
+		}
+		broadcasterID, ok := updateChannel(c, map[string]string{"title": title})
+		if !ok {
+			return
+		}
+		newTitle, _, err := GetChannelInfo(broadcasterID)
+		if err != nil {
+			log.Printf("settitle: reading back: %v", err)
+			c.Reply("Title updated.")
+			return
+		}
+		log.Printf("%s set the title of #%s to %q", c.Sender.Login, c.Channel, newTitle)
+		c.Reply("Title is now: " + newTitle)
+	})
+
+	registerBuiltin("setgame", "setgame", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		query := strings.Join(c.Args, " ")
+		if query == "" {
+			c.Reply(fmt.Sprintf("Usage: %s%s <category>", d.Config().Prefix, c.Command))
+			return
+		}
+		category, err := FindCategory(query)
+		if err != nil {
+			log.Printf("setgame: searching %q: %v", query, err)
+			c.Reply("Couldn't search categories right now.")
+			return
+		}
+		if category == nil {
+			c.Reply(fmt.Sprintf("No category matches %q.", query))
+			return
+		}
+		broadcasterID, ok := updateChannel(c, map[string]string{"game_id": category.ID})
+		if !ok {
+			return
+		}
+		_, game, err := GetChannelInfo(broadcasterID)
+		if err != nil {
+			log.Printf("setgame: reading back: %v", err)
+			game = category.Name
+		}
+		log.Printf("%s set the category of #%s to %s", c.Sender.Login, c.Channel, game)
+		c.Reply("Category is now: " + game)
+	})
+}
+
+// PATCH the channel's information with the broadcaster's token, replying
+// with the problem and returning false if that fails
+func updateChannel(c *CommandContext, changes map[string]string) (string, bool) {
+	broadcasterID, err := channelID(c)
+	if err != nil {
+		log.Printf("Looking up #%s: %v", c.Channel, err)
+		c.Reply("Couldn't update the channel right now.")
+		return "", false
+	}
+	token, err := userTokens.For(c.Channel, manageBroadcast)
+	if err != nil {
+		log.Printf("Updating #%s: %v", c.Channel, err)
+		c.Reply("The broadcaster needs to authorize the bot first (--authorize).")
+		return "", false
+	}
+	if err := helixAs(token, "PATCH", "channels?broadcaster_id="+url.QueryEscape(broadcasterID), changes, nil); err != nil {
+		log.Printf("Updating #%s: %v", c.Channel, err)
+		c.Reply("Twitch didn't accept the change.")
+		return "", false
+	}
+	forgetStreamInfo(c.Channel)
+	return broadcasterID, true
+}
+
+// Best category for a search: an exact name match if there is one,
+// otherwise Twitch's top result. Returns nil when nothing matches.
+func FindCategory(query string) (*twitchCategory, error) {
+	var res struct {
+		Data []twitchCategory `json:"data"`
+	}
+	if err := helixGet("search/categories?first=20&query="+url.QueryEscape(query), &res); err != nil {
+		return nil, err
+	}
+	if len(res.Data) == 0 {
+		return nil, nil
+	}
+	for i, cat := range res.Data {
+		if strings.EqualFold(cat.Name, query) {
+			return &res.Data[i], nil
+		}
+	}
+	return &res.Data[0], nil
+}
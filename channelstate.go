@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+var (
+	channelStates   = map[string]*channelState{}
+	channelStatesMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// What the bot knows about itself and the room in a joined channel
+type channelState struct {
+	IsMod         bool
+	SlowSeconds   int
+	EmoteOnly     bool
+	FollowersOnly int // minutes of follow required, -1 when off
+}
+
+// Return the state for channel, creating it on first use. Caller holds channelStatesMu.
+func stateFor(channel string) *channelState {
+	s, ok := channelStates[channel]
+	if !ok {
+		s = &channelState{FollowersOnly: -1}
+		channelStates[channel] = s
+	}
+	return s
+}
+
+// ---------- USERSTATE ----------
+
+// Record the bot's mod status from a USERSTATE message, logging changes
+func updateUserState(channel string, tags map[string]string) {
+	badges := parseBadges(tags["badges"])
+	_, broadcaster := badges["broadcaster"]
+	isMod := tags["mod"] == "1" || broadcaster
+
+	channelStatesMu.Lock()
+	s := stateFor(channel)
+	changed := s.IsMod != isMod
+	s.IsMod = isMod
+	channelStatesMu.Unlock()
+
+	if changed {
+		if isMod {
+			log.Printf("Bot is now a moderator in #%s", channel)
+		} else {
+			log.Printf("Bot is no longer a moderator in #%s", channel)
+		}
+	}
+}
+
+// ---------- ROOMSTATE ----------
+
+// Apply a ROOMSTATE message. The first one after JOIN carries every setting,
+// later ones only the setting a moderator just changed.
+func updateRoomState(channel string, tags map[string]string) {
+	channelStatesMu.Lock()
+	defer channelStatesMu.Unlock()
+	s := stateFor(channel)
+
+	if v, ok := tags["slow"]; ok {
+		slow, _ := strconv.Atoi(v)
+		if slow != s.SlowSeconds {
+			log.Printf("[#%s] Slow mode: %ds", channel, slow)
+		}
+		s.SlowSeconds = slow
+	}
+	if v, ok := tags["emote-only"]; ok {
+		emoteOnly := v == "1"
+		if emoteOnly != s.EmoteOnly {
+			log.Printf("[#%s] Emote-only mode: %t", channel, emoteOnly)
+		}
+		s.EmoteOnly = emoteOnly
+	}
+	if v, ok := tags["followers-only"]; ok {
+		followers, err := strconv.Atoi(v)
+		if err != nil {
+			followers = -1
+		}
+		if followers != s.FollowersOnly {
+			log.Printf("[#%s] Followers-only mode: %d", channel, followers)
+		}
+		s.FollowersOnly = followers
+	}
+}
+
+// Minimum spacing between the bot's messages in channel. Moderators are not
+// subject to slow mode.
+func slowModeInterval(channel string) time.Duration {
+	channelStatesMu.Lock()
+	defer channelStatesMu.Unlock()
+	s, ok := channelStates[channel]
+	if !ok || s.IsMod {
+		return 0
+	}
+	return time.Duration(s.SlowSeconds) * time.Second
+}
+
+// Whether text messages from the bot would be rejected by emote-only mode
+func emoteOnlyBlocks(channel string) bool {
+	channelStatesMu.Lock()
+	defer channelStatesMu.Unlock()
+	s, ok := channelStates[channel]
+	return ok && s.EmoteOnly && !s.IsMod
+}
+
+// Whether the bot has moderator (or broadcaster) rights in channel
+func isModIn(channel string) bool {
+	channelStatesMu.Lock()
+	defer channelStatesMu.Unlock()
+	if s, ok := channelStates[channel]; ok {
+		return s.IsMod
+	}
+	return false
+}
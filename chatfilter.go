@@ -0,0 +1,545 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ---------- Config & Globals ----------
+const (
+	permitDuration       = 60 * time.Second
+	defaultFilterTimeout = 10      // seconds
+	maxFilterTimeout     = 1209600 // two weeks, the longest timeout Helix allows
+	defaultLinkWarning   = "{user}, please don't post links without a !permit."
+	manageChatMessages   = "moderator:manage:chat_messages"
+	manageBannedUsers    = "moderator:manage:banned_users"
+
+	punishWorkers   = 2
+	punishQueueSize = 64
+	punishDeadline  = 30 * time.Second // a punishment still queued after this is dropped
+)
+
+// Links with a scheme or www., and bare domains on common TLDs so that
+// "e.g." or "file.txt" don't count
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://[^\s/$.?#]\S*|www\.\S+|(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|net|org|io|gg|tv|co|me|ly|be|de|uk|ru|xyz|info|link|app|dev|site|online|shop|live|stream|gl|to|us|ca)\b(?:/\S*)?)`)
+
+var filterActions = map[string]bool{"delete": true, "timeout": true, "warn": true}
+
+// Outstanding !permit grants per channel, by lowercased login
+var (
+	permits   = map[string]map[string]time.Time{}
+	permitsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// The "moderation" section of commands.json. Each filter is off unless it
+// is present.
+type ModerationConfig struct {
+	Links         *LinkFilterConfig    `json:"links,omitempty"`
+	BannedPhrases *BannedPhrasesConfig `json:"banned_phrases,omitempty"`
+	Caps          *CapsFilterConfig    `json:"caps,omitempty"`
+	Emotes        *EmoteFilterConfig   `json:"emotes,omitempty"`
+}
+
+type LinkFilterConfig struct {
+	Action         string   `json:"action,omitempty"`          // "delete" (default), "timeout" or "warn"
+	Timeout        int      `json:"timeout,omitempty"`         // seconds, for action "timeout"
+	Exempt         string   `json:"exempt,omitempty"`          // level allowed to post links, e.g. "subscriber"; mods always are
+	AllowedDomains []string `json:"allowed_domains,omitempty"` // links to these (and their subdomains) are fine
+	Message        string   `json:"message,omitempty"`         // posted when a link is caught, {user}; "" for the default
+}
+
+type BannedPhrasesConfig struct {
+	Phrases  []BannedPhrase `json:"phrases"`
+	Timeouts []int          `json:"timeouts,omitempty"` // seconds for the 1st, 2nd, ... offense in a stream; the last repeats
+	Message  string         `json:"message,omitempty"`  // posted on a match, {user}; none by default
+
+	compiled []compiledPhrase
+}
+
+// One phrase: plain text matched anywhere ignoring case, or a regex. The id
+// is what gets logged, so the phrase itself never ends up in the log.
+type BannedPhrase struct {
+	ID    string `json:"id,omitempty"`
+	Text  string `json:"text,omitempty"`
+	Regex string `json:"regex,omitempty"`
+}
+
+type compiledPhrase struct {
+	ID   string
+	Text string // lowercased
+	Re   *regexp.Regexp
+}
+
+var defaultPhraseTimeouts = []int{10, 60, 600}
+
+// Offenses per user in each channel's current stream, keyed by
+// "<channel> <filter>", for warnings and escalating timeouts
+var (
+	offenses   = map[string]*streamOffenses{}
+	offensesMu sync.Mutex
+)
+
+type streamOffenses struct {
+	StreamStart int64
+	Counts      map[string]int // ChatUser.Key
+}
+
+// Too much of the message in capitals
+type CapsFilterConfig struct {
+	MinLength  int `json:"min_length,omitempty"`  // shorter messages are never caught (default 15 characters)
+	MaxPercent int `json:"max_percent,omitempty"` // share of letters that may be uppercase (default 70)
+	WarnThenTimeout
+}
+
+// Too many emotes in one message, counted from the emotes tag
+type EmoteFilterConfig struct {
+	Max int `json:"max,omitempty"` // emotes allowed per message (default 10)
+	WarnThenTimeout
+}
+
+// Enforcement shared by the caps and emote filters: the first offense in a
+// stream gets a warning, repeats a timeout
+type WarnThenTimeout struct {
+	Timeout int    `json:"timeout,omitempty"` // seconds (default 10)
+	Exempt  string `json:"exempt,omitempty"`  // level that isn't filtered, e.g. "vip"; mods never are
+	Message string `json:"message,omitempty"` // warning, {user}; "" for the default
+	DryRun  bool   `json:"dry_run,omitempty"` // only log what would have happened
+}
+
+const (
+	defaultCapsMinLength  = 15
+	defaultCapsMaxPercent = 70
+	defaultMaxEmotes      = 10
+	defaultCapsWarning    = "{user}, please ease up on the caps."
+	defaultEmotesWarning  = "{user}, please don't spam emotes."
+)
+
+// What to do about a message a filter caught
+type punishment struct {
+	Action  string // see filterActions
+	Timeout int    // seconds
+	Reason  string // shown to the user by Twitch and logged
+	Warning string // posted in chat, may be empty
+}
+
+// A punishment waiting for RunModeration
+type queuedPunishment struct {
+	Msg        Message
+	User       ChatUser
+	Punishment punishment
+	Queued     time.Time
+}
+
+func validateModeration(m *ModerationConfig) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("%q: ", moderationSection)+fmt.Sprintf(format, args...))
+	}
+	if l := m.Links; l != nil {
+		if l.Action != "" && !filterActions[l.Action] {
+			add("links: unknown action %q (known: %s)", l.Action, knownNames(filterActions))
+		}
+		if l.Timeout < 0 || l.Timeout > maxFilterTimeout {
+			add("links: timeout can't be negative or over %d seconds", maxFilterTimeout)
+		}
+		if l.Exempt != "" {
+			if _, ok := permissionLevels[l.Exempt]; !ok {
+				add("links: unknown exempt level %q (known: %s)", l.Exempt, knownLevels())
+			}
+		}
+	}
+	if b := m.BannedPhrases; b != nil {
+		b.compiled = nil
+		for i, p := range b.Phrases {
+			id := p.ID
+			if id == "" {
+				id = fmt.Sprintf("#%d", i+1)
+			}
+			switch {
+			case (p.Text == "") == (p.Regex == ""):
+				add("banned_phrases: phrase %s needs exactly one of \"text\" or \"regex\"", id)
+			case p.Regex != "":
+				re, err := regexp.Compile("(?i)" + p.Regex)
+				if err != nil {
+					// the error quotes the pattern, keep it out of the output
+					add("banned_phrases: phrase %s has an invalid regex", id)
+					continue
+				}
+				b.compiled = append(b.compiled, compiledPhrase{ID: id, Re: re})
+			default:
+				b.compiled = append(b.compiled, compiledPhrase{ID: id, Text: strings.ToLower(cleanText(p.Text))})
+			}
+		}
+		for _, t := range b.Timeouts {
+			if t < 1 || t > maxFilterTimeout {
+				add("banned_phrases: timeouts must be between 1 and %d seconds", maxFilterTimeout)
+				break
+			}
+		}
+	}
+	if c := m.Caps; c != nil {
+		if c.MinLength < 0 {
+			add("caps: min_length can't be negative")
+		}
+		if c.MaxPercent < 0 || c.MaxPercent > 100 {
+			add("caps: max_percent must be between 0 and 100")
+		}
+		problems = append(problems, c.WarnThenTimeout.validate("caps")...)
+	}
+	if e := m.Emotes; e != nil {
+		if e.Max < 0 {
+			add("emotes: max can't be negative")
+		}
+		problems = append(problems, e.WarnThenTimeout.validate("emotes")...)
+	}
+	return problems
+}
+
+func (w WarnThenTimeout) validate(filter string) []string {
+	var problems []string
+	if w.Timeout < 0 || w.Timeout > maxFilterTimeout {
+		problems = append(problems, fmt.Sprintf("%q: %s: timeout can't be negative or over %d seconds", moderationSection, filter, maxFilterTimeout))
+	}
+	if w.Exempt != "" {
+		if _, ok := permissionLevels[w.Exempt]; !ok {
+			problems = append(problems, fmt.Sprintf("%q: %s: unknown exempt level %q (known: %s)", moderationSection, filter, w.Exempt, knownLevels()))
+		}
+	}
+	return problems
+}
+
+// ---------- Filtering ----------
+
+// Called by the dispatcher for every chat message before anything else
+// sees it. Returns true when the message was removed, so it doesn't also
+// run a command. Mods and the broadcaster are never filtered.
+func (d *Dispatcher) moderate(msg Message, u ChatUser, text string) bool {
+	if hasPermission(u, "moderator") {
+		return false
+	}
+	config := d.Config().Moderation
+
+	if b := config.BannedPhrases; b != nil {
+		if id, ok := b.match(text); ok {
+			timeout := nextPhraseTimeout(msg.Channel(), u, b.Timeouts)
+			log.Printf("[#%s] %s matched banned phrase %s", msg.Channel(), u.Login, id)
+			return d.punish(msg, u, punishment{
+				Action:  "timeout",
+				Timeout: timeout,
+				Reason:  "banned phrase",
+				Warning: b.Message,
+			})
+		}
+	}
+
+	if c := config.Caps; c != nil && tooManyCaps(text, c) {
+		if removed, done := d.warnThenTimeout(msg, u, "caps", c.WarnThenTimeout, defaultCapsWarning); done {
+			return removed
+		}
+	}
+	if e := config.Emotes; e != nil && countEmotes(msg.Tags["emotes"]) > cmp.Or(e.Max, defaultMaxEmotes) {
+		if removed, done := d.warnThenTimeout(msg, u, "emotes", e.WarnThenTimeout, defaultEmotesWarning); done {
+			return removed
+		}
+	}
+
+	if l := config.Links; l != nil && containsLink(text, l.AllowedDomains) {
+		switch {
+		case l.Exempt != "" && hasPermission(u, l.Exempt):
+		case usePermit(msg.Channel(), u):
+			log.Printf("[#%s] %s used their link permit", msg.Channel(), u.Login)
+		default:
+			warning := l.Message
+			if warning == "" {
+				warning = defaultLinkWarning
+			}
+			return d.punish(msg, u, punishment{
+				Action:  l.Action,
+				Timeout: l.Timeout,
+				Reason:  "posting a link",
+				Warning: warning,
+			})
+		}
+	}
+	return false
+}
+
+// Whether text is long enough and mostly capitals
+func tooManyCaps(text string, c *CapsFilterConfig) bool {
+	if utf8.RuneCountInString(text) < cmp.Or(c.MinLength, defaultCapsMinLength) {
+		return false
+	}
+	letters, upper := 0, 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters > 0 && upper*100 > letters*cmp.Or(c.MaxPercent, defaultCapsMaxPercent)
+}
+
+// Emotes in a message from its emotes tag, e.g. "25:0-4,12-16/1902:6-10"
+// is three
+func countEmotes(tag string) int {
+	n := 0
+	for _, emote := range strings.Split(tag, "/") {
+		if _, positions, ok := strings.Cut(emote, ":"); ok {
+			n += strings.Count(positions, ",") + 1
+		}
+	}
+	return n
+}
+
+// Warn u for their first offense against filter this stream and time them
+// out for repeats. done is false when u is exempt, so other filters still
+// get a look at the message.
+func (d *Dispatcher) warnThenTimeout(msg Message, u ChatUser, filter string, w WarnThenTimeout, defaultWarning string) (removed, done bool) {
+	if w.Exempt != "" && hasPermission(u, w.Exempt) {
+		return false, false
+	}
+	warning := cmp.Or(w.Message, defaultWarning)
+	repeat := countOffense(msg.Channel(), filter, u) > 0
+	if w.DryRun {
+		action := "warn"
+		if repeat {
+			action = "time out"
+		}
+		log.Printf("[#%s] [dry run] %s filter would %s %s", msg.Channel(), filter, action, u.Login)
+		return false, true
+	}
+	if !repeat {
+		log.Printf("[#%s] %s filter: warning %s", msg.Channel(), filter, u.Login)
+		d.bot.Say(msg.Channel(), renderTemplate(warning, map[string]string{"user": u.Name(), "channel": msg.Channel()}))
+		return false, true
+	}
+	return d.punish(msg, u, punishment{Action: "timeout", Timeout: w.Timeout, Reason: filter + " filter"}), true
+}
+
+// Id of the first phrase text contains
+func (b *BannedPhrasesConfig) match(text string) (string, bool) {
+	text = cleanText(text)
+	lower := strings.ToLower(text)
+	for _, p := range b.compiled {
+		if p.Re != nil && p.Re.MatchString(text) || p.Re == nil && strings.Contains(lower, p.Text) {
+			return p.ID, true
+		}
+	}
+	return "", false
+}
+
+// Record an offense by u and return its timeout: each repeat in the same
+// stream gets the next duration in timeouts
+func nextPhraseTimeout(channel string, u ChatUser, timeouts []int) int {
+	if len(timeouts) == 0 {
+		timeouts = defaultPhraseTimeouts
+	}
+	n := countOffense(channel, "banned_phrases", u)
+	return timeouts[min(n, len(timeouts)-1)]
+}
+
+// Record an offense against filter by u, returning how many they had
+// already committed this stream, as far as the known stream start tells
+func countOffense(channel, filter string, u ChatUser) int {
+	start, err := knownStreamStart(channel)
+	key := channel + " " + filter
+
+	offensesMu.Lock()
+	defer offensesMu.Unlock()
+	o, ok := offenses[key]
+	if !ok || (err == nil && o.StreamStart != start) {
+		o = &streamOffenses{StreamStart: start, Counts: map[string]int{}}
+		offenses[key] = o
+	}
+	n := o.Counts[u.Key()]
+	o.Counts[u.Key()] = n + 1
+	return n
+}
+
+// Whether text links anywhere other than the allowed domains
+func containsLink(text string, allowed []string) bool {
+	for _, link := range linkPattern.FindAllString(text, -1) {
+		host := strings.ToLower(link)
+		if _, rest, ok := strings.Cut(host, "://"); ok {
+			host = rest
+		}
+		host, _, _ = strings.Cut(host, "/")
+		host = strings.TrimPrefix(host, "www.")
+		if !domainAllowed(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func domainAllowed(host string, allowed []string) bool {
+	for _, domain := range allowed {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "www."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Consume u's !permit in channel, if they have an unexpired one
+func usePermit(channel string, u ChatUser) bool {
+	permitsMu.Lock()
+	defer permitsMu.Unlock()
+	login := strings.ToLower(u.Login)
+	until, ok := permits[channel][login]
+	if ok {
+		delete(permits[channel], login)
+	}
+	return ok && time.Now().Before(until)
+}
+
+// Carry out p against the message's sender, returning whether the message
+// is being removed. The Helix calls are left to RunModeration so a spam
+// wave or a Helix outage can't hold up the IRC read loop.
+func (d *Dispatcher) punish(msg Message, u ChatUser, p punishment) bool {
+	channel := msg.Channel()
+	if p.Action == "" {
+		p.Action = "delete"
+	}
+	log.Printf("[#%s] %s: %s (%s)", channel, p.Action, u.Login, p.Reason)
+
+	if p.Action == "warn" || d.bot.ReadOnly {
+		if p.Action != "warn" {
+			log.Printf("[read-only] Would %s %s in #%s", p.Action, u.Login, channel)
+		}
+		d.postWarning(channel, u, p)
+		return p.Action != "warn"
+	}
+	select {
+	case d.punishments <- queuedPunishment{Msg: msg, User: u, Punishment: p, Queued: time.Now()}:
+		return true
+	default:
+		log.Printf("[#%s] %d punishments already queued, can't %s %s", channel, cap(d.punishments), p.Action, u.Login)
+		d.postWarning(channel, u, p)
+		return false
+	}
+}
+
+// Carry out queued punishments, punishWorkers at a time, until ctx is
+// cancelled
+func (d *Dispatcher) RunModeration(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range punishWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case q := <-d.punishments:
+					d.carryOut(q)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Delete the message and time out its sender as q says, then post the
+// warning. If Twitch refuses (no token with the moderator scopes, or the
+// bot isn't a mod) the warning is still posted.
+func (d *Dispatcher) carryOut(q queuedPunishment) {
+	channel, u, p := q.Msg.Channel(), q.User, q.Punishment
+	if waited := time.Since(q.Queued); waited > punishDeadline {
+		log.Printf("[#%s] Not going to %s %s, queued %s ago", channel, p.Action, u.Login, waited.Round(time.Second))
+		return
+	}
+
+	// delete first so the message goes even if the timeout fails
+	err := deleteChatMessage(channel, q.Msg.Tags["room-id"], q.Msg.Tags["id"])
+	if p.Action == "timeout" {
+		timeout := p.Timeout
+		if timeout == 0 {
+			timeout = defaultFilterTimeout
+		}
+		if terr := timeoutUser(channel, q.Msg.Tags["room-id"], u.UserID, timeout, p.Reason); terr != nil {
+			log.Printf("[#%s] Couldn't time out %s: %v", channel, u.Login, terr)
+		} else {
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Printf("[#%s] Couldn't %s %s: %v", channel, p.Action, u.Login, err)
+	}
+	d.postWarning(channel, u, p)
+}
+
+func (d *Dispatcher) postWarning(channel string, u ChatUser, p punishment) {
+	if p.Warning != "" {
+		d.bot.Say(channel, renderTemplate(p.Warning, map[string]string{"user": u.Name(), "channel": channel}))
+	}
+}
+
+// ---------- Helix ----------
+
+func deleteChatMessage(channel, broadcasterID, messageID string) error {
+	if broadcasterID == "" || messageID == "" {
+		return fmt.Errorf("message has no room-id or id tag")
+	}
+	token, err := userTokens.For(channel, manageChatMessages)
+	if err != nil {
+		return err
+	}
+	path := "moderation/chat?broadcaster_id=" + url.QueryEscape(broadcasterID) +
+		"&moderator_id=" + url.QueryEscape(token.UserID) + "&message_id=" + url.QueryEscape(messageID)
+	return helixAs(token, "DELETE", path, nil, nil)
+}
+
+func timeoutUser(channel, broadcasterID, userID string, seconds int, reason string) error {
+	if broadcasterID == "" || userID == "" {
+		return fmt.Errorf("message has no room-id or user-id tag")
+	}
+	token, err := userTokens.For(channel, manageBannedUsers)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"data": map[string]any{"user_id": userID, "duration": seconds, "reason": reason}}
+	path := "moderation/bans?broadcaster_id=" + url.QueryEscape(broadcasterID) + "&moderator_id=" + url.QueryEscape(token.UserID)
+	return helixAs(token, "POST", path, body, nil)
+}
+
+// ---------- !permit ----------
+func init() {
+	registerBuiltin("permit", "permit", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) < 1 {
+			c.Reply(fmt.Sprintf("Usage: %spermit <user>", d.Config().Prefix))
+			return
+		}
+		login := strings.ToLower(strings.TrimPrefix(c.Args[0], "@"))
+
+		permitsMu.Lock()
+		if permits[c.Channel] == nil {
+			permits[c.Channel] = map[string]time.Time{}
+		}
+		now := time.Now()
+		for l, until := range permits[c.Channel] {
+			if now.After(until) {
+				delete(permits[c.Channel], l)
+			}
+		}
+		permits[c.Channel][login] = now.Add(permitDuration)
+		permitsMu.Unlock()
+
+		d.bot.Say(c.Channel, fmt.Sprintf("%s may post one link in the next %d seconds.", login, int(permitDuration.Seconds())))
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPunishLeavesHelixToTheWorkers(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	b.setConn(&ircConn{})
+	phrases := &BannedPhrasesConfig{Phrases: []BannedPhrase{{ID: "spam", Text: "buy followers"}}, Message: "{user}, no."}
+	validateModeration(&ModerationConfig{BannedPhrases: phrases})
+	msg, _ := parseMessage("@id=m1;room-id=100;user-id=1 :alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :buy followers here")
+	alice := ChatUser{Login: "alice", UserID: "1"}
+
+	tests := []struct {
+		name     string
+		queue    int // room for punishments
+		queued   int // already waiting
+		removed  bool
+		warnings int // posted straight away
+	}{
+		{"queued", 4, 0, true, 0},
+		{"queue full", 1, 1, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeHelix(t, "streamer", 200, `{"data": []}`)
+			t.Cleanup(func() {
+				offensesMu.Lock()
+				clear(offenses)
+				offensesMu.Unlock()
+			})
+			d := &Dispatcher{bot: b, config: &BotConfig{Moderation: ModerationConfig{BannedPhrases: phrases}}, punishments: make(chan queuedPunishment, tt.queue)}
+			for range tt.queued {
+				d.punishments <- queuedPunishment{}
+			}
+
+			if removed := d.moderate(msg, alice, msg.Trailing); removed != tt.removed {
+				t.Errorf("moderate = %v, want %v", removed, tt.removed)
+			}
+			if n := len(queuedChat()); n != tt.warnings {
+				t.Errorf("%d warnings posted, want %d", n, tt.warnings)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests to Helix from the read loop", n)
+			}
+			if tt.removed {
+				q := <-d.punishments
+				if q.User.Key() != alice.Key() || q.Punishment.Action != "timeout" || q.Punishment.Timeout != defaultPhraseTimeouts[0] {
+					t.Errorf("queued %+v", q)
+				}
+			}
+		})
+	}
+}
+
+func TestCarryOutDropsStalePunishments(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	b.setConn(&ircConn{})
+	requests := fakeHelix(t, "streamer", 204, "")
+	msg, _ := parseMessage("@id=m1;room-id=100;user-id=1 :alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :buy followers")
+
+	d := &Dispatcher{bot: b}
+	d.carryOut(queuedPunishment{
+		Msg:        msg,
+		User:       ChatUser{Login: "alice", UserID: "1"},
+		Punishment: punishment{Action: "timeout", Warning: "{user}, no."},
+		Queued:     time.Now().Add(-punishDeadline - time.Second),
+	})
+	if n, warnings := requests.Load(), len(queuedChat()); n != 0 || warnings != 0 {
+		t.Errorf("stale punishment made %d requests and posted %d warnings", n, warnings)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ---------- !commands ----------
+func init() {
+	registerBuiltin("commands", "commands", 10, "", func(d *Dispatcher, c *CommandContext) {
+		list := visibleCommands(d.Config(), c.Sender)
+		if len(list) == 0 {
+			c.Reply("There are no commands you can use.")
+			return
+		}
+		// long lists are split across messages by sendPrivmsg
+		c.Reply(fmt.Sprintf("Commands: %s", strings.Join(list, ", ")))
+	})
+}
+
+// Triggers the user may run, sorted. Hidden and pattern commands are left
+// out, and disabled ones are only shown to mods, marked as such.
+func visibleCommands(config *BotConfig, u ChatUser) []string {
+	var list []string
+	for key, cfg := range config.Commands {
+		if cfg.Hidden || isPatternMatch(cfg.Match) || !hasPermission(u, requiredPermission(cfg)) {
+			continue
+		}
+		name := key
+		if !cfg.NoPrefix {
+			name = config.Prefix + key
+		}
+		if !cfg.IsEnabled() {
+			if !hasPermission(u, "moderator") {
+				continue
+			}
+			name += " (disabled)"
+		}
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
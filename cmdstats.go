@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+const (
+	commandStatsFile = "command_stats.json"
+	cmdStatsTop      = 5
+)
+
+// Command usage counts, opened in main
+var commandStats *CommandStats
+
+// ---------- Types ----------
+
+// Uses of each command in one channel, this stream and overall
+type channelCommandStats struct {
+	StreamStart int64          `json:"streamStart"`
+	Stream      map[string]int `json:"stream"`
+	Total       map[string]int `json:"total"`
+}
+
+// JSON file of command usage by channel
+type CommandStats struct {
+	mu       sync.Mutex
+	path     string
+	channels map[string]*channelCommandStats
+}
+
+func NewCommandStats(path string) *CommandStats {
+	s := &CommandStats{path: path, channels: make(map[string]*channelCommandStats)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.channels); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// ---------- Recording ----------
+
+// Count a command that fired, starting the per-stream counts over when a
+// new stream began
+func (s *CommandStats) Record(channel, command string) {
+	start, err := CachedStreamStart(channel)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.forStream(channel, start, err)
+	stats.Stream[command]++
+	stats.Total[command]++
+
+	data, err := json.MarshalIndent(s.channels, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+}
+
+// The channel's counts, the stream ones started over unless startErr says
+// Helix couldn't tell whether the stream changed. Caller holds s.mu.
+func (s *CommandStats) forStream(channel string, start int64, startErr error) *channelCommandStats {
+	stats, ok := s.channels[channel]
+	if !ok {
+		stats = &channelCommandStats{Total: map[string]int{}}
+		s.channels[channel] = stats
+	}
+	if stats.Stream == nil || (startErr == nil && stats.StreamStart != start) {
+		stats.StreamStart = start
+		stats.Stream = map[string]int{}
+	}
+	if stats.Total == nil {
+		stats.Total = map[string]int{}
+	}
+	return stats
+}
+
+// Most used commands this stream and overall, as "!rank 12, !elo 5"
+func (s *CommandStats) Top(channel, prefix string, n int) (string, string) {
+	start, err := CachedStreamStart(channel)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.forStream(channel, start, err)
+	return topCounts(stats.Stream, prefix, n), topCounts(stats.Total, prefix, n)
+}
+
+func topCounts(counts map[string]int, prefix string, n int) string {
+	commands := make([]string, 0, len(counts))
+	for command := range counts {
+		commands = append(commands, command)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if counts[commands[i]] != counts[commands[j]] {
+			return counts[commands[i]] > counts[commands[j]]
+		}
+		return commands[i] < commands[j]
+	})
+	if len(commands) > n {
+		commands = commands[:n]
+	}
+	if len(commands) == 0 {
+		return "nothing yet"
+	}
+
+	parts := make([]string, len(commands))
+	for i, command := range commands {
+		parts[i] = fmt.Sprintf("%s%s %d", prefix, command, counts[command])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ---------- !cmdstats ----------
+func init() {
+	registerBuiltin("cmdstats", "cmdstats", 10, "broadcaster", func(d *Dispatcher, c *CommandContext) {
+		stream, total := commandStats.Top(c.Channel, d.Config().Prefix, cmdStatsTop)
+		c.Reply(fmt.Sprintf("This stream: %s | All time: %s", stream, total))
+	})
+}
@@ -0,0 +1,862 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ---------- Types ----------
+type CommandConfig struct {
+	Type           string            `json:"type"`
+	Response       Responses         `json:"response,omitempty"`
+	Endpoint       string            `json:"endpoint,omitempty"`
+	Cooldown       int               `json:"cooldown"`
+	ReplyMode      string            `json:"reply_mode,omitempty"`      // "thread", "mention" or "plain"
+	RespondVia     string            `json:"respond_via,omitempty"`     // "whisper" to answer privately instead of in chat
+	Action         bool              `json:"action,omitempty"`          // respond as a /me action
+	TargetChannel  string            `json:"target_channel,omitempty"`  // post the response in another joined channel
+	Match          string            `json:"match,omitempty"`           // "exact", or "regex"/"contains" to match Pattern anywhere in a message
+	Pattern        string            `json:"pattern,omitempty"`         // regular expression or text for match "regex"/"contains"
+	Permission     string            `json:"permission,omitempty"`      // minimum level, see permissionLevels
+	DenyMessage    string            `json:"deny_message,omitempty"`    // sent to users below Permission instead of ignoring them
+	NoPrefix       bool              `json:"no_prefix,omitempty"`       // keyword trigger matched without the command prefix
+	Enabled        *bool             `json:"enabled,omitempty"`         // false to keep the command in the file but ignore it
+	Hidden         bool              `json:"hidden,omitempty"`          // left out of !commands
+	CooldownGroup  string            `json:"cooldown_group,omitempty"`  // commands in a group share one cooldown, the longest of theirs
+	CooldownExempt string            `json:"cooldown_exempt,omitempty"` // level that skips the cooldown, or "none"; see cooldownExempt
+	OnlineOnly     *bool             `json:"online_only,omitempty"`     // only run while the stream is live; defaults to ONLINE_ONLY
+	OfflineMessage string            `json:"offline_message,omitempty"` // sent instead when online-only and offline; defaults to OFFLINE_MESSAGE
+	URL            string            `json:"url,omitempty"`             // http commands: {args} and {user} are filled in
+	Headers        map[string]string `json:"headers,omitempty"`         // http commands: extra request headers
+	JSONPath       string            `json:"json_path,omitempty"`       // http commands: field to extract, e.g. "data.0.title"
+	Command        []string          `json:"command,omitempty"`         // exec commands: program and arguments, run without a shell
+	Timeout        int               `json:"timeout,omitempty"`         // exec commands: seconds before the program is killed
+}
+
+// Commands are enabled unless they say "enabled": false
+func (c CommandConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// Whether the command only runs while live, from the command or ONLINE_ONLY=1
+func (c CommandConfig) IsOnlineOnly() bool {
+	if c.OnlineOnly != nil {
+		return *c.OnlineOnly
+	}
+	return os.Getenv("ONLINE_ONLY") == "1"
+}
+
+// A command's "response": one string, or an array to pick from at random
+type Responses []string
+
+func (r *Responses) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*r = Responses{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("response must be a string or an array of strings")
+	}
+	*r = many
+	return nil
+}
+
+// Written back as a plain string when there's only one
+func (r Responses) MarshalJSON() ([]byte, error) {
+	if len(r) == 1 {
+		return json.Marshal(r[0])
+	}
+	return json.Marshal([]string(r))
+}
+
+// Built-in command implemented in Go. It appears in the command map as
+// {"type": "builtin", "endpoint": <name>} and commands.json may override
+// its trigger or cooldown with an entry of that shape.
+type builtinCommand struct {
+	Trigger string // without the command prefix
+	Config  CommandConfig
+	Handler func(d *Dispatcher, c *CommandContext)
+}
+
+// Everything a command handler needs to know about one invocation
+type CommandContext struct {
+	Msg     Message
+	Sender  ChatUser
+	Channel string
+	Command string
+	Args    []string // words after the trigger, as typed
+	Config  CommandConfig
+	reply   func(string)
+}
+
+// Answer the user in the command's reply mode
+func (c *CommandContext) Reply(text string) {
+	c.reply(text)
+}
+
+// Built-ins by endpoint name, filled by registerBuiltin in init functions
+var builtinCommands = map[string]builtinCommand{}
+
+func registerBuiltin(trigger, name string, cooldown int, permission string, handler func(d *Dispatcher, c *CommandContext)) {
+	builtinCommands[name] = builtinCommand{
+		Trigger: trigger,
+		Config:  CommandConfig{Type: "builtin", Endpoint: name, Cooldown: cooldown, Permission: permission},
+		Handler: handler,
+	}
+}
+
+// Matches chat messages against commands.json and runs them
+type Dispatcher struct {
+	bot    *Bot
+	riot   RiotClient
+	twitch TwitchClient
+
+	mu       sync.Mutex    // guards config, accounts and lastUsed, config may be swapped by a reload
+	accounts []RiotAccount // the streamer's League accounts, the main one first
+	config   *BotConfig
+	lastUsed map[string]time.Time // keyed by "<channel> <cooldown bucket>"
+	lastPick map[string]int       // index of the response last picked, same keys
+
+	punishments chan queuedPunishment // see RunModeration
+}
+
+func NewDispatcher(bot *Bot, riot RiotClient, twitch TwitchClient, accounts []RiotAccount, config *BotConfig) *Dispatcher {
+	return &Dispatcher{
+		bot:      bot,
+		riot:     riot,
+		twitch:   twitch,
+		accounts: accounts,
+		config:   config,
+		lastUsed: make(map[string]time.Time),
+		lastPick: make(map[string]int),
+
+		punishments: make(chan queuedPunishment, punishQueueSize),
+	}
+}
+
+// Current configuration; treat it as read-only
+func (d *Dispatcher) Config() *BotConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.config
+}
+
+// The streamer's accounts, the main one first; treat it as read-only
+func (d *Dispatcher) Accounts() []RiotAccount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.accounts
+}
+
+// Replace the account with p's PUUID by a copy with p's Riot ID and summoner
+func (d *Dispatcher) updateAccount(p PlayerCacheEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	accounts := slices.Clone(d.accounts)
+	for i := range accounts {
+		if accounts[i].PUUID == p.PUUID {
+			accounts[i].GameName, accounts[i].TagLine, accounts[i].SummonerID = p.GameName, p.TagLine, p.SummonerID
+		}
+	}
+	d.accounts = accounts
+}
+
+// Swap in a new configuration, keeping cooldowns of commands and groups
+// that still exist
+func (d *Dispatcher) SetConfig(config *BotConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.config = config
+	for key := range d.lastUsed {
+		_, bucket, _ := strings.Cut(key, " ")
+		if !config.hasCooldownBucket(bucket) {
+			delete(d.lastUsed, key)
+		}
+	}
+	// the response lists may have changed
+	clear(d.lastPick)
+}
+
+// ---------- Loading ----------
+
+// Top-level commands.json keys that hold settings rather than a command
+const (
+	eventsSection     = "events"
+	timersSection     = "timers"
+	greetingsSection  = "greetings"
+	moderationSection = "moderation"
+	triviaSection     = "trivia"
+)
+
+func isSection(key string) bool {
+	return key == eventsSection || key == timersSection || key == greetingsSection || key == moderationSection || key == triviaSection
+}
+
+const defaultPrefix = "!"
+
+// Everything loaded from commands.json
+type BotConfig struct {
+	Prefix     string                   // COMMAND_PREFIX, "!" by default
+	Commands   map[string]CommandConfig // keyed without the prefix
+	Events     map[string]EventConfig
+	Timers     map[string]TimerConfig
+	Greetings  *GreetingConfig // nil unless configured, greetings are off by default
+	Moderation ModerationConfig
+	Trivia     TriviaConfig
+
+	hasKeywords    bool             // whether any command is no_prefix
+	patterns       []patternCommand // regex/contains commands, tried last
+	groupCooldowns map[string]int   // longest cooldown in each cooldown_group
+}
+
+const cooldownGroupPrefix = "group:"
+
+// Cooldown bucket and length for a command: its cooldown_group when it is
+// in one, otherwise the command itself
+func (c *BotConfig) cooldown(command string, cfg CommandConfig) (string, time.Duration) {
+	if cfg.CooldownGroup != "" {
+		return cooldownGroupPrefix + cfg.CooldownGroup, time.Duration(c.groupCooldowns[cfg.CooldownGroup]) * time.Second
+	}
+	return command, time.Duration(cfg.Cooldown) * time.Second
+}
+
+func (c *BotConfig) hasCooldownBucket(bucket string) bool {
+	if group, ok := strings.CutPrefix(bucket, cooldownGroupPrefix); ok {
+		_, exists := c.groupCooldowns[group]
+		return exists
+	}
+	_, exists := c.Commands[bucket]
+	return exists
+}
+
+// Command name for a trigger as written in commands.json or typed in chat,
+// with or without the prefix
+func (c *BotConfig) commandName(trigger string) string {
+	return strings.TrimPrefix(normalizeCommand(trigger), c.Prefix)
+}
+
+// The command running the named builtin, under whatever trigger it has
+func (c *BotConfig) builtin(name string) (string, CommandConfig, bool) {
+	for trigger, cfg := range c.Commands {
+		if cfg.Type == "builtin" && cfg.Endpoint == name {
+			return trigger, cfg, true
+		}
+	}
+	return "", CommandConfig{}, false
+}
+
+func loadConfig(path string) (*BotConfig, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return parseConfig(path, file)
+}
+
+// Parse and validate the contents of commands.json; path is only used in errors
+func parseConfig(path string, file []byte) (*BotConfig, error) {
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(file, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, describeJSONError(file, err))
+	}
+	var problems []string
+
+	config := &BotConfig{
+		Prefix:   os.Getenv("COMMAND_PREFIX"),
+		Commands: make(map[string]CommandConfig),
+		Events:   make(map[string]EventConfig),
+		Timers:   make(map[string]TimerConfig),
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultPrefix
+	}
+	if events, ok := raw[eventsSection]; ok {
+		if err := json.Unmarshal(events, &config.Events); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", eventsSection, err))
+		}
+		delete(raw, eventsSection)
+	}
+	if timers, ok := raw[timersSection]; ok {
+		if err := json.Unmarshal(timers, &config.Timers); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", timersSection, err))
+		}
+		delete(raw, timersSection)
+	}
+	if greetings, ok := raw[greetingsSection]; ok {
+		config.Greetings = &GreetingConfig{}
+		if err := decodeStrict(greetings, config.Greetings); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", greetingsSection, err))
+		} else {
+			problems = append(problems, validateGreetings(config.Greetings)...)
+		}
+		delete(raw, greetingsSection)
+	}
+	if moderation, ok := raw[moderationSection]; ok {
+		if err := decodeStrict(moderation, &config.Moderation); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", moderationSection, err))
+		} else {
+			problems = append(problems, validateModeration(&config.Moderation)...)
+		}
+		delete(raw, moderationSection)
+	}
+	if trivia, ok := raw[triviaSection]; ok {
+		if err := decodeStrict(trivia, &config.Trivia); err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", triviaSection, err))
+		} else {
+			problems = append(problems, validateTrivia(&config.Trivia)...)
+		}
+		delete(raw, triviaSection)
+	}
+
+	for k, v := range raw {
+		var cmd CommandConfig
+		if err := decodeCommand(v, &cmd); err != nil {
+			problems = append(problems, fmt.Sprintf("command %q: %v", k, err))
+			continue
+		}
+		problems = append(problems, validateCommand(k, cmd)...)
+		if cmd.NoPrefix {
+			config.Commands[normalizeCommand(k)] = cmd
+			config.hasKeywords = true
+		} else {
+			config.Commands[config.commandName(k)] = cmd
+		}
+	}
+
+	addBuiltins(config.Commands)
+	config.groupCooldowns = make(map[string]int)
+	for _, cmd := range config.Commands {
+		if cmd.CooldownGroup != "" {
+			config.groupCooldowns[cmd.CooldownGroup] = max(config.groupCooldowns[cmd.CooldownGroup], cmd.Cooldown)
+		}
+	}
+	problems = append(problems, compilePatterns(config)...)
+	problems = append(problems, validateTimers(config.Timers)...)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, &ConfigError{Path: path, Problems: problems}
+	}
+
+	fmt.Println("Loaded commands:")
+	for k, cmd := range config.Commands {
+		if !cmd.NoPrefix {
+			k = config.Prefix + k
+		}
+		fmt.Printf("[%q]\n", k)
+	}
+
+	return config, nil
+}
+
+// NFC + lowercase + trim spaces + remove invisible characters, so "!señor"
+// matches however the viewer's client composed the ñ
+func normalizeCommand(s string) string {
+	return strings.ToLower(strings.TrimSpace(cleanText(s)))
+}
+
+// NFC-normalize chat text and drop the zero-width characters clients insert,
+// such as the tag space some add to get around Twitch's duplicate message check
+func cleanText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\u00ad', '\u200b', '\u200c', '\u200e', '\u200f', '\u2060', '\ufeff', '\U000e0000':
+			return -1
+		}
+		return r
+	}, norm.NFC.String(s))
+}
+
+// Add every built-in under its default trigger unless commands.json
+// already configures it, under that trigger or another one
+func addBuiltins(commands map[string]CommandConfig) {
+	configured := map[string]bool{}
+	for _, cfg := range commands {
+		if cfg.Type == "builtin" {
+			configured[cfg.Endpoint] = true
+		}
+	}
+	for name, b := range builtinCommands {
+		if _, taken := commands[b.Trigger]; !configured[name] && !taken {
+			commands[b.Trigger] = b.Config
+		}
+	}
+}
+
+// ---------- Dispatch ----------
+
+// Find the command a chat message triggers. Only messages starting with the
+// prefix are considered, apart from no_prefix keyword commands and, when
+// nothing else matched, regex/contains pattern commands. The whole
+// message is tried first so multi-word triggers keep working, then just its
+// first word with the rest as arguments unless that command is match
+// "exact". "!deaths+" style modifiers of counter commands arrive as a
+// leading "+" or "-" argument.
+func (c *BotConfig) lookup(msg string) (string, CommandConfig, []string, bool) {
+	msg = strings.TrimSpace(cleanText(msg))
+	if rest, ok := strings.CutPrefix(msg, c.Prefix); ok {
+		if command, cfg, args, ok := c.match(rest, false); ok {
+			return command, cfg, args, true
+		}
+	} else if c.hasKeywords {
+		if command, cfg, args, ok := c.match(msg, true); ok {
+			return command, cfg, args, true
+		}
+	}
+	return c.matchPattern(msg)
+}
+
+// Look up text among the prefixed commands, or the no_prefix ones
+func (c *BotConfig) match(text string, keyword bool) (string, CommandConfig, []string, bool) {
+	if cfg, ok := c.Commands[normalizeCommand(text)]; ok && cfg.NoPrefix == keyword && !isPatternMatch(cfg.Match) {
+		return normalizeCommand(text), cfg, nil, true
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", CommandConfig{}, nil, false
+	}
+	command, args := normalizeCommand(fields[0]), fields[1:]
+	if base, suffix, ok := counterModifier(c.Commands, command); ok {
+		command, args = base, append([]string{suffix}, args...)
+	} else if len(args) == 0 {
+		return "", CommandConfig{}, nil, false
+	}
+	cfg, ok := c.Commands[command]
+	if !ok || cfg.NoPrefix != keyword || cfg.Match != "" {
+		return "", CommandConfig{}, nil, false
+	}
+	return command, cfg, args, true
+}
+
+// Template variables for the message's arguments: {args} and {1}, {2}, ...
+func argVars(vars map[string]string, args []string) map[string]string {
+	vars["args"] = strings.Join(args, " ")
+	for i, a := range args {
+		vars[strconv.Itoa(i+1)] = a
+	}
+	return vars
+}
+
+// OnMessage handler running the command a chat message triggers, if any
+func (d *Dispatcher) HandleMessage(ircMsg Message) {
+	sender := newChatUser(ircMsg.Nick(), ircMsg.Tags)
+	if ignoredUsers[strings.ToLower(sender.Login)] {
+		return
+	}
+	channel := ircMsg.Channel()
+	// "/me !rank" arrives wrapped in ACTION framing
+	msg, _ := stripAction(ircMsg.Trailing)
+	// a message a filter removed does nothing else
+	if d.moderate(ircMsg, sender, msg) || isBlocked(sender) {
+		return
+	}
+	d.claimFirstChat(channel, sender)
+	d.greet(ircMsg, sender)
+	d.returnFromLurk(ircMsg, sender, msg)
+	if enterRaffle(channel, sender, msg) || castVote(channel, sender, msg) || d.answerTrivia(channel, sender, msg) {
+		return
+	}
+	d.mu.Lock()
+	command, cfg, args, ok := d.config.lookup(msg)
+	if !ok || !cfg.IsEnabled() {
+		d.mu.Unlock()
+		return
+	}
+	reply := func(text string) {
+		d.respond(ircMsg, sender, cfg, text)
+	}
+	ctx := &CommandContext{
+		Msg:     ircMsg,
+		Sender:  sender,
+		Channel: channel,
+		Command: command,
+		Args:    args,
+		Config:  cfg,
+		reply:   reply,
+	}
+
+	// cooldowns are tracked separately for each channel
+	bucket, cooldown := d.config.cooldown(command, cfg)
+	cooldownKey := channel + " " + bucket
+	if t, ok := d.lastUsed[cooldownKey]; ok && !cooldownExempt(sender, cfg) {
+		if time.Since(t) < cooldown {
+			d.mu.Unlock()
+			return
+		}
+	}
+	d.mu.Unlock()
+
+	if !hasPermission(sender, requiredPermission(cfg)) {
+		if cfg.DenyMessage != "" {
+			reply(renderTemplate(cfg.DenyMessage, map[string]string{"user": sender.Name(), "channel": channel}))
+		}
+		return
+	}
+	// mods can still try online-only commands while offline
+	if cfg.IsOnlineOnly() && !hasPermission(sender, "moderator") && !streamIsLive(channel) {
+		msg := cfg.OfflineMessage
+		if msg == "" {
+			msg = os.Getenv("OFFLINE_MESSAGE")
+		}
+		if msg != "" {
+			reply(renderTemplate(msg, map[string]string{"user": sender.Name(), "channel": channel}))
+		}
+		return
+	}
+	// only a command that's about to run counts against the user's budget
+	if !userLimits.Allow(sender) {
+		return
+	}
+
+	switch cfg.Type {
+	case "static":
+		reply(renderLazy(d.pickResponse(ctx), argVars(map[string]string{
+			"user":    sender.Name(),
+			"channel": channel,
+		}, args), streamVars(channel)))
+	case "builtin":
+		b, ok := builtinCommands[cfg.Endpoint]
+		if !ok {
+			log.Printf("Unknown builtin %q for %s", cfg.Endpoint, command)
+			return
+		}
+		b.Handler(d, ctx)
+	case "counter":
+		d.runCounter(ctx)
+	case "http":
+		d.runHTTP(ctx)
+	case "exec":
+		d.runExec(ctx)
+	case "api":
+		d.runAPI(ctx)
+	}
+
+	d.mu.Lock()
+	d.lastUsed[cooldownKey] = time.Now()
+	d.mu.Unlock()
+	commandStats.Record(channel, command)
+}
+
+// Endpoints runAPI handles, for validating commands.json
+var apiEndpoints = map[string]bool{
+	"twitch_stream_info":    true,
+	"riot_rank_info":        true,
+	"stream_stats_info":     true,
+	"stream_kda_info":       true,
+	"stream_champs_info":    true,
+	"moderation_stats_info": true,
+	"current_bans_info":     true,
+	"live_game_info":        true,
+	"last_match_info":       true,
+	"streak_info":           true,
+	"game_time_info":        true,
+	"live_opponents_info":   true,
+	"opgg_link_info":        true,
+	"ugg_link_info":         true,
+	"tft_rank_info":         true,
+	"tft_stream_stats_info": true,
+}
+
+// Run an "api" command; c.Args holds any words after the trigger
+func (d *Dispatcher) runAPI(c *CommandContext) {
+	switch c.Config.Endpoint {
+	case "twitch_stream_info":
+		title, game, err := d.twitch.GetTwitchStreamInfo(c.Channel)
+		if err != nil {
+			c.Reply("Error fetching stream info.")
+		} else if title == "Offline" {
+			c.Reply("Stream is offline.")
+		} else {
+			c.Reply(fmt.Sprintf("Title: %s | Game: %s", title, game))
+		}
+	case "riot_rank_info":
+		d.rankReply(c)
+	case "stream_stats_info":
+		start, err := d.twitch.GetTwitchStreamStart(c.Channel)
+		if err != nil {
+			c.Reply("Error fetching stream info.")
+			return
+		}
+		queue, ok := queueArg(c)
+		if !ok {
+			return
+		}
+		stats, err := d.riot.GetStreamStats(d.Accounts(), start, queue)
+		if err != nil {
+			c.Reply("Error Fetching stream stats.")
+			return
+		}
+		reply := fmt.Sprintf("%s | Wins: %d | Loss: %d | Winrate: %.2f%%", queueName(queue), stats.Wins, stats.Losses, stats.Winrate)
+		if stats.Remakes > 0 {
+			reply += ", " + plural(stats.Remakes, "remake", "remakes")
+		}
+		// LP only moves in ranked
+		if lp := describeStreamLP(stats); lp != "" && (queue == allQueues || queue == soloQueueID || queue == flexQueueID) {
+			reply += " | " + lp
+		}
+		c.Reply(reply)
+	case "stream_kda_info":
+		start, err := d.twitch.GetTwitchStreamStart(c.Channel)
+		if err != nil {
+			c.Reply("Error fetching stream info.")
+			return
+		}
+		queue, ok := queueArg(c)
+		if !ok {
+			return
+		}
+		stats, err := d.riot.GetStreamStats(d.Accounts(), start, queue)
+		if err != nil {
+			c.Reply("Error Fetching stream stats.")
+			return
+		}
+		c.Reply(fmt.Sprintf("%s | %s", queueName(queue), describeKDA(stats)))
+	case "stream_champs_info":
+		start, err := d.twitch.GetTwitchStreamStart(c.Channel)
+		if err != nil {
+			c.Reply("Error fetching stream info.")
+			return
+		}
+		queue, ok := queueArg(c)
+		if !ok {
+			return
+		}
+		stats, err := d.riot.GetStreamStats(d.Accounts(), start, queue)
+		if err != nil {
+			c.Reply("Error Fetching stream stats.")
+			return
+		}
+		c.Reply(fmt.Sprintf("%s | %s", queueName(queue), describeChampions(stats, streamChampsShown)))
+	case "moderation_stats_info":
+		c.Reply(fmt.Sprintf("This stream: %s", GetModerationStats(c.Channel)))
+	case "current_bans_info":
+		bans, err := d.riot.GetActiveMatchBans(d.Accounts())
+		if err != nil {
+			c.Reply("Not in an Active Match")
+		} else {
+			banString := strings.Join(bans, ", ")
+			c.Reply(fmt.Sprintf("Banned Champions: %s", banString))
+		}
+	case "live_game_info":
+		game, puuid, err := d.riot.GetLiveGame(d.Accounts())
+		if err != nil || game == nil {
+			c.Reply("Not in an Active Match")
+		} else {
+			c.Reply(describeLiveGame(game, puuid))
+		}
+	case "live_opponents_info":
+		accounts := d.Accounts()
+		game, puuid, err := d.riot.GetLiveGame(accounts)
+		if err != nil || game == nil {
+			c.Reply("Not in an Active Match")
+			return
+		}
+		playing := accounts[max(slices.IndexFunc(accounts, func(a RiotAccount) bool { return a.PUUID == puuid }), 0)]
+		c.Reply("Enemy team: " + strings.Join(d.riot.GetOpponentRanks(game, playing), ", "))
+	case "game_time_info":
+		game, _, err := d.riot.GetLiveGame(d.Accounts())
+		if err != nil || game == nil {
+			c.Reply("Not in an Active Match")
+		} else {
+			c.Reply(describeGameTime(game))
+		}
+	case "last_match_info":
+		match, player, err := d.riot.GetLastMatch(d.Accounts())
+		if err != nil {
+			log.Printf("Last match error: %v", err)
+			c.Reply("Error fetching the last game.")
+		} else if match == nil {
+			c.Reply("No recent games found.")
+		} else {
+			c.Reply(describeMatch(match, player))
+		}
+	case "streak_info":
+		wins, err := d.riot.GetRecentResults(d.Accounts()[0])
+		if err != nil {
+			log.Printf("Streak error: %v", err)
+			c.Reply("Error fetching recent games.")
+		} else {
+			c.Reply(describeStreak(wins))
+		}
+	case "opgg_link_info":
+		d.profileLinkReply(c, opggURL)
+	case "ugg_link_info":
+		d.profileLinkReply(c, uggURL)
+	case "tft_rank_info":
+		d.tftRankReply(c)
+	case "tft_stream_stats_info":
+		start, err := d.twitch.GetTwitchStreamStart(c.Channel)
+		if err != nil {
+			c.Reply("Error fetching stream info.")
+			return
+		}
+		stats, err := d.riot.GetTFTStreamStats(d.Accounts(), start)
+		if err != nil {
+			log.Printf("TFT stream stats error: %v", err)
+			c.Reply("Error Fetching stream stats.")
+			return
+		}
+		c.Reply(describeTFTStats(stats))
+	default:
+		log.Printf("Unknown api endpoint %q for %s", c.Config.Endpoint, c.Command)
+	}
+}
+
+// Champions stream_champs_info lists, most played first
+const streamChampsShown = 5
+
+// The queue named after a stream stats command ("!winrate aram", "!winrate
+// all"), STATS_QUEUE without one. Replies and returns false for an unknown
+// one.
+func queueArg(c *CommandContext) (int, bool) {
+	if len(c.Args) == 0 {
+		return statsQueue, true
+	}
+	queue, ok := parseQueue(c.Args[0])
+	if !ok {
+		c.Reply(fmt.Sprintf("Unknown queue %q, try solo, flex, aram, normal, arena or all.", c.Args[0]))
+	}
+	return queue, ok
+}
+
+// riot_rank_info: solo queue rank by default, or "!rank flex", "!rank 2"
+// for the second account and "!rank points" for the points leaderboard
+func (d *Dispatcher) rankReply(c *CommandContext) {
+	accounts := d.Accounts()
+	account := accounts[0]
+	queue := soloQueue
+	for _, arg := range c.Args {
+		if strings.EqualFold(arg, "points") {
+			pointsRankReply(c)
+			return
+		}
+		if strings.EqualFold(arg, "flex") {
+			queue = flexQueue
+			continue
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 || n > len(accounts) {
+			c.Reply(fmt.Sprintf("Usage: %srank [flex] [account 1-%d]", d.Config().Prefix, len(accounts)))
+			return
+		}
+		account = accounts[n-1]
+	}
+
+	ranks, err := d.riot.GetCurrentRank(account)
+	if err != nil {
+		log.Printf("Rank error: %v", err)
+		c.Reply("Error fetching rank.")
+		return
+	}
+	label := "Current Rank"
+	if len(accounts) > 1 {
+		label = account.String()
+	}
+	entry, ok := pickRank(ranks, queue)
+	switch {
+	case !ok && queue == flexQueue:
+		c.Reply(fmt.Sprintf("%s: Unranked in flex this season", label))
+	case !ok:
+		c.Reply(fmt.Sprintf("%s: Unranked this season", label))
+	case entry.QueueType == flexQueue:
+		c.Reply(fmt.Sprintf("%s (Flex): %s %s %d", label, entry.Tier, entry.Rank, entry.LeaguePoints))
+	default:
+		c.Reply(fmt.Sprintf("%s: %s %s %d", label, entry.Tier, entry.Rank, entry.LeaguePoints))
+	}
+}
+
+// Profile links for every account, or for the Riot ID after the command
+// ("!opgg Name#Tag"), which is assumed to be on RIOT_PLATFORM
+func (d *Dispatcher) profileLinkReply(c *CommandContext, link func(RiotAccount) string) {
+	if len(c.Args) > 0 {
+		name, tag, ok := strings.Cut(strings.Join(c.Args, " "), "#")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(tag) == "" {
+			c.Reply(fmt.Sprintf("Usage: %s%s [name#tag]", d.Config().Prefix, c.Command))
+			return
+		}
+		c.Reply(link(RiotAccount{GameName: strings.TrimSpace(name), TagLine: strings.TrimSpace(tag), Route: defaultRiotRoute()}))
+		return
+	}
+	accounts := d.Accounts()
+	if len(accounts) == 1 {
+		c.Reply(link(accounts[0]))
+		return
+	}
+	parts := make([]string, len(accounts))
+	for i, a := range accounts {
+		parts[i] = fmt.Sprintf("%s: %s", a, link(a))
+	}
+	c.Reply(strings.Join(parts, " | "))
+}
+
+// Pick one of the command's responses at random, never the same one twice
+// in a row in a channel when there are several
+func (d *Dispatcher) pickResponse(c *CommandContext) string {
+	responses := c.Config.Response
+	switch len(responses) {
+	case 0:
+		return ""
+	case 1:
+		return responses[0]
+	}
+
+	key := c.Channel + " " + c.Command
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last, picked := d.lastPick[key]
+	i := rand.IntN(len(responses))
+	if picked && i == last {
+		// shift past the previous pick, keeping the others equally likely
+		i = (i + 1 + rand.IntN(len(responses)-1)) % len(responses)
+	}
+	d.lastPick[key] = i
+	return responses[i]
+}
+
+// Answer a command by whisper or in its reply mode (REPLY_MODE when unset).
+// A threaded reply without a message id or to another channel is a mention.
+func (d *Dispatcher) respond(msg Message, sender ChatUser, cfg CommandConfig, text string) {
+	if cfg.RespondVia == "whisper" {
+		d.whisper(msg, sender, text)
+		return
+	}
+	mode := cfg.ReplyMode
+	if mode == "" {
+		mode = os.Getenv("REPLY_MODE")
+	}
+
+	channel := msg.Channel()
+	if target := strings.ToLower(strings.TrimPrefix(cfg.TargetChannel, "#")); target != "" && target != channel {
+		if !d.bot.IsJoined(target) {
+			log.Printf("Warning: target_channel #%s is not a joined channel, dropping response", target)
+			return
+		}
+		channel = target
+	}
+
+	switch mode {
+	case "thread":
+		if id := msg.Tags["id"]; id != "" && channel == msg.Channel() {
+			d.bot.sendPrivmsg(channel, replyTags(id), cfg.Action, text)
+			return
+		}
+	case "plain":
+		d.bot.sendPrivmsg(channel, "", cfg.Action, text)
+		return
+	}
+	d.bot.sendPrivmsg(channel, "", cfg.Action, fmt.Sprintf("@%s %s", sender.Name(), text))
+}
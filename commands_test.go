@@ -0,0 +1,74 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLookupUnicodeTriggers(t *testing.T) {
+	t.Setenv("COMMAND_PREFIX", "")
+	// the ñandú trigger is written decomposed, n + U+0303 and u + U+0301
+	config, err := parseConfig("commands.json", []byte(`{
+		"!café":     {"type": "static", "response": "coffee"},
+		"!n\u0303andu\u0301": {"type": "static", "response": "bird"},
+		"!привет":   {"type": "static", "response": "hi"},
+		"!Ελληνικά": {"type": "static", "response": "greek"},
+		"!🎉":        {"type": "static", "response": "party"},
+		"!日本語":     {"type": "static", "response": "japanese"},
+		"olá":       {"type": "static", "response": "keyword", "no_prefix": true}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		msg     string
+		command string // "" when nothing should match
+		args    []string
+	}{
+		{"precomposed", "!caf\u00e9", "caf\u00e9", nil},
+		{"decomposed in chat", "!cafe\u0301", "caf\u00e9", nil},
+		{"decomposed in commands.json", "!\u00f1and\u00fa", "\u00f1and\u00fa", nil},
+		{"accent in uppercase", "!CAF\u00c9", "caf\u00e9", nil},
+		{"accent dropped", "!cafe", "", nil},
+		{"cyrillic", "!привет", "привет", nil},
+		{"cyrillic uppercase", "!ПРИВЕТ", "привет", nil},
+		{"cyrillic with args", "!привет мир", "привет", []string{"мир"}},
+		{"latin lookalike", "!пpивет", "", nil}, // Latin p among the Cyrillic
+		{"greek uppercase", "!ΕΛΛΗΝΙΚΆ", "ελληνικά", nil},
+		{"emoji", "!🎉", "🎉", nil},
+		{"emoji with args", "!🎉 everyone", "🎉", []string{"everyone"}},
+		{"emoji with a zero-width space", "!🎉\u200b", "🎉", nil},
+		{"other emoji", "!🎊", "", nil},
+		{"cjk", "!日本語", "日本語", nil},
+		{"zero-width space inside", "!caf\u200b\u00e9", "caf\u00e9", nil},
+		{"keyword", "ol\u00e1", "ol\u00e1", nil},
+		{"keyword decomposed", "ola\u0301", "ol\u00e1", nil},
+		{"keyword with the prefix", "!ol\u00e1", "", nil},
+	}
+	for _, tt := range tests {
+		command, _, args, ok := config.lookup(tt.msg)
+		if ok != (tt.command != "") || command != tt.command || !slices.Equal(args, tt.args) {
+			t.Errorf("%s: lookup(%q) = %q %q %v, want %q %q", tt.name, tt.msg, command, args, ok, tt.command, tt.args)
+		}
+	}
+}
+
+func TestNormalizeCommand(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"!Caf\u00e9", "!caf\u00e9"},
+		{"  !Cafe\u0301  ", "!caf\u00e9"},
+		{"!\u00adsoft\u00adhyphen", "!softhyphen"},
+		{"!ПРИВЕТ", "!привет"},
+		{"!🎉\ufeff", "!🎉"},
+		{"!rank \U000e0000", "!rank"},
+	}
+	for _, tt := range tests {
+		if got := normalizeCommand(tt.in); got != tt.want {
+			t.Errorf("normalizeCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
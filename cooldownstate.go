@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	cooldownsFile        = "cooldowns.json"
+	cooldownSaveInterval = time.Minute
+)
+
+// ---------- Persisting ----------
+
+// Restore cooldowns saved before a restart, so viewers can't re-trigger
+// every command the moment the bot comes back. Entries that would already
+// have expired under the longest configured cooldown are dropped.
+func (d *Dispatcher) LoadCooldowns(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return
+	}
+	var saved map[string]time.Time
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	longest := d.config.longestCooldown()
+	for key, t := range saved {
+		if time.Since(t) < longest {
+			d.lastUsed[key] = t
+		}
+	}
+	if len(d.lastUsed) > 0 {
+		log.Printf("Restored %d cooldowns from %s", len(d.lastUsed), path)
+	}
+}
+
+// Write the cooldowns still running to path
+func (d *Dispatcher) SaveCooldowns(path string) {
+	d.mu.Lock()
+	longest := d.config.longestCooldown()
+	active := make(map[string]time.Time, len(d.lastUsed))
+	for key, t := range d.lastUsed {
+		if time.Since(t) < longest {
+			active[key] = t
+		}
+	}
+	d.mu.Unlock()
+
+	b, _ := json.MarshalIndent(active, "", "  ")
+	if err := writeFileAtomic(path, b); err != nil {
+		log.Printf("Error writing %s: %v", path, err)
+	}
+}
+
+// Save cooldowns every minute until ctx is cancelled; main saves once more
+// on shutdown
+func (d *Dispatcher) RunCooldownSaver(ctx context.Context, path string) {
+	ticker := time.NewTicker(cooldownSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.SaveCooldowns(path)
+		}
+	}
+}
+
+// Longest cooldown of any command or cooldown group
+func (c *BotConfig) longestCooldown() time.Duration {
+	longest := 0
+	for _, cfg := range c.Commands {
+		longest = max(longest, cfg.Cooldown)
+	}
+	for _, seconds := range c.groupCooldowns {
+		longest = max(longest, seconds)
+	}
+	return time.Duration(longest) * time.Second
+}
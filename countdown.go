@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultCountdownName = "timer"
+	maxCountdown         = 24 * time.Hour
+	maxCountdowns        = 10 // per channel
+)
+
+// Running !timer countdowns by channel, then name
+var (
+	countdowns   = map[string]map[string]*countdown{}
+	countdownsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+type countdown struct {
+	Name    string
+	Message string
+	Ends    time.Time
+	timer   *time.Timer
+}
+
+// ---------- Running ----------
+
+// Start a countdown, replacing one with the same name
+func (d *Dispatcher) startCountdown(channel, name, message string, duration time.Duration) error {
+	countdownsMu.Lock()
+	defer countdownsMu.Unlock()
+	running := countdowns[channel]
+	if running == nil {
+		running = map[string]*countdown{}
+		countdowns[channel] = running
+	}
+	if old, ok := running[name]; ok {
+		old.timer.Stop()
+	} else if len(running) >= maxCountdowns {
+		return fmt.Errorf("%d timers are already running", len(running))
+	}
+
+	cd := &countdown{Name: name, Message: message, Ends: time.Now().Add(duration)}
+	cd.timer = time.AfterFunc(duration, func() { d.finishCountdown(channel, cd) })
+	running[name] = cd
+	return nil
+}
+
+func (d *Dispatcher) finishCountdown(channel string, cd *countdown) {
+	countdownsMu.Lock()
+	current, ok := countdowns[channel][cd.Name]
+	if ok && current == cd {
+		delete(countdowns[channel], cd.Name)
+	}
+	countdownsMu.Unlock()
+	if !ok || current != cd {
+		return // replaced or cancelled meanwhile
+	}
+
+	log.Printf("[#%s] Timer %s finished", channel, cd.Name)
+	switch {
+	case cd.Message != "":
+		d.bot.Say(channel, "Time's up: "+cd.Message)
+	case cd.Name != defaultCountdownName:
+		d.bot.Say(channel, fmt.Sprintf("Time's up for the %s timer!", cd.Name))
+	default:
+		d.bot.Say(channel, "Time's up!")
+	}
+}
+
+// Stop a countdown without announcing it, reporting whether it was running
+func cancelCountdown(channel, name string) bool {
+	countdownsMu.Lock()
+	defer countdownsMu.Unlock()
+	cd, ok := countdowns[channel][name]
+	if ok {
+		cd.timer.Stop()
+		delete(countdowns[channel], name)
+	}
+	return ok
+}
+
+// Stop every countdown, e.g. when shutting down
+func stopCountdowns() {
+	countdownsMu.Lock()
+	defer countdownsMu.Unlock()
+	for channel, running := range countdowns {
+		for _, cd := range running {
+			cd.timer.Stop()
+		}
+		delete(countdowns, channel)
+	}
+}
+
+// "10" (minutes), "90s", "1h30m"
+func parseCountdownDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Minute, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ---------- !timer / !countdown ----------
+func init() {
+	registerBuiltin("timer", "timer", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		p := d.Config().Prefix
+		usage := fmt.Sprintf("Usage: %stimer <duration> [message] | %stimer start <name> <duration> [message] | %stimer cancel [name]", p, p, p)
+		if len(c.Args) == 0 {
+			c.Reply(usage)
+			return
+		}
+
+		name, args := defaultCountdownName, c.Args
+		switch strings.ToLower(c.Args[0]) {
+		case "cancel":
+			if len(c.Args) > 1 {
+				name = strings.ToLower(c.Args[1])
+			}
+			if !cancelCountdown(c.Channel, name) {
+				c.Reply(fmt.Sprintf("There is no %s timer running.", name))
+				return
+			}
+			c.Reply(fmt.Sprintf("Cancelled the %s timer.", name))
+			return
+		case "start":
+			if len(c.Args) < 3 {
+				c.Reply(usage)
+				return
+			}
+			name, args = strings.ToLower(c.Args[1]), c.Args[2:]
+		}
+
+		duration, err := parseCountdownDuration(args[0])
+		if err != nil || duration <= 0 || duration > maxCountdown {
+			c.Reply(fmt.Sprintf("%q isn't a duration up to %s, try 10 (minutes), 90s or 1h30m.", args[0], formatDuration(maxCountdown)))
+			return
+		}
+		message := strings.Join(args[1:], " ")
+		if err := d.startCountdown(c.Channel, name, message, duration); err != nil {
+			c.Reply(fmt.Sprintf("Couldn't start the timer: %v.", err))
+			return
+		}
+		log.Printf("[#%s] %s started the %s timer for %s", c.Channel, c.Sender.Login, name, duration)
+		if name == defaultCountdownName {
+			c.Reply(fmt.Sprintf("Timer set for %s.", formatDuration(duration)))
+		} else {
+			c.Reply(fmt.Sprintf("%s timer set for %s.", name, formatDuration(duration)))
+		}
+	})
+
+	registerBuiltin("countdown", "countdown", 5, "", func(d *Dispatcher, c *CommandContext) {
+		countdownsMu.Lock()
+		running := make([]countdown, 0, len(countdowns[c.Channel]))
+		for _, cd := range countdowns[c.Channel] {
+			if len(c.Args) == 0 || strings.EqualFold(cd.Name, c.Args[0]) {
+				running = append(running, *cd)
+			}
+		}
+		countdownsMu.Unlock()
+
+		if len(running) == 0 {
+			c.Reply("No timer is running.")
+			return
+		}
+		sort.Slice(running, func(i, j int) bool { return running[i].Ends.Before(running[j].Ends) })
+		parts := make([]string, len(running))
+		for i, cd := range running {
+			left := formatDuration(time.Until(cd.Ends))
+			if cd.Name == defaultCountdownName && len(running) == 1 {
+				parts[i] = left + " left"
+			} else {
+				parts[i] = fmt.Sprintf("%s: %s left", cd.Name, left)
+			}
+		}
+		c.Reply(strings.Join(parts, " | "))
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+const countersFile = "counters.json"
+
+// Counter values for "counter" commands, opened in main
+var counters *CounterStore
+
+// JSON file of counter values by channel, then command
+type CounterStore struct {
+	mu     sync.Mutex
+	path   string
+	counts map[string]map[string]int
+}
+
+func NewCounterStore(path string) *CounterStore {
+	s := &CounterStore{path: path, counts: make(map[string]map[string]int)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.counts); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+func (s *CounterStore) Get(channel, command string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[channel][command]
+}
+
+// Apply update to a counter, save the file and return the new value
+func (s *CounterStore) Update(channel, command string, update func(int) int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts[channel] == nil {
+		s.counts[channel] = make(map[string]int)
+	}
+	n := update(s.counts[channel][command])
+	s.counts[channel][command] = n
+
+	data, err := json.MarshalIndent(s.counts, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+	return n
+}
+
+// ---------- Counter commands ----------
+
+// Run a "counter" command. The bare command shows the count; mods can
+// change it with "!deaths+", "!deaths-" or "!deaths set 5".
+func (d *Dispatcher) runCounter(c *CommandContext) {
+	count := counters.Get(c.Channel, c.Command)
+	if len(c.Args) > 0 {
+		if !hasPermission(c.Sender, "moderator") {
+			return
+		}
+		switch c.Args[0] {
+		case "+":
+			count = counters.Update(c.Channel, c.Command, func(n int) int { return n + 1 })
+		case "-":
+			count = counters.Update(c.Channel, c.Command, func(n int) int { return max(n-1, 0) })
+		case "set":
+			if len(c.Args) < 2 {
+				c.Reply(fmt.Sprintf("Usage: %s%s set <number>", d.Config().Prefix, c.Command))
+				return
+			}
+			n, err := strconv.Atoi(c.Args[1])
+			if err != nil {
+				c.Reply(fmt.Sprintf("%q is not a number", c.Args[1]))
+				return
+			}
+			count = counters.Update(c.Channel, c.Command, func(int) int { return n })
+		default:
+			return
+		}
+	}
+
+	response := d.pickResponse(c)
+	if response == "" {
+		response = "{count}"
+	}
+	c.Reply(renderLazy(response, argVars(map[string]string{
+		"user":    c.Sender.Name(),
+		"channel": c.Channel,
+		"count":   strconv.Itoa(count),
+	}, c.Args), streamVars(c.Channel)))
+}
+
+// Split "!deaths+" into "!deaths" and "+" when the base command is a counter
+func counterModifier(commands map[string]CommandConfig, word string) (string, string, bool) {
+	for _, suffix := range []string{"+", "-"} {
+		base, ok := strings.CutSuffix(word, suffix)
+		if ok && commands[base].Type == "counter" {
+			return base, suffix, true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const duelAcceptWindow = 60 * time.Second
+
+// Outstanding duels by the ChatUser.Key of both the challenger and the
+// target, so nobody is in two at once
+var (
+	duels   = map[string]*duel{}
+	duelsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// Both sides' points are taken when the challenge is made and held until
+// the duel is decided, declined or runs out of time
+type duel struct {
+	Channel    string
+	Challenger ChatUser
+	Target     ChatUser
+	Amount     int
+	timer      *time.Timer
+}
+
+// The duel u is in. A target whose id couldn't be looked up is keyed by
+// login, which still finds them once they chat with their id. Caller holds
+// duelsMu.
+func duelOfLocked(u ChatUser) (*duel, bool) {
+	for _, key := range []string{u.Key(), legacyKeyPrefix + strings.ToLower(u.Login)} {
+		if du, ok := duels[key]; ok {
+			return du, true
+		}
+	}
+	return nil, false
+}
+
+// Whether a and b are the same user, by id when both have one
+func sameUser(a, b ChatUser) bool {
+	if a.UserID != "" && b.UserID != "" {
+		return a.UserID == b.UserID
+	}
+	return strings.EqualFold(a.Login, b.Login)
+}
+
+// Caller holds duelsMu
+func (du *duel) removeLocked() {
+	du.timer.Stop()
+	delete(duels, du.Challenger.Key())
+	delete(duels, du.Target.Key())
+}
+
+// Caller holds duelsMu
+func (du *duel) refundLocked() {
+	points.Add(du.Challenger, du.Amount)
+	points.Add(du.Target, du.Amount)
+}
+
+// ---------- Commands ----------
+func init() {
+	registerBuiltin("duel", "duel", 5, "", func(d *Dispatcher, c *CommandContext) {
+		usage := fmt.Sprintf("Usage: %sduel <user> <points>", d.Config().Prefix)
+		if len(c.Args) < 2 {
+			c.Reply(usage)
+			return
+		}
+		amount, err := strconv.Atoi(c.Args[1])
+		if err != nil || amount <= 0 {
+			c.Reply(usage)
+			return
+		}
+		target, ok := userArg(d, c, "duel")
+		if !ok {
+			return
+		}
+		if sameUser(target, c.Sender) {
+			c.Reply("You can't duel yourself.")
+			return
+		}
+		if strings.EqualFold(target.Login, d.bot.Username) {
+			c.Reply("The bot doesn't duel.")
+			return
+		}
+
+		if refusal := d.startDuel(c.Channel, c.Sender, target, amount); refusal != "" {
+			c.Reply(refusal)
+			return
+		}
+
+		log.Printf("[#%s] %s challenged %s to a duel for %d points", c.Channel, c.Sender.Login, target.Login, amount)
+		d.bot.Say(c.Channel, fmt.Sprintf("%s challenged @%s to a duel for %s! Type %saccept within %s, or %sdecline.",
+			c.Sender.Name(), target.Name(), plural(amount, "point", "points"), d.Config().Prefix, formatDuration(duelAcceptWindow), d.Config().Prefix))
+	})
+
+	registerBuiltin("accept", "accept", 0, "", func(d *Dispatcher, c *CommandContext) {
+		du, winner, loser, ok := acceptDuel(c.Channel, c.Sender)
+		if !ok {
+			c.Reply("Nobody has challenged you to a duel.")
+			return
+		}
+
+		log.Printf("[#%s] %s won a duel against %s for %d points", c.Channel, winner.Login, loser.Login, du.Amount)
+		d.bot.Say(c.Channel, fmt.Sprintf("%s won the duel against %s and takes %s!", winner.Name(), loser.Name(), plural(2*du.Amount, "point", "points")))
+	})
+
+	// the target declines, or the challenger takes it back
+	registerBuiltin("decline", "decline", 0, "", func(d *Dispatcher, c *CommandContext) {
+		du, ok := cancelDuel(c.Channel, c.Sender)
+		if !ok {
+			c.Reply("You're not in a duel.")
+			return
+		}
+
+		d.bot.Say(c.Channel, fmt.Sprintf("The duel between %s and %s is off, points refunded.", du.Challenger.Name(), du.Target.Name()))
+	})
+}
+
+// ---------- Duels ----------
+
+// Escrow both sides' points and start the accept timer, returning why not
+// when either is already in a duel or can't afford it
+func (d *Dispatcher) startDuel(channel string, challenger, target ChatUser, amount int) string {
+	duelsMu.Lock()
+	defer duelsMu.Unlock()
+	for _, u := range []ChatUser{challenger, target} {
+		if _, busy := duelOfLocked(u); busy {
+			return fmt.Sprintf("%s is already in a duel.", u.Name())
+		}
+	}
+	if !points.DeductEach([]ChatUser{challenger, target}, amount) {
+		return fmt.Sprintf("You both need %s to duel (%s has %s, %s has %s).", plural(amount, "point", "points"),
+			challenger.Name(), plural(points.Balance(challenger), "point", "points"),
+			target.Name(), plural(points.Balance(target), "point", "points"))
+	}
+	du := &duel{Channel: channel, Challenger: challenger, Target: target, Amount: amount}
+	du.timer = time.AfterFunc(duelAcceptWindow, func() { d.expireDuel(du) })
+	duels[challenger.Key()] = du
+	duels[target.Key()] = du
+	return ""
+}
+
+// Decide the duel u was challenged to in channel, paying out both stakes,
+// ok false when there's none
+func acceptDuel(channel string, u ChatUser) (du *duel, winner, loser ChatUser, ok bool) {
+	duelsMu.Lock()
+	defer duelsMu.Unlock()
+	du, ok = duelOfLocked(u)
+	if !ok || du.Channel != channel || !sameUser(du.Target, u) {
+		return nil, ChatUser{}, ChatUser{}, false
+	}
+	du.removeLocked()
+	winner, loser = du.Challenger, du.Target
+	if rand.IntN(2) == 0 {
+		winner, loser = loser, winner
+	}
+	points.Add(winner, 2*du.Amount)
+	return du, winner, loser, true
+}
+
+// Call off u's duel in channel from either side and refund it, ok false
+// when there's none
+func cancelDuel(channel string, u ChatUser) (*duel, bool) {
+	duelsMu.Lock()
+	defer duelsMu.Unlock()
+	du, ok := duelOfLocked(u)
+	if !ok || du.Channel != channel {
+		return nil, false
+	}
+	du.removeLocked()
+	du.refundLocked()
+	return du, true
+}
+
+// Refund a duel that wasn't accepted in time
+func (d *Dispatcher) expireDuel(du *duel) {
+	duelsMu.Lock()
+	if duels[du.Challenger.Key()] != du {
+		duelsMu.Unlock()
+		return // accepted or declined in the meantime
+	}
+	du.removeLocked()
+	du.refundLocked()
+	duelsMu.Unlock()
+
+	d.bot.Say(du.Channel, fmt.Sprintf("%s didn't accept the duel in time, points refunded.", du.Target.Name()))
+}
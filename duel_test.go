@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const duelStartingPoints = 100
+
+// A dispatcher whose chat goes nowhere and a fresh points store giving each
+// of n users duelStartingPoints
+func duelTest(t *testing.T, n int) (*Dispatcher, []ChatUser) {
+	t.Helper()
+	oldPoints := points
+	points = NewPointsStore(filepath.Join(t.TempDir(), pointsFile))
+	t.Cleanup(func() {
+		duelsMu.Lock()
+		for _, du := range duels {
+			du.removeLocked()
+		}
+		duelsMu.Unlock()
+		points.Flush() // before the temp dir goes
+		points = oldPoints
+	})
+
+	bot := NewBot("duelbot", "", nil)
+	bot.ReadOnly = true
+	users := make([]ChatUser, n)
+	for i := range users {
+		users[i] = ChatUser{Login: fmt.Sprintf("viewer%d", i), UserID: fmt.Sprint(1000 + i)}
+		points.Add(users[i], duelStartingPoints)
+	}
+	return NewDispatcher(bot, nil, nil, nil, &BotConfig{Prefix: "!"}), users
+}
+
+func totalPoints(users []ChatUser) int {
+	total := 0
+	for _, u := range users {
+		total += points.Balance(u)
+	}
+	return total
+}
+
+// Run each of fs on its own goroutine, released together
+func race(fs ...func()) {
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, f := range fs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			f()
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestDuelRaces(t *testing.T) {
+	tests := []struct {
+		name  string
+		users int
+		// races against the store and returns the points still held in
+		// escrow by open duels
+		run func(t *testing.T, d *Dispatcher, users []ChatUser) int
+	}{
+		{
+			name:  "challengers race for one target",
+			users: 9,
+			run: func(t *testing.T, d *Dispatcher, users []ChatUser) int {
+				target := users[0]
+				var started atomic.Int32
+				var fs []func()
+				for _, u := range users[1:] {
+					fs = append(fs, func() {
+						if d.startDuel("chan", u, target, 30) == "" {
+							started.Add(1)
+						}
+					})
+				}
+				race(fs...)
+				if n := started.Load(); n != 1 {
+					t.Errorf("%d duels started against one target, want 1", n)
+				}
+				if got := points.Balance(target); got != duelStartingPoints-30 {
+					t.Errorf("target has %d points, want %d", got, duelStartingPoints-30)
+				}
+				return 2 * 30
+			},
+		},
+		{
+			name:  "accept races the timeout",
+			users: 40,
+			run: func(t *testing.T, d *Dispatcher, users []ChatUser) int {
+				var fs []func()
+				for i := 0; i < len(users); i += 2 {
+					challenger, target := users[i], users[i+1]
+					if refusal := d.startDuel("chan", challenger, target, 50); refusal != "" {
+						t.Fatalf("startDuel: %s", refusal)
+					}
+					duelsMu.Lock()
+					du := duels[challenger.Key()]
+					duelsMu.Unlock()
+					fs = append(fs,
+						func() { acceptDuel("chan", target) },
+						func() { d.expireDuel(du) })
+				}
+				race(fs...)
+				return 0
+			},
+		},
+		{
+			name:  "accept races decline",
+			users: 40,
+			run: func(t *testing.T, d *Dispatcher, users []ChatUser) int {
+				var fs []func()
+				for i := 0; i < len(users); i += 2 {
+					challenger, target := users[i], users[i+1]
+					if refusal := d.startDuel("chan", challenger, target, 50); refusal != "" {
+						t.Fatalf("startDuel: %s", refusal)
+					}
+					fs = append(fs,
+						func() { acceptDuel("chan", target) },
+						func() { cancelDuel("chan", challenger) },
+						func() { cancelDuel("chan", target) })
+				}
+				race(fs...)
+				return 0
+			},
+		},
+		{
+			name:  "challenge, accept and decline all at once",
+			users: 6,
+			run: func(t *testing.T, d *Dispatcher, users []ChatUser) int {
+				var fs []func()
+				for range 50 {
+					for i, u := range users {
+						other := users[(i+1)%len(users)]
+						fs = append(fs,
+							func() { d.startDuel("chan", u, other, 10) },
+							func() { acceptDuel("chan", u) },
+							func() { cancelDuel("chan", u) })
+					}
+				}
+				race(fs...)
+
+				duelsMu.Lock()
+				defer duelsMu.Unlock()
+				held := 0
+				open := map[*duel]bool{}
+				for key, du := range duels {
+					if key != du.Challenger.Key() && key != du.Target.Key() {
+						t.Errorf("duel between %s and %s filed under %s", du.Challenger.Login, du.Target.Login, key)
+					}
+					if !open[du] {
+						open[du] = true
+						held += 2 * du.Amount
+					}
+				}
+				if len(duels) != 2*len(open) {
+					t.Errorf("%d duels under %d keys, want two keys each", len(open), len(duels))
+				}
+				return held
+			},
+		},
+		{
+			name:  "can't afford the stake",
+			users: 2,
+			run: func(t *testing.T, d *Dispatcher, users []ChatUser) int {
+				var refused atomic.Int32
+				race(func() {
+					if d.startDuel("chan", users[0], users[1], duelStartingPoints+1) != "" {
+						refused.Add(1)
+					}
+				}, func() {
+					if d.startDuel("chan", users[1], users[0], duelStartingPoints+1) != "" {
+						refused.Add(1)
+					}
+				})
+				if n := refused.Load(); n != 2 {
+					t.Errorf("%d of 2 unaffordable duels refused", n)
+				}
+				return 0
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, users := duelTest(t, tt.users)
+			held := tt.run(t, d, users)
+			// points only ever move between the two sides of a duel, so every
+			// one paid out or refunded twice would show up here
+			if got, want := totalPoints(users)+held, tt.users*duelStartingPoints; got != want {
+				t.Errorf("%d points in balances and escrow, want %d", got, want)
+			}
+			if held == 0 {
+				duelsMu.Lock()
+				if n := len(duels); n != 0 {
+					t.Errorf("%d duel keys left open", n)
+				}
+				duelsMu.Unlock()
+			}
+		})
+	}
+}
+
+func TestDuelLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  ChatUser // as !duel found them
+		accepts ChatUser // as they chat
+		want    bool
+	}{
+		{"same id", ChatUser{Login: "bob", UserID: "42"}, ChatUser{Login: "bob", UserID: "42"}, true},
+		{"renamed", ChatUser{Login: "bob", UserID: "42"}, ChatUser{Login: "robert", UserID: "42"}, true},
+		{"looked up without an id", ChatUser{Login: "bob"}, ChatUser{Login: "Bob", UserID: "42"}, true},
+		{"someone on the old name", ChatUser{Login: "bob", UserID: "42"}, ChatUser{Login: "bob", UserID: "43"}, false},
+		{"the challenger", ChatUser{Login: "bob", UserID: "42"}, ChatUser{Login: "alice", UserID: "7"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, _ := duelTest(t, 0)
+			challenger := ChatUser{Login: "alice", UserID: "7"}
+			points.Add(challenger, 10)
+			points.Add(tt.target, 10)
+			if refusal := d.startDuel("chan", challenger, tt.target, 10); refusal != "" {
+				t.Fatalf("startDuel: %s", refusal)
+			}
+			_, winner, _, ok := acceptDuel("chan", tt.accepts)
+			if ok != tt.want {
+				t.Fatalf("accepted = %v, want %v", ok, tt.want)
+			}
+			if ok && points.Balance(winner) != 20 {
+				t.Errorf("winner %s has %d points, want 20", winner.Login, points.Balance(winner))
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+const chatCommandCooldown = 5 // cooldown given to commands added from chat
+
+// serializes edits to commands.json from chat
+var commandsFileMu sync.Mutex
+
+// One top-level key of commands.json with its value exactly as written
+type rawEntry struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// ---------- !addcmd / !editcmd / !delcmd ----------
+func init() {
+	registerBuiltin("addcmd", "addcmd", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) < 3 {
+			p := d.Config().Prefix
+			c.Reply(fmt.Sprintf("Usage: %s%s %sname static <response>", p, c.Command, p))
+			return
+		}
+		config := d.Config()
+		trigger, kind, response := config.commandName(c.Args[0]), c.Args[1], strings.Join(c.Args[2:], " ")
+		if kind != "static" {
+			c.Reply("Only static commands can be added from chat.")
+			return
+		}
+		name := config.Prefix + trigger
+		if existing, ok := config.Commands[trigger]; ok {
+			if existing.Type == "static" {
+				c.Reply(fmt.Sprintf("%s already exists, use %seditcmd to change it.", name, config.Prefix))
+			} else {
+				c.Reply(fmt.Sprintf("%s is a %s command and can't be replaced from chat.", name, existing.Type))
+			}
+			return
+		}
+
+		cfg := CommandConfig{Type: "static", Response: Responses{response}, Cooldown: chatCommandCooldown}
+		err := editCommandsFile(d, func(entries []rawEntry) ([]rawEntry, error) {
+			value, err := marshalEntry(cfg)
+			if err != nil {
+				return nil, err
+			}
+			return insertEntry(entries, rawEntry{Key: name, Value: value}), nil
+		})
+		if err != nil {
+			log.Printf("addcmd %s failed: %v", name, err)
+			c.Reply(fmt.Sprintf("Couldn't add %s: %s", name, chatError(err)))
+			return
+		}
+		log.Printf("%s added %s", c.Sender.Login, name)
+		c.Reply(fmt.Sprintf("Added %s", name))
+	})
+
+	registerBuiltin("editcmd", "editcmd", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) < 2 {
+			p := d.Config().Prefix
+			c.Reply(fmt.Sprintf("Usage: %s%s %sname <new response>", p, c.Command, p))
+			return
+		}
+		config := d.Config()
+		trigger, response := config.commandName(c.Args[0]), strings.Join(c.Args[1:], " ")
+		name := config.Prefix + trigger
+		if !checkEditable(config, c, trigger) {
+			return
+		}
+
+		err := editCommandsFile(d, func(entries []rawEntry) ([]rawEntry, error) {
+			i := findEntry(config, entries, trigger)
+			if i < 0 {
+				return nil, fmt.Errorf("%s is not in %s", name, commandsFile)
+			}
+			var cfg CommandConfig
+			if err := json.Unmarshal(entries[i].Value, &cfg); err != nil {
+				return nil, err
+			}
+			cfg.Response = Responses{response}
+			value, err := marshalEntry(cfg)
+			if err != nil {
+				return nil, err
+			}
+			entries[i].Value = value
+			return entries, nil
+		})
+		if err != nil {
+			log.Printf("editcmd %s failed: %v", name, err)
+			c.Reply(fmt.Sprintf("Couldn't edit %s: %s", name, chatError(err)))
+			return
+		}
+		log.Printf("%s edited %s", c.Sender.Login, name)
+		c.Reply(fmt.Sprintf("Updated %s", name))
+	})
+
+	registerBuiltin("delcmd", "delcmd", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) < 1 {
+			p := d.Config().Prefix
+			c.Reply(fmt.Sprintf("Usage: %s%s %sname", p, c.Command, p))
+			return
+		}
+		config := d.Config()
+		trigger := config.commandName(c.Args[0])
+		name := config.Prefix + trigger
+		if !checkEditable(config, c, trigger) {
+			return
+		}
+
+		err := editCommandsFile(d, func(entries []rawEntry) ([]rawEntry, error) {
+			i := findEntry(config, entries, trigger)
+			if i < 0 {
+				return nil, fmt.Errorf("%s is not in %s", name, commandsFile)
+			}
+			return append(entries[:i], entries[i+1:]...), nil
+		})
+		if err != nil {
+			log.Printf("delcmd %s failed: %v", name, err)
+			c.Reply(fmt.Sprintf("Couldn't delete %s: %s", name, chatError(err)))
+			return
+		}
+		log.Printf("%s deleted %s", c.Sender.Login, name)
+		c.Reply(fmt.Sprintf("Deleted %s", name))
+	})
+
+	registerBuiltin("enable", "enable", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		setEnabled(d, c, true)
+	})
+	registerBuiltin("disable", "disable", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		setEnabled(d, c, false)
+	})
+}
+
+// !enable / !disable: flip a command's enabled flag in commands.json.
+// Built-ins that aren't in the file yet get an entry of their own.
+func setEnabled(d *Dispatcher, c *CommandContext, enabled bool) {
+	verb := map[bool]string{true: "enable", false: "disable"}[enabled]
+	if len(c.Args) < 1 {
+		c.Reply(fmt.Sprintf("Usage: %s%s !name", d.Config().Prefix, verb))
+		return
+	}
+
+	config := d.Config()
+	trigger := config.commandName(c.Args[0])
+	name := config.Prefix + trigger
+	existing, ok := config.Commands[trigger]
+	if !ok {
+		trigger, name = normalizeCommand(c.Args[0]), normalizeCommand(c.Args[0])
+		existing, ok = config.Commands[trigger]
+	}
+	if !ok {
+		c.Reply(fmt.Sprintf("%s doesn't exist.", name))
+		return
+	}
+	if existing.Type == "builtin" && (existing.Endpoint == "enable" || existing.Endpoint == "disable") {
+		c.Reply(fmt.Sprintf("%s can't be disabled.", name))
+		return
+	}
+	if existing.IsEnabled() == enabled {
+		c.Reply(fmt.Sprintf("%s is already %sd.", name, verb))
+		return
+	}
+
+	err := editCommandsFile(d, func(entries []rawEntry) ([]rawEntry, error) {
+		cfg := existing
+		i := findEntry(config, entries, trigger)
+		if i >= 0 {
+			if err := json.Unmarshal(entries[i].Value, &cfg); err != nil {
+				return nil, err
+			}
+		} else if existing.Type != "builtin" {
+			return nil, fmt.Errorf("%s is not in %s", name, commandsFile)
+		}
+
+		cfg.Enabled = nil
+		if !enabled {
+			cfg.Enabled = &enabled
+		}
+		value, err := marshalEntry(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if i >= 0 {
+			entries[i].Value = value
+			return entries, nil
+		}
+		return insertEntry(entries, rawEntry{Key: name, Value: value}), nil
+	})
+	if err != nil {
+		log.Printf("%s %s failed: %v", verb, name, err)
+		c.Reply(fmt.Sprintf("Couldn't %s %s: %s", verb, name, chatError(err)))
+		return
+	}
+	log.Printf("%s %sd %s", c.Sender.Login, verb, name)
+	c.Reply(fmt.Sprintf("%s %sd", name, verb))
+}
+
+// Only static commands may be edited or deleted from chat; reply and return
+// false otherwise
+func checkEditable(config *BotConfig, c *CommandContext, trigger string) bool {
+	name := config.Prefix + trigger
+	existing, ok := config.Commands[trigger]
+	if !ok || existing.NoPrefix {
+		c.Reply(fmt.Sprintf("%s doesn't exist.", name))
+		return false
+	}
+	if existing.Type != "static" {
+		c.Reply(fmt.Sprintf("%s is a %s command and can only be changed in %s.", name, existing.Type, commandsFile))
+		return false
+	}
+	return true
+}
+
+// ---------- Persisting ----------
+
+// Apply edit to the entries of commands.json, write the file atomically and
+// load the result into the dispatcher. Entries edit doesn't touch are
+// written back byte for byte, in their original order.
+func editCommandsFile(d *Dispatcher, edit func([]rawEntry) ([]rawEntry, error)) error {
+	commandsFileMu.Lock()
+	defer commandsFileMu.Unlock()
+
+	data, err := os.ReadFile(commandsFile)
+	if err != nil {
+		return err
+	}
+	entries, err := parseEntries(data)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", commandsFile, err)
+	}
+	if entries, err = edit(entries); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, e := range entries {
+		key, _ := json.Marshal(e.Key)
+		fmt.Fprintf(&b, "  %s: %s", key, e.Value)
+		if i < len(entries)-1 {
+			b.WriteByte(',')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString("}\n")
+
+	// check the result before it replaces a working file
+	config, err := parseConfig(commandsFile, b.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(commandsFile, b.Bytes()); err != nil {
+		return err
+	}
+	d.SetConfig(config)
+	return nil
+}
+
+// Split a JSON object into its keys and raw values, keeping file order
+func parseEntries(data []byte) ([]rawEntry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var entries []rawEntry
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		entries = append(entries, rawEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+// Add a command ahead of the settings sections at the end of the file
+func insertEntry(entries []rawEntry, entry rawEntry) []rawEntry {
+	at := len(entries)
+	for i, e := range entries {
+		if isSection(e.Key) {
+			at = i
+			break
+		}
+	}
+	return append(entries[:at], append([]rawEntry{entry}, entries[at:]...)...)
+}
+
+// Index of the entry for the prefixed command trigger, or -1
+func findEntry(config *BotConfig, entries []rawEntry, trigger string) int {
+	for i, e := range entries {
+		if !isSection(e.Key) && config.commandName(e.Key) == trigger {
+			return i
+		}
+	}
+	return -1
+}
+
+// Encode a command the way commands.json is indented, without escaping
+// characters like < and & that chat responses often contain
+func marshalEntry(cfg CommandConfig) (json.RawMessage, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("  ", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
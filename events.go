@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+)
+
+// ---------- Types ----------
+
+// Response to a USERNOTICE event, configured under "events" in commands.json
+// and keyed by the notice's msg-id (sub, resub, subgift, submysterygift, raid)
+type EventConfig struct {
+	Response string `json:"response"`
+}
+
+// ---------- USERNOTICE ----------
+
+// OnUserNotice handler thanking subscribers, gifters and raiders
+func (d *Dispatcher) HandleUserNotice(msg Message) {
+	kind := msg.Tags["msg-id"]
+	event, ok := d.Config().Events[kind]
+	if !ok || event.Response == "" {
+		return
+	}
+
+	user := msg.Tags["display-name"]
+	if user == "" {
+		user = msg.Tags["login"]
+	}
+	vars := map[string]string{
+		"user":      user,
+		"channel":   msg.Channel(),
+		"months":    msg.Tags["msg-param-cumulative-months"],
+		"recipient": msg.Tags["msg-param-recipient-display-name"],
+		"gifts":     msg.Tags["msg-param-mass-gift-count"],
+		"raider":    msg.Tags["msg-param-displayName"],
+		"viewers":   msg.Tags["msg-param-viewerCount"],
+		"message":   msg.Trailing,
+	}
+	if vars["raider"] == "" {
+		vars["raider"] = user
+	}
+
+	log.Printf("[#%s] %s event from %s", msg.Channel(), kind, user)
+	d.bot.Say(msg.Channel(), renderTemplate(event.Response, vars))
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultExecTimeout = 5 * time.Second
+	execMaxOutput      = 4 << 10
+)
+
+// ---------- Exec commands ----------
+
+// Run an "exec" command: start the program from commands.json and reply
+// with the first line it prints, through the response template as {result}.
+// Nothing from chat reaches the program, its arguments are fixed in the file.
+func (d *Dispatcher) runExec(c *CommandContext) {
+	result, err := runProgram(c.Config)
+	if err != nil {
+		log.Printf("exec command %s (%s): %v", c.Command, strings.Join(c.Config.Command, " "), err)
+		c.Reply("That command isn't working right now.")
+		return
+	}
+
+	response := d.pickResponse(c)
+	if response == "" {
+		response = "{result}"
+	}
+	c.Reply(renderLazy(response, argVars(map[string]string{
+		"user":    c.Sender.Name(),
+		"channel": c.Channel,
+		"result":  result,
+	}, c.Args), streamVars(c.Channel)))
+}
+
+func runProgram(cfg CommandConfig) (string, error) {
+	timeout := defaultExecTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: execMaxOutput}
+	stderr := &cappedBuffer{limit: execMaxOutput}
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// don't wait forever on children that keep the output pipes open
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return "", fmt.Errorf("no output")
+	}
+	return line, nil
+}
+
+// Buffer that keeps the first limit bytes and quietly drops the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
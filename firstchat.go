@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+const (
+	firstChatFile       = "first_chat.json"
+	firstChatCountsFile = "first_chat_counts.json"
+)
+
+// Opened in main
+var (
+	firstChats      *FirstChatStore
+	firstChatCounts *UserStore[int] // times each user was first, across channels
+)
+
+// ---------- Types ----------
+
+// Who chatted first in a channel's current stream
+type firstChatHolder struct {
+	StreamStart int64  `json:"streamStart"`
+	Key         string `json:"key"` // ChatUser.Key
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+func (h firstChatHolder) Name() string {
+	if h.DisplayName != "" {
+		return h.DisplayName
+	}
+	return h.Login
+}
+
+// JSON file of the first chatter by channel, so a restart mid-stream
+// doesn't hand out first chat again
+type FirstChatStore struct {
+	mu      sync.Mutex
+	path    string
+	holders map[string]firstChatHolder
+}
+
+func NewFirstChatStore(path string) *FirstChatStore {
+	s := &FirstChatStore{path: path, holders: make(map[string]firstChatHolder)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.holders); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// ---------- Claiming ----------
+
+// Called by the dispatcher for every chat message from a user who isn't
+// ignored: the first one after the stream goes live claims first chat.
+// Offline chat never counts, nor does chat while the stream start is
+// unknown. This runs on the IRC read loop, so it never waits on Helix.
+func (d *Dispatcher) claimFirstChat(channel string, u ChatUser) {
+	start, err := knownStreamStart(channel)
+	if err != nil || start == 0 {
+		return
+	}
+
+	s := firstChats
+	s.mu.Lock()
+	if h, ok := s.holders[channel]; ok && h.StreamStart == start {
+		s.mu.Unlock()
+		return
+	}
+	s.holders[channel] = firstChatHolder{StreamStart: start, Key: u.Key(), Login: u.Login, DisplayName: u.DisplayName}
+	data, err := json.MarshalIndent(s.holders, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+	s.mu.Unlock()
+
+	firstChatCounts.Update(u, func(n *int) { *n++ })
+	log.Printf("[#%s] First chat claimed by %s", channel, u.Login)
+	d.bot.Say(channel, fmt.Sprintf("%s claimed first chat!", u.Name()))
+}
+
+// First chatter of the channel's current stream, if anyone has chatted
+func (s *FirstChatStore) Holder(channel string) (firstChatHolder, bool) {
+	start, err := CachedStreamStart(channel)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.holders[channel]
+	if err != nil {
+		return h, ok // the last stream's, as far as anyone can tell
+	}
+	if !ok || start == 0 || h.StreamStart != start {
+		return firstChatHolder{}, false
+	}
+	return h, true
+}
+
+// ---------- !first / !firstcount ----------
+func init() {
+	registerBuiltin("first", "first", 5, "", func(d *Dispatcher, c *CommandContext) {
+		h, ok := firstChats.Holder(c.Channel)
+		if !ok {
+			c.Reply("Nobody has claimed first chat this stream yet.")
+			return
+		}
+		count, _ := firstChatCounts.Get(ChatUser{Login: h.Login, UserID: userIDFromKey(h.Key)})
+		c.Reply(fmt.Sprintf("%s claimed first chat this stream (%s first overall).", h.Name(), plural(count, "time", "times")))
+	})
+
+	registerBuiltin("firstcount", "firstcount", 5, "", func(d *Dispatcher, c *CommandContext) {
+		target := c.Sender
+		if len(c.Args) > 0 {
+			var ok bool
+			if target, ok = userArg(d, c, "firstcount"); !ok {
+				return
+			}
+		}
+		count, _ := firstChatCounts.Get(target)
+		c.Reply(fmt.Sprintf("%s has been first in chat %s.", target.Name(), plural(count, "time", "times")))
+	})
+}
+
+// The user-id a ChatUser.Key holds, "" for a login key
+func userIDFromKey(key string) string {
+	if isUserID(key) {
+		return key
+	}
+	return ""
+}
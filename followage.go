@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ---------- !followage ----------
+func init() {
+	registerBuiltin("followage", "followage", 5, "", func(d *Dispatcher, c *CommandContext) {
+		name := c.Sender.Name()
+		broadcasterID, err := channelID(c)
+		if err != nil {
+			log.Printf("followage: %v", err)
+			c.Reply("Couldn't look that up right now.")
+			return
+		}
+		userID := c.Sender.UserID
+		if userID == "" {
+			user, err := GetTwitchUser(c.Sender.Login)
+			if err != nil || user == nil {
+				log.Printf("followage: looking up %s: %v", c.Sender.Login, err)
+				c.Reply("Couldn't look that up right now.")
+				return
+			}
+			userID = user.ID
+		}
+
+		followedAt, following, err := GetFollowedAt(c.Channel, broadcasterID, userID)
+		if err != nil {
+			log.Printf("followage: %v", err)
+			c.Reply("Couldn't look that up right now.")
+			return
+		}
+		if !following {
+			c.Reply(fmt.Sprintf("%s, you don't follow %s yet.", name, c.Channel))
+			return
+		}
+		c.Reply(fmt.Sprintf("%s has been following %s for %s", name, c.Channel, humanizeSince(followedAt, time.Now())))
+	})
+}
+
+// Broadcaster id from the message's room-id tag, or a Users lookup without tags
+func channelID(c *CommandContext) (string, error) {
+	if id := c.Msg.Tags["room-id"]; id != "" {
+		return id, nil
+	}
+	user, err := GetTwitchUser(c.Channel)
+	if err != nil {
+		return "", err
+	}
+	if user == nil {
+		return "", fmt.Errorf("no Twitch user %s", c.Channel)
+	}
+	return user.ID, nil
+}
+
+// When userID followed the broadcaster. The followers endpoint needs a
+// broadcaster or moderator token, so this uses one saved by --authorize.
+func GetFollowedAt(channel, broadcasterID, userID string) (time.Time, bool, error) {
+	token, err := userTokens.For(channel, "moderator:read:followers")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	var res struct {
+		Data []struct {
+			FollowedAt time.Time `json:"followed_at"`
+		} `json:"data"`
+	}
+	path := "channels/followers?broadcaster_id=" + url.QueryEscape(broadcasterID) + "&user_id=" + url.QueryEscape(userID)
+	if err := helixAs(token, "GET", path, nil, &res); err != nil {
+		return time.Time{}, false, err
+	}
+	if len(res.Data) == 0 {
+		return time.Time{}, false, nil
+	}
+	return res.Data[0].FollowedAt, true, nil
+}
+
+// "2 years, 3 months", "5 days", "4 hours": the two largest calendar units
+// between from and now
+func humanizeSince(from, now time.Time) string {
+	years, months, days := 0, 0, 0
+	for !from.AddDate(years+1, 0, 0).After(now) {
+		years++
+	}
+	for !from.AddDate(years, months+1, 0).After(now) {
+		months++
+	}
+	for !from.AddDate(years, months, days+1).After(now) {
+		days++
+	}
+
+	var parts []string
+	for _, p := range []struct {
+		n              int
+		singular, many string
+	}{{years, "year", "years"}, {months, "month", "months"}, {days, "day", "days"}} {
+		if p.n > 0 && len(parts) < 2 {
+			parts = append(parts, plural(p.n, p.singular, p.many))
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, ", ")
+	}
+	if hours := int(now.Sub(from).Hours()); hours > 0 {
+		return plural(hours, "hour", "hours")
+	}
+	return "less than an hour"
+}
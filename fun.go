@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ---------- Config & Globals ----------
+const (
+	maxDice      = 100
+	maxDieSides  = 1000
+	maxDieBonus  = 10000
+	maxDiceShown = 10 // list each die only for small rolls
+)
+
+var diceNotation = regexp.MustCompile(`^(\d*)d(\d+)([+-]\d+)?$`)
+
+// Answers for !8ball unless its commands.json entry has a "response" list
+var eightBallAnswers = Responses{
+	"It is certain.", "Without a doubt.", "Yes, definitely.", "Most likely.", "Signs point to yes.",
+	"Ask again later.", "Cannot predict now.", "Better not tell you now.",
+	"Don't count on it.", "My sources say no.", "Very doubtful.", "Outlook not so good.",
+}
+
+// ---------- !roll / !8ball / !coinflip ----------
+func init() {
+	registerBuiltin("roll", "roll", 5, "", func(d *Dispatcher, c *CommandContext) {
+		notation := "1d6"
+		if len(c.Args) > 0 {
+			notation = strings.ToLower(c.Args[0])
+		}
+		result, ok := rollDice(notation)
+		if !ok {
+			c.Reply(fmt.Sprintf("Use dice notation like d20, 2d6 or 2d20+5, up to %d dice with %d sides.", maxDice, maxDieSides))
+			return
+		}
+		c.Reply(fmt.Sprintf("rolled %s: %s", notation, result))
+	})
+
+	registerBuiltin("8ball", "8ball", 5, "", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) == 0 {
+			c.Reply("Ask me a question!")
+			return
+		}
+		if len(c.Config.Response) == 0 {
+			c.Config.Response = eightBallAnswers
+		}
+		c.Reply(d.pickResponse(c))
+	})
+
+	registerBuiltin("coinflip", "coinflip", 5, "", func(d *Dispatcher, c *CommandContext) {
+		c.Reply(fmt.Sprintf("flipped a coin: %s!", []string{"Heads", "Tails"}[rand.IntN(2)]))
+	})
+}
+
+// Roll dice notation like "d20", "2d6" or "2d20+5", returning "[4, 5] + 5 = 14".
+// Reports false for anything else or rolls over the caps.
+func rollDice(notation string) (string, bool) {
+	m := diceNotation.FindStringSubmatch(notation)
+	if m == nil {
+		return "", false
+	}
+	count := 1
+	if m[1] != "" {
+		count, _ = strconv.Atoi(m[1])
+	}
+	sides, _ := strconv.Atoi(m[2])
+	bonus := 0
+	if m[3] != "" {
+		bonus, _ = strconv.Atoi(m[3])
+	}
+	if count < 1 || count > maxDice || sides < 2 || sides > maxDieSides || bonus > maxDieBonus || bonus < -maxDieBonus {
+		return "", false
+	}
+
+	total := bonus
+	rolls := make([]string, count)
+	for i := range rolls {
+		n := rand.IntN(sides) + 1
+		total += n
+		rolls[i] = strconv.Itoa(n)
+	}
+
+	var b strings.Builder
+	if count > 1 && count <= maxDiceShown {
+		fmt.Fprintf(&b, "[%s] ", strings.Join(rolls, ", "))
+	}
+	if bonus > 0 {
+		fmt.Fprintf(&b, "+ %d ", bonus)
+	} else if bonus < 0 {
+		fmt.Fprintf(&b, "- %d ", -bonus)
+	}
+	if b.Len() == 0 {
+		return strconv.Itoa(total), true
+	}
+	fmt.Fprintf(&b, "= %d", total)
+	return b.String(), true
+}
@@ -1,5 +1,7 @@
 module github.com/Thelethalghost/twitch-bot
 
-go 1.25.1
+go 1.26.0
 
 require github.com/joho/godotenv v1.5.1
+
+require golang.org/x/text v0.42.0
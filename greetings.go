@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultGreetingsPerMinute = 3
+	maxGreetedPerStream       = 10000 // per channel; past this nobody new is greeted
+)
+
+// Users already greeted per channel, for the current stream only
+var (
+	greeted   = map[string]*greetedUsers{}
+	greetedMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// Greeting for a user's first message of the stream, configured under
+// "greetings" in commands.json. Without that section nobody is greeted.
+type GreetingConfig struct {
+	Message           Responses `json:"message"`                      // {user}, {channel}
+	SubscriberMessage Responses `json:"subscriber_message,omitempty"` // for subscribers, also {months}; defaults to message
+	MaxPerMinute      int       `json:"max_per_minute,omitempty"`     // greetings beyond this are skipped, e.g. during a raid
+}
+
+type greetedUsers struct {
+	StreamStart int64
+	Users       map[string]bool // ChatUser.Key
+	limiter     *rateLimiter
+}
+
+// ---------- Greeting ----------
+
+// Called by the dispatcher for every chat message: greet a user the first
+// time they chat in the current stream. Users skipped by the rate limit
+// still count as greeted, so a raid doesn't turn into a backlog. Like
+// claimFirstChat it runs on the IRC read loop and only uses the stream
+// start already known.
+func (d *Dispatcher) greet(msg Message, u ChatUser) {
+	g := d.Config().Greetings
+	if g == nil {
+		return
+	}
+	channel := msg.Channel()
+	start, err := knownStreamStart(channel)
+	if err != nil || start == 0 {
+		return
+	}
+
+	greetedMu.Lock()
+	seen, ok := greeted[channel]
+	if !ok || seen.StreamStart != start {
+		seen = &greetedUsers{StreamStart: start, Users: map[string]bool{}, limiter: newRateLimiter(time.Minute)}
+		greeted[channel] = seen
+	}
+	if seen.Users[u.Key()] || len(seen.Users) >= maxGreetedPerStream {
+		greetedMu.Unlock()
+		return
+	}
+	seen.Users[u.Key()] = true
+	greetedMu.Unlock()
+
+	limit := g.MaxPerMinute
+	if limit == 0 {
+		limit = defaultGreetingsPerMinute
+	}
+	if seen.limiter.reserve(limit) > 0 {
+		log.Printf("[#%s] Skipping greeting for %s, %d greetings per minute reached", channel, u.Login, limit)
+		return
+	}
+
+	templates := g.Message
+	vars := map[string]string{"user": u.Name(), "channel": channel}
+	if u.IsSubscriber && len(g.SubscriberMessage) > 0 {
+		templates = g.SubscriberMessage
+		vars["months"] = subscriberMonths(msg.Tags)
+	}
+	if len(templates) == 0 {
+		return // only subscribers are greeted
+	}
+	d.bot.Say(channel, renderTemplate(templates[rand.IntN(len(templates))], vars))
+}
+
+// Months subscribed from the badge-info tag ("subscriber/14"), "1" if absent
+func subscriberMonths(tags map[string]string) string {
+	if months := parseBadges(tags["badge-info"])["subscriber"]; months != "" {
+		return months
+	}
+	return "1"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGreetUsesTheKnownStreamStart(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	b.setConn(&ircConn{})
+	d := &Dispatcher{bot: b, config: &BotConfig{Greetings: &GreetingConfig{Message: Responses{"welcome {user}"}}}}
+	msg, _ := parseMessage("@user-id=1 :alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :hello")
+	alice := ChatUser{Login: "alice", UserID: "1"}
+
+	tests := []struct {
+		name    string
+		known   *streamStartEntry // cached before the messages, nil for nothing
+		greeted int               // greetings for two messages in a row
+	}{
+		{"start unknown", nil, 0},
+		{"offline", &streamStartEntry{Start: 0}, 0},
+		{"live", &streamStartEntry{Start: 1760464800}, 1},
+		{"live, long ago looked up", &streamStartEntry{Start: 1760468400, FetchedAt: time.Now().Add(-time.Hour)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeHelix(t, "streamer", 200, `{"data": []}`)
+			if tt.known != nil {
+				streamStartCacheMu.Lock()
+				streamStartCache["streamer"] = *tt.known
+				streamStartCacheMu.Unlock()
+			}
+			t.Cleanup(func() {
+				greetedMu.Lock()
+				delete(greeted, "streamer")
+				greetedMu.Unlock()
+			})
+
+			d.greet(msg, alice)
+			d.greet(msg, alice)
+			if n := len(queuedChat()); n != tt.greeted {
+				t.Errorf("%d greetings, want %d", n, tt.greeted)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests to Helix from the read loop", n)
+			}
+		})
+	}
+}
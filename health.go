@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+var health = &botHealth{StartedAt: time.Now()}
+
+// ---------- Types ----------
+
+// Process-wide health markers reported by !ping
+type botHealth struct {
+	mu           sync.Mutex
+	StartedAt    time.Time
+	LastRiotOK   time.Time
+	LastTwitchOK time.Time
+}
+
+func recordRiotSuccess() {
+	health.mu.Lock()
+	health.LastRiotOK = time.Now()
+	health.mu.Unlock()
+}
+
+func recordTwitchSuccess() {
+	health.mu.Lock()
+	health.LastTwitchOK = time.Now()
+	health.mu.Unlock()
+}
+
+// ---------- !ping ----------
+func init() {
+	registerBuiltin("ping", "ping", 5, "", func(d *Dispatcher, c *CommandContext) {
+		d.bot.MeasureLatency(func(latency time.Duration, err error) {
+			health.mu.Lock()
+			uptime := time.Since(health.StartedAt)
+			lastRiot := health.LastRiotOK
+			lastTwitch := health.LastTwitchOK
+			health.mu.Unlock()
+
+			irc := "no PONG from Twitch"
+			if err == nil {
+				irc = fmt.Sprintf("%dms", latency.Milliseconds())
+			}
+			c.Reply(fmt.Sprintf("Pong! IRC latency: %s | Uptime: %s | Last Riot API call: %s | Last Twitch API call: %s",
+				irc, formatDuration(uptime), timeAgo(lastRiot), timeAgo(lastTwitch)))
+		})
+	})
+}
+
+// ---------- Helpers ----------
+
+// "5m 3s ago", or "never" for the zero time
+func timeAgo(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return formatDuration(time.Since(t)) + " ago"
+}
+
+// "3h 12m", "12m 5s" or "40s"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := int(d.Hours())
+	m := int(d.Minutes()) % 60
+	s := int(d.Seconds()) % 60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh %dm", h, m)
+	case m > 0:
+		return fmt.Sprintf("%dm %ds", m, s)
+	default:
+		return fmt.Sprintf("%ds", s)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	httpCommandTimeout = 5 * time.Second
+	httpCommandMaxBody = 64 << 10
+)
+
+var httpCommandClient = &http.Client{
+	Timeout: httpCommandTimeout,
+	// a redirect must not lead away from https either
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to non-https URL %s", req.URL)
+		}
+		if len(via) >= 3 {
+			return fmt.Errorf("too many redirects")
+		}
+		return nil
+	},
+}
+
+// ---------- HTTP commands ----------
+
+// Run an "http" command: fetch the configured URL and reply with the body,
+// or the field at json_path, through the response template as {result}
+func (d *Dispatcher) runHTTP(c *CommandContext) {
+	result, err := fetchHTTPCommand(c)
+	if err != nil {
+		log.Printf("http command %s: %v", c.Command, err)
+		c.Reply("Error fetching that right now.")
+		return
+	}
+
+	response := d.pickResponse(c)
+	if response == "" {
+		response = "{result}"
+	}
+	c.Reply(renderLazy(response, argVars(map[string]string{
+		"user":    c.Sender.Name(),
+		"channel": c.Channel,
+		"result":  result,
+	}, c.Args), streamVars(c.Channel)))
+}
+
+func fetchHTTPCommand(c *CommandContext) (string, error) {
+	// values are escaped for the query string so "{args}" can't rewrite the URL
+	raw := renderTemplate(c.Config.URL, argVars(map[string]string{
+		"user":    url.QueryEscape(c.Sender.Login),
+		"channel": url.QueryEscape(c.Channel),
+	}, escapeAll(c.Args)))
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("only https URLs are allowed, got %q", raw)
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range c.Config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := httpCommandClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", u.Host, res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, httpCommandMaxBody+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > httpCommandMaxBody {
+		return "", fmt.Errorf("response from %s is over %d bytes", u.Host, httpCommandMaxBody)
+	}
+
+	if c.Config.JSONPath == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("response from %s is not JSON: %w", u.Host, err)
+	}
+	return extractJSONPath(doc, c.Config.JSONPath)
+}
+
+func escapeAll(args []string) []string {
+	escaped := make([]string, len(args))
+	for i, a := range args {
+		escaped[i] = url.QueryEscape(a)
+	}
+	return escaped
+}
+
+// Walk a dotted path like "data.0.title" through decoded JSON, using
+// numbers as array indexes
+func extractJSONPath(doc any, path string) (string, error) {
+	for _, part := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]any:
+			next, ok := v[part]
+			if !ok {
+				return "", fmt.Errorf("no field %q in %q", part, path)
+			}
+			doc = next
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("no index %q in %q", part, path)
+			}
+			doc = v[i]
+		default:
+			return "", fmt.Errorf("%q in %q is not an object or array", part, path)
+		}
+	}
+
+	switch v := doc.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
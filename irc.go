@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+)
+
+// CTCP framing used for /me messages
+const (
+	actionPrefix = "\x01ACTION "
+	actionSuffix = "\x01"
+)
+
+// ---------- Types ----------
+
+// A single parsed IRC line: [@tags] [:prefix] COMMAND [params...] [:trailing]
+type Message struct {
+	Tags     map[string]string
+	Prefix   string
+	Command  string
+	Params   []string
+	Trailing string
+}
+
+// Nick portion of a "nick!user@host" prefix
+func (m Message) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// Channel the message was sent to, without the leading '#'
+func (m Message) Channel() string {
+	if len(m.Params) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(m.Params[0], "#")
+}
+
+// Sender of a chat message as described by its IRCv3 tags
+type ChatUser struct {
+	Login         string
+	DisplayName   string
+	UserID        string
+	Badges        map[string]string
+	IsBroadcaster bool
+	IsMod         bool
+	IsSubscriber  bool
+	IsVIP         bool
+}
+
+// Name to use when mentioning the user in chat
+func (u ChatUser) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Login
+}
+
+// ---------- Parsing ----------
+
+// Parse a raw IRC line. Returns false for lines without a command.
+func parseMessage(line string) (Message, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	tags, rest := splitTags(line)
+	msg := Message{Tags: tags}
+
+	rest = strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(rest, ":") {
+		msg.Prefix, rest, _ = strings.Cut(rest[1:], " ")
+	}
+
+	// everything after the first " :" is the trailing parameter and may
+	// itself contain spaces, colons or anything else
+	middle, trailing, _ := strings.Cut(rest, " :")
+	msg.Trailing = trailing
+
+	fields := strings.Fields(middle)
+	if len(fields) == 0 {
+		return Message{}, false
+	}
+	msg.Command = strings.ToUpper(fields[0])
+	msg.Params = fields[1:]
+	return msg, true
+}
+
+// Strip the CTCP ACTION framing from a /me message, reporting whether it was one
+func stripAction(text string) (string, bool) {
+	if !strings.HasPrefix(text, actionPrefix) {
+		return text, false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(text, actionPrefix), actionSuffix), true
+}
+
+// ---------- Tags ----------
+
+// Split a raw line into its tags and the remainder. Lines without a tag
+// prefix (e.g. when the CAP request was refused) return an empty map.
+func splitTags(line string) (map[string]string, string) {
+	if !strings.HasPrefix(line, "@") {
+		return map[string]string{}, line
+	}
+	raw, rest, _ := strings.Cut(line[1:], " ")
+	return parseTags(raw), rest
+}
+
+// Parse "key=value;key2=value2" into a map, unescaping values
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(raw, ";") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		tags[key] = unescapeTagValue(value)
+	}
+	return tags
+}
+
+// Undo the IRCv3 tag value escaping (\: \s \\ \r \n)
+func unescapeTagValue(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			b.WriteByte(v[i])
+			continue
+		}
+		i++
+		if i == len(v) {
+			break // trailing backslash is dropped
+		}
+		switch v[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+// Parse "broadcaster/1,subscriber/12" into badge name -> version
+func parseBadges(raw string) map[string]string {
+	badges := make(map[string]string)
+	for _, badge := range strings.Split(raw, ",") {
+		if badge == "" {
+			continue
+		}
+		name, version, _ := strings.Cut(badge, "/")
+		badges[name] = version
+	}
+	return badges
+}
+
+// Build the chat user from the login in the prefix and the message tags
+func newChatUser(login string, tags map[string]string) ChatUser {
+	badges := parseBadges(tags["badges"])
+	_, broadcaster := badges["broadcaster"]
+	_, moderator := badges["moderator"]
+	_, subscriber := badges["subscriber"]
+	_, founder := badges["founder"]
+	_, vip := badges["vip"]
+
+	return ChatUser{
+		Login:         login,
+		DisplayName:   tags["display-name"],
+		UserID:        tags["user-id"],
+		Badges:        badges,
+		IsBroadcaster: broadcaster,
+		IsMod:         moderator || tags["mod"] == "1",
+		IsSubscriber:  subscriber || founder || tags["subscriber"] == "1",
+		IsVIP:         vip || tags["vip"] == "1",
+	}
+}
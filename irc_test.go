@@ -0,0 +1,129 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Message
+		ok   bool
+	}{
+		{
+			name: "privmsg without tags",
+			line: ":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :hello there\r\n",
+			want: Message{Tags: map[string]string{}, Prefix: "alice!alice@alice.tmi.twitch.tv", Command: "PRIVMSG", Params: []string{"#streamer"}, Trailing: "hello there"},
+			ok:   true,
+		},
+		{
+			name: "colons in the body",
+			line: ":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :!addcmd !time static it's 12:30 :) see https://example.com",
+			want: Message{Tags: map[string]string{}, Prefix: "alice!alice@alice.tmi.twitch.tv", Command: "PRIVMSG", Params: []string{"#streamer"}, Trailing: "!addcmd !time static it's 12:30 :) see https://example.com"},
+			ok:   true,
+		},
+		{
+			name: "body starting with a colon",
+			line: ":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer ::D",
+			want: Message{Tags: map[string]string{}, Prefix: "alice!alice@alice.tmi.twitch.tv", Command: "PRIVMSG", Params: []string{"#streamer"}, Trailing: ":D"},
+			ok:   true,
+		},
+		{
+			name: "tags",
+			line: `@badges=moderator/1;display-name=Alice;user-id=1234;system-msg=hi\sthere\:\\ :alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :!rank`,
+			want: Message{
+				Tags:     map[string]string{"badges": "moderator/1", "display-name": "Alice", "user-id": "1234", "system-msg": `hi there;\`},
+				Prefix:   "alice!alice@alice.tmi.twitch.tv",
+				Command:  "PRIVMSG",
+				Params:   []string{"#streamer"},
+				Trailing: "!rank",
+			},
+			ok: true,
+		},
+		{
+			name: "empty tag values",
+			line: "@emotes=;flags=;mod=0 :tmi.twitch.tv USERSTATE #streamer",
+			want: Message{Tags: map[string]string{"emotes": "", "flags": "", "mod": "0"}, Prefix: "tmi.twitch.tv", Command: "USERSTATE", Params: []string{"#streamer"}},
+			ok:   true,
+		},
+		{
+			name: "ctcp action",
+			line: ":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :\x01ACTION waves: hi\x01",
+			want: Message{Tags: map[string]string{}, Prefix: "alice!alice@alice.tmi.twitch.tv", Command: "PRIVMSG", Params: []string{"#streamer"}, Trailing: "\x01ACTION waves: hi\x01"},
+			ok:   true,
+		},
+		{
+			name: "no prefix",
+			line: "PING :tmi.twitch.tv",
+			want: Message{Tags: map[string]string{}, Command: "PING", Trailing: "tmi.twitch.tv"},
+			ok:   true,
+		},
+		{
+			name: "numeric with several params",
+			line: ":bot.tmi.twitch.tv 366 bot #streamer :End of /NAMES list",
+			want: Message{Tags: map[string]string{}, Prefix: "bot.tmi.twitch.tv", Command: "366", Params: []string{"bot", "#streamer"}, Trailing: "End of /NAMES list"},
+			ok:   true,
+		},
+		{
+			name: "lowercase command",
+			line: ":tmi.twitch.tv reconnect",
+			want: Message{Tags: map[string]string{}, Prefix: "tmi.twitch.tv", Command: "RECONNECT", Params: []string{}},
+			ok:   true,
+		},
+		{name: "empty", line: "", ok: false},
+		{name: "tags only", line: "@badges=", ok: false},
+		{name: "prefix only", line: ":tmi.twitch.tv", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := parseMessage(tt.line)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !maps.Equal(got.Tags, tt.want.Tags) || got.Prefix != tt.want.Prefix || got.Command != tt.want.Command ||
+			!slices.Equal(got.Params, tt.want.Params) || got.Trailing != tt.want.Trailing {
+			t.Errorf("%s: parseMessage(%q)\n got %+v\nwant %+v", tt.name, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMessageNickAndChannel(t *testing.T) {
+	tests := []struct {
+		line, nick, channel string
+	}{
+		{":alice!alice@alice.tmi.twitch.tv PRIVMSG #streamer :hi", "alice", "streamer"},
+		{":tmi.twitch.tv CLEARCHAT #streamer :bob", "tmi.twitch.tv", "streamer"},
+		{"PING :tmi.twitch.tv", "", ""},
+	}
+	for _, tt := range tests {
+		msg, _ := parseMessage(tt.line)
+		if msg.Nick() != tt.nick || msg.Channel() != tt.channel {
+			t.Errorf("%q: nick %q channel %q, want %q %q", tt.line, msg.Nick(), msg.Channel(), tt.nick, tt.channel)
+		}
+	}
+}
+
+func TestStripAction(t *testing.T) {
+	tests := []struct {
+		text, want string
+		action     bool
+	}{
+		{"\x01ACTION waves\x01", "waves", true},
+		{"\x01ACTION !rank\x01", "!rank", true},
+		{"\x01ACTION unterminated", "unterminated", true},
+		{"plain message", "plain message", false},
+		{"\x01VERSION\x01", "\x01VERSION\x01", false},
+	}
+	for _, tt := range tests {
+		got, action := stripAction(tt.text)
+		if got != tt.want || action != tt.action {
+			t.Errorf("stripAction(%q) = %q, %v; want %q, %v", tt.text, got, action, tt.want, tt.action)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	rawLogMaxSize = 10 << 20 // rotate after 10 MB
+	rawLogBackups = 3
+)
+
+// Raw IRC traffic log, nil unless IRC_DEBUG_LOG is set
+var rawLog *rotatingFile
+
+// ---------- Types ----------
+
+// Append-only file that rotates to path.1 ... path.N when it grows too big
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+// ---------- Raw IRC log ----------
+
+// Open the raw traffic log at path; an empty path leaves logging off
+func OpenRawLog(path string) {
+	if path == "" {
+		return
+	}
+	f, err := openRotatingFile(path)
+	if err != nil {
+		log.Printf("Error opening IRC debug log %s: %v", path, err)
+		return
+	}
+	rawLog = f
+	log.Println("Logging raw IRC traffic to", path)
+}
+
+// Record an inbound ("<") or outbound (">") line, redacting the OAuth token
+func logRaw(direction, line string) {
+	if rawLog == nil {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.HasPrefix(line, "PASS ") {
+		line = "PASS oauth:***"
+	}
+	rawLog.WriteLine(fmt.Sprintf("%s %s %s", time.Now().Format(time.RFC3339Nano), direction, line))
+}
+
+// ---------- Rotation ----------
+func openRotatingFile(path string) (*rotatingFile, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rotatingFile{path: path, file: file, size: info.Size()}, nil
+}
+
+func (r *rotatingFile) WriteLine(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size+int64(len(line))+1 > rawLogMaxSize {
+		if err := r.rotate(); err != nil {
+			log.Printf("Error rotating %s: %v", r.path, err)
+		}
+	}
+	n, err := fmt.Fprintln(r.file, line)
+	if err != nil {
+		log.Printf("Error writing %s: %v", r.path, err)
+	}
+	r.size += int64(n)
+}
+
+// Shift path.N-1 -> path.N ... path -> path.1 and start an empty file
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	for i := rawLogBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.size = 0
+	return nil
+}
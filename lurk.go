@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	maxLurkers = 1000 // per channel; the longest lurking are dropped past this
+
+	defaultLurkResponse     = "is now lurking, enjoy the stream!"
+	defaultWelcomeBackReply = "welcome back! You lurked for {duration}."
+)
+
+// Lurkers per channel, for the current stream only
+var (
+	lurking   = map[string]*lurkList{}
+	lurkingMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+type lurkList struct {
+	StreamStart int64
+	Users       map[string]time.Time // ChatUser.Key -> when they started lurking
+}
+
+// The channel's lurkers, started over when start says a new stream began
+// unless startErr says Helix couldn't tell. Callers look the start up
+// before taking lurkingMu, which they hold for this.
+func lurkersLocked(channel string, start int64, startErr error) *lurkList {
+	l, ok := lurking[channel]
+	if !ok || (startErr == nil && l.StreamStart != start) {
+		l = &lurkList{StreamStart: start, Users: make(map[string]time.Time)}
+		lurking[channel] = l
+	}
+	return l
+}
+
+// Stop u lurking, reporting how long they were this stream
+func endLurk(channel string, u ChatUser, start int64, startErr error) (time.Duration, bool) {
+	lurkingMu.Lock()
+	defer lurkingMu.Unlock()
+	l := lurkersLocked(channel, start, startErr)
+	since, ok := l.Users[u.Key()]
+	if !ok {
+		return 0, false
+	}
+	delete(l.Users, u.Key())
+	return time.Since(since), true
+}
+
+// ---------- !lurk / !unlurk / !lurkers ----------
+func init() {
+	registerBuiltin("lurk", "lurk", 0, "", func(d *Dispatcher, c *CommandContext) {
+		start, err := CachedStreamStart(c.Channel)
+		lurkingMu.Lock()
+		l := lurkersLocked(c.Channel, start, err)
+		if _, ok := l.Users[c.Sender.Key()]; !ok && len(l.Users) >= maxLurkers {
+			var oldestKey string
+			var oldest time.Time
+			for k, t := range l.Users {
+				if oldestKey == "" || t.Before(oldest) {
+					oldestKey, oldest = k, t
+				}
+			}
+			delete(l.Users, oldestKey)
+		}
+		l.Users[c.Sender.Key()] = time.Now()
+		lurkingMu.Unlock()
+
+		if len(c.Config.Response) == 0 {
+			c.Config.Response = Responses{defaultLurkResponse}
+		}
+		c.Reply(renderTemplate(d.pickResponse(c), map[string]string{"user": c.Sender.Name(), "channel": c.Channel}))
+	})
+
+	registerBuiltin("unlurk", "unlurk", 0, "", func(d *Dispatcher, c *CommandContext) {
+		start, err := CachedStreamStart(c.Channel)
+		lurked, ok := endLurk(c.Channel, c.Sender, start, err)
+		if !ok {
+			c.Reply("you weren't lurking!")
+			return
+		}
+		welcomeBack(d, c, lurked)
+	})
+
+	registerBuiltin("lurkers", "lurkers", 10, "moderator", func(d *Dispatcher, c *CommandContext) {
+		start, err := CachedStreamStart(c.Channel)
+		lurkingMu.Lock()
+		n := len(lurkersLocked(c.Channel, start, err).Users)
+		lurkingMu.Unlock()
+		c.Reply(fmt.Sprintf("%s lurking this stream", plural(n, "viewer is", "viewers are")))
+	})
+}
+
+// Called by the dispatcher for every chat message: a lurker who chats is no
+// longer lurking, and is welcomed back unless LURK_WELCOME_BACK=0. Lurk
+// commands themselves are left to their handlers.
+func (d *Dispatcher) returnFromLurk(msg Message, u ChatUser, text string) {
+	channel := msg.Channel()
+	lurkingMu.Lock()
+	l, ok := lurking[channel]
+	if ok {
+		_, ok = l.Users[u.Key()]
+	}
+	lurkingMu.Unlock()
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	_, cfg, _, isCommand := d.config.lookup(text)
+	trigger, unlurk, hasUnlurk := d.config.builtin("unlurk")
+	d.mu.Unlock()
+	if isCommand && cfg.Type == "builtin" && (cfg.Endpoint == "lurk" || cfg.Endpoint == "unlurk") {
+		return
+	}
+
+	// on the IRC read loop, so only the stream start already known
+	start, err := knownStreamStart(channel)
+	lurked, ok := endLurk(channel, u, start, err)
+	if !ok || os.Getenv("LURK_WELCOME_BACK") == "0" || !hasUnlurk || !unlurk.IsEnabled() {
+		return
+	}
+	c := &CommandContext{Msg: msg, Sender: u, Channel: channel, Command: trigger, Config: unlurk}
+	c.reply = func(text string) { d.respond(msg, u, unlurk, text) }
+	welcomeBack(d, c, lurked)
+}
+
+// Reply with the unlurk command's response, or the default, with
+// {duration} filled in
+func welcomeBack(d *Dispatcher, c *CommandContext, lurked time.Duration) {
+	if len(c.Config.Response) == 0 {
+		c.Config.Response = Responses{defaultWelcomeBackReply}
+	}
+	c.Reply(renderTemplate(d.pickResponse(c), map[string]string{
+		"user":     c.Sender.Name(),
+		"channel":  c.Channel,
+		"duration": formatDuration(lurked),
+	}))
+}
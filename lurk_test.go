@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLurkersLocked(t *testing.T) {
+	const stream = 1760464800
+	tests := []struct {
+		name     string
+		start    int64
+		startErr error
+		kept     bool // the lurker from the stream before is still there
+	}{
+		{"same stream", stream, nil, true},
+		{"new stream", stream + 3600, nil, false},
+		{"went offline", 0, nil, false},
+		{"Helix couldn't say", 0, errors.New("helix streams: status 503"), true},
+	}
+	for _, tt := range tests {
+		lurkingMu.Lock()
+		lurking["streamer"] = &lurkList{StreamStart: stream, Users: map[string]time.Time{"1": time.Now()}}
+		_, kept := lurkersLocked("streamer", tt.start, tt.startErr).Users["1"]
+		delete(lurking, "streamer")
+		lurkingMu.Unlock()
+		if kept != tt.kept {
+			t.Errorf("%s: lurker kept %v, want %v", tt.name, kept, tt.kept)
+		}
+	}
+}
@@ -1,185 +1,174 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
 	"log"
-	"net"
 	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 )
 
-type CommandConfig struct {
-	Type     string `json:"type"`
-	Response string `json:"response,omitempty"`
-	Endpoint string `json:"endpoint,omitempty"`
-	Cooldown int    `json:"cooldown"`
-}
+const commandsFile = "commands.json"
 
-func loadCommands(path string) map[string]CommandConfig {
-	file, err := os.ReadFile(path)
-	if err != nil {
-		log.Fatal("Error reading commands.json:", err)
-	}
-
-	var commands map[string]CommandConfig
-	if err := json.Unmarshal(file, &commands); err != nil {
-		log.Fatal("Error parsing commands.json:", err)
-	}
+// Lowercased logins whose messages are never treated as commands
+var ignoredUsers = map[string]bool{}
 
-	normalizedCommands := make(map[string]CommandConfig)
-	for k, v := range commands {
-		// lowercase + trim spaces + remove non-ASCII characters
-		cleanKey := strings.ToLower(strings.TrimSpace(k))
-		cleanKey = strings.Map(func(r rune) rune {
-			if r > 127 { // remove non-ASCII
-				return -1
-			}
-			return r
-		}, cleanKey)
-		normalizedCommands[cleanKey] = v
+func main() {
+	readOnlyFlag := flag.Bool("read-only", false, "connect anonymously and log responses instead of sending them")
+	checkFlag := flag.Bool("check", false, "validate "+commandsFile+" and exit")
+	authorizeFlag := flag.Bool("authorize", false, "log in a Twitch account for features that need a user token, then exit")
+	flag.Parse()
+
+	if *checkFlag {
+		checkConfig()
+		return
 	}
-
-	fmt.Println("Loaded commands:")
-	for k := range normalizedCommands {
-		fmt.Printf("[%q]\n", k)
+	if *authorizeFlag {
+		godotenv.Load()
+		userTokens = NewUserTokenStore(userTokensFile)
+		if err := authorizeUser(); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	commands = normalizedCommands
-
-	return commands
-}
-
-func say(conn net.Conn, channel, msg string) {
-	fmt.Fprintf(conn, "PRIVMSG #%s :%s\r\n", channel, msg)
-}
-
-func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, relying on system env vars")
 	}
 
 	username := os.Getenv("TWITCH_BOT_USERNAME")
 	oauth := os.Getenv("TWITCH_OAUTH_TOKEN")
-	channel := os.Getenv("TWITCH_CHANNEL")
+	channels := parseChannels(os.Getenv("TWITCH_CHANNEL"))
 	summoner := os.Getenv("SUMMONER_NAME")
 	tag := os.Getenv("SUMMONER_TAG")
 
-	if username == "" || oauth == "" || channel == "" || summoner == "" {
+	readOnly := *readOnlyFlag || os.Getenv("BOT_READONLY") == "1"
+	if readOnly {
+		// anonymous logins need no token and can read but never send
+		username, oauth = anonymousNick, ""
+		log.Println("Read-only mode: responses will be logged, not sent")
+	}
+
+	if username == "" || (oauth == "" && !readOnly) || len(channels) == 0 || summoner == "" {
 		log.Fatal("Set TWITCH_BOT_USERNAME, TWITCH_OAUTH_TOKEN, TWITCH_CHANNEL, SUMMONER_NAME")
 	}
 
-	puuid, err := GetOrCachePlayer(summoner, tag)
+	loadIgnoredUsers(username)
+	OpenRawLog(os.Getenv("IRC_DEBUG_LOG"))
+
+	accounts, err := parseRiotAccounts(summoner, tag, os.Getenv("SUMMONER_PLATFORM"))
 	if err != nil {
+		log.Fatal(err)
+	}
+	riot := riotAPI{}
+	if err := ValidateRiotToken(); err != nil {
+		log.Fatal(err)
+	}
+	if err := ResolveRiotAccounts(riot, accounts); err != nil {
 		log.Fatalf("Error fetching player: %v", err)
 	}
 
-	commands := loadCommands("commands.json")
-	lastUsed := make(map[string]time.Time)
-
-	StartAppTokenRefresher()
-	LoadChampionMap()
-
-	conn, err := net.Dial("tcp", "irc.chat.twitch.tv:6667")
+	config, err := loadConfig(commandsFile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer conn.Close()
-
-	fmt.Fprintf(conn, "PASS %s\r\n", oauth)
-	fmt.Fprintf(conn, "NICK %s\r\n", username)
-	fmt.Fprintf(conn, "JOIN #%s\r\n", channel)
-
-	log.Println("Connected to Twitch IRC as", username)
+	counters = NewCounterStore(countersFile)
+	commandStats = NewCommandStats(commandStatsFile)
+	quotes = NewQuoteStore(quotesFile)
+	queues = NewQueueStore(queueFile)
+	userLimits = NewUserCommandLimiter()
+	watchTimes = NewUserStore[watchData](watchTimeFile)
+	userTokens = NewUserTokenStore(userTokensFile)
+	blockedUsers = NewUserStore[blockEntry](blockedUsersFile)
+	firstChats = NewFirstChatStore(firstChatFile)
+	firstChatCounts = NewUserStore[int](firstChatCountsFile)
+	points = NewPointsStore(pointsFile)
+	rankSnapshots = NewRankSnapshotStore(rankSnapshotsFile)
+	matches = NewMatchStore(matchesFile, accounts)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	StartAppTokenRefresher(ctx)
+	go RunStreamStartRefresher(ctx, channels)
+	StartSender()
+	if err := LoadChampionMap(); err != nil {
+		log.Printf("Error loading champions: %v", err)
+	}
+	StartChampionRefresher(ctx)
+
+	bot := NewBot(username, oauth, channels)
+	bot.ReadOnly = readOnly
+
+	bot.On("USERSTATE", func(m Message) { updateUserState(m.Channel(), m.Tags) })
+	bot.On("ROOMSTATE", func(m Message) { updateRoomState(m.Channel(), m.Tags) })
+	bot.On("CLEARCHAT", handleClearChat)
+	bot.On("CLEARMSG", handleClearMsg)
+
+	dispatcher := NewDispatcher(bot, riot, helixAPI{}, accounts, config)
+	dispatcher.LoadCooldowns(cooldownsFile)
+	go dispatcher.RunCooldownSaver(ctx, cooldownsFile)
+	go dispatcher.RunPlayerRefresher(ctx)
+	go dispatcher.RunModeration(ctx)
+	bot.OnMessage(dispatcher.HandleMessage)
+	bot.OnUserNotice(dispatcher.HandleUserNotice)
+	go WatchConfig(ctx, commandsFile, dispatcher)
+
+	timers := NewTimerRunner(bot, dispatcher)
+	bot.OnMessage(timers.CountLine)
+	go timers.Run(ctx)
+
+	watching := NewWatchTimeTracker(bot)
+	bot.OnMessage(watching.Seen)
+	go watching.Run(ctx)
+
+	bets = NewBetTracker(dispatcher, betsFile)
+	go bets.Run(ctx)
+	go RunRankSnapshots(ctx, bot, accounts)
+
+	bot.Run(ctx)
+	stopCountdowns()
+	dispatcher.SaveCooldowns(cooldownsFile)
+	points.Flush()
+	watchTimes.Flush()
+	firstChatCounts.Flush()
+	blockedUsers.Flush()
+}
 
-	reader := bufio.NewReader(conn)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			log.Println("Read error:", err)
-			return
-		}
-		line = strings.TrimSpace(line)
+// --check: validate commands.json without connecting, exiting 1 on problems
+func checkConfig() {
+	godotenv.Load() // COMMAND_PREFIX affects how triggers are read
+	config, err := loadConfig(commandsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid: %d commands, %d events, %d timers\n",
+		commandsFile, len(config.Commands), len(config.Events), len(config.Timers))
+}
 
-		if strings.HasPrefix(line, "PING") {
-			fmt.Fprintf(conn, "PONG :tmi.twitch.tv\r\n")
-			continue
+// Ignore the bot itself plus the comma-separated IGNORED_USERS (other bots)
+func loadIgnoredUsers(botName string) {
+	ignoredUsers[strings.ToLower(botName)] = true
+	for _, u := range strings.Split(os.Getenv("IGNORED_USERS"), ",") {
+		if u = strings.ToLower(strings.TrimSpace(u)); u != "" {
+			ignoredUsers[u] = true
 		}
+	}
+}
 
-		if strings.Contains(line, "PRIVMSG") {
-			parts := strings.Split(line, "PRIVMSG")
-			if len(parts) < 2 {
-				continue
-			}
-			rawUser := strings.Split(parts[0], "!")[0]
-			user := strings.TrimPrefix(rawUser, ":")
-			msg := strings.SplitN(parts[1], ":", 2)[1]
-			command := strings.ToLower(strings.TrimSpace(msg))
-			command = strings.Map(func(r rune) rune {
-				if r > 127 { // remove non-ASCII
-					return -1
-				}
-				return r
-			}, command)
-			cfg, ok := commands[command]
-			fmt.Printf("Received: [%q]\n", msg)
-			if !ok {
-				fmt.Println("User:", user, "Message:", msg, "Command key found:", ok)
-				continue
-			}
-
-			if t, ok := lastUsed[command]; ok {
-				if time.Since(t) < time.Duration(cfg.Cooldown)*time.Second {
-					continue
-				}
-			}
-
-			switch cfg.Type {
-			case "static":
-				say(conn, channel, fmt.Sprintf("@%s %s", user, cfg.Response))
-			case "api":
-				switch cfg.Endpoint {
-				case "twitch_stream_info":
-					title, game, err := GetTwitchStreamInfo(channel)
-					if err != nil {
-						say(conn, channel, fmt.Sprintf("@%s Error fetching stream info.", user))
-					} else if title == "Offline" {
-						say(conn, channel, fmt.Sprintf("@%s Stream is offline.", user))
-					} else {
-						say(conn, channel, fmt.Sprintf("@%s Title: %s | Game: %s", user, title, game))
-					}
-				case "riot_rank_info":
-					rank, err := GetCurrentRank(puuid)
-					if err != nil {
-						log.Printf("Rank error: %v", err)
-					}
-					say(conn, channel, fmt.Sprintf("@%s Current Rank: %s %s %d", user, rank[0].Tier, rank[0].Rank, rank[0].LeaguePoints))
-				case "stream_stats_info":
-					start, err := GetTwitchStreamStart(channel)
-					if err != nil {
-						say(conn, channel, fmt.Sprintf("@%s Error fetching stream info.", user))
-					}
-					stats, err := GetStreamStats(puuid, start)
-					if err != nil {
-						say(conn, channel, fmt.Sprintf("@%s Error Fetching stream stats.", user))
-					} else {
-						say(conn, channel, fmt.Sprintf("@%s Wins: %d | Loss: %d | Winrate: %.2f%% ", user, stats.Wins, stats.Losses, stats.Winrate))
-					}
-				case "current_bans_info":
-					bans, err := GetActiveMatchBans(puuid)
-					if err != nil {
-						say(conn, channel, fmt.Sprintf("@%s Not in an Active Match", user))
-					} else {
-						banString := strings.Join(bans, ", ")
-						say(conn, channel, fmt.Sprintf("@%s Banned Champions: %s", user, banString))
-					}
-				}
-			}
-
-			lastUsed[command] = time.Now()
+// Parse the comma-separated TWITCH_CHANNEL value into channel logins
+func parseChannels(raw string) []string {
+	var channels []string
+	for _, c := range strings.Split(raw, ",") {
+		c = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(c), "#"))
+		if c != "" {
+			channels = append(channels, c)
 		}
 	}
+	return channels
 }
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	matchesFile          = "matches.json"
+	matchCacheRetention  = 90 * 24 * time.Hour
+	matchCachePruneEvery = 24 * time.Hour
+)
+
+// Matches already fetched, opened in main
+var matches *MatchStore
+
+// ---------- Types ----------
+
+// The parts of a match-v5 match the bot uses
+type Match struct {
+	Metadata struct {
+		MatchID string `json:"matchId"`
+	} `json:"metadata"`
+	Info struct {
+		GameCreation     int64              `json:"gameCreation"`     // unix millis
+		GameDuration     int64              `json:"gameDuration"`     // seconds
+		GameEndTimestamp int64              `json:"gameEndTimestamp"` // unix millis
+		QueueID          int                `json:"queueId"`
+		Participants     []MatchParticipant `json:"participants"`
+	} `json:"info"`
+}
+
+type MatchParticipant struct {
+	PUUID                     string `json:"puuid"`
+	ChampionID                int    `json:"championId"`
+	ChampionName              string `json:"championName"`
+	TeamID                    int    `json:"teamId"`
+	Kills                     int    `json:"kills"`
+	Deaths                    int    `json:"deaths"`
+	Assists                   int    `json:"assists"`
+	TotalMinionsKilled        int    `json:"totalMinionsKilled"`
+	NeutralMinionsKilled      int    `json:"neutralMinionsKilled"`
+	Win                       bool   `json:"win"`
+	GameEndedInEarlySurrender bool   `json:"gameEndedInEarlySurrender"` // a remake, or a surrender at 15
+}
+
+// JSON file of finished matches by id, which never change, so stream stats
+// and !lastgame fetch each match once even across restarts. Only the
+// streamer's accounts are kept of the participants, and matches older than
+// matchCacheRetention are dropped.
+type MatchStore struct {
+	mu        sync.Mutex
+	path      string
+	puuids    map[string]bool // accounts whose participants are kept
+	matches   map[string]*Match
+	lastPrune time.Time
+	dirty     bool // matches changed since the last save
+
+	saveMu sync.Mutex // keeps an older snapshot from overwriting a newer one
+}
+
+func NewMatchStore(path string, accounts []RiotAccount) *MatchStore {
+	s := &MatchStore{path: path, puuids: map[string]bool{}, matches: make(map[string]*Match)}
+	for _, a := range accounts {
+		s.puuids[a.PUUID] = true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.matches); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// puuid's participant, nil if they weren't in the match
+func (m *Match) Participant(puuid string) *MatchParticipant {
+	for i := range m.Info.Participants {
+		if m.Info.Participants[i].PUUID == puuid {
+			return &m.Info.Participants[i]
+		}
+	}
+	return nil
+}
+
+// A remake, which counts as neither a win nor a loss: ended by an early
+// surrender before remakeThreshold. The flag alone also covers an early
+// surrender vote at 15 minutes, which is a real loss.
+func (m *Match) IsRemake(p *MatchParticipant) bool {
+	return p.GameEndedInEarlySurrender && m.Info.GameDuration < remakeThreshold
+}
+
+// ---------- Fetching ----------
+
+var errMatchNotFound = errors.New("match not found")
+
+// The match with this id, errMatchNotFound while match-v5 doesn't have it
+func GetMatch(matchID string, maxWait time.Duration) (*Match, error) {
+	m, err := fetchMatch(matchID, maxWait)
+	matches.save()
+	return m, err
+}
+
+// GetMatch without saving matches.json, for fetching several at once
+func fetchMatch(matchID string, maxWait time.Duration) (*Match, error) {
+	if m, ok := matches.get(matchID); ok {
+		return m, nil
+	}
+
+	data, err := makeRoutedRequest(matchRoute(matchID), "regional", "/lol/match/v5/matches/"+url.PathEscape(matchID), maxWait)
+	if err != nil {
+		if isRiotStatus(err, http.StatusNotFound) {
+			return nil, errMatchNotFound
+		}
+		return nil, err
+	}
+	var m Match
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return matches.put(matchID, &m), nil
+}
+
+func (s *MatchStore) get(matchID string) (*Match, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.matches[matchID]
+	return m, ok
+}
+
+// Keep m with only the streamer's participants, returning what was kept.
+// It's written to disk by the next save.
+func (s *MatchStore) put(matchID string, m *Match) *Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.Info.Participants = slices.DeleteFunc(m.Info.Participants, func(p MatchParticipant) bool { return !s.puuids[p.PUUID] })
+	s.matches[matchID] = m
+	s.dirty = true
+
+	if now := time.Now(); now.Sub(s.lastPrune) >= matchCachePruneEvery {
+		s.lastPrune = now
+		cutoff := now.Add(-matchCacheRetention).UnixMilli()
+		for id, old := range s.matches {
+			if old.Info.GameCreation < cutoff {
+				delete(s.matches, id)
+			}
+		}
+	}
+	return m
+}
+
+// Write matches.json if anything was put since the last save. Only the
+// snapshot is taken under s.mu, so lookups don't wait on the disk.
+func (s *MatchStore) save() {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(s.matches)
+	s.dirty = false
+	s.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+}
+
+// Matches FetchMatches fetches at once. Each still goes through the rate
+// limiter, so a cold cache only brings the wait forward.
+const matchFetchWorkers = 4
+
+// GetMatch for each id, in the same order, nil where a fetch failed.
+// matches.json is saved once, after the last of them.
+func FetchMatches(ids []string, maxWait time.Duration) []*Match {
+	start := time.Now()
+	fetched := make([]*Match, len(ids))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(matchFetchWorkers, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if m, err := fetchMatch(ids[i], maxWait); err == nil {
+					fetched[i] = m
+				}
+			}
+		}()
+	}
+	for i := range ids {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	matches.save()
+	if len(ids) > 0 {
+		log.Printf("Fetched %d matches in %s", len(ids), time.Since(start).Round(time.Millisecond))
+	}
+	return fetched
+}
+
+// Ids of the account's most recent matches in queue (or allQueues), newest
+// first
+func GetMatchIDs(a RiotAccount, count, queue int) ([]string, error) {
+	path := fmt.Sprintf("/lol/match/v5/matches/by-puuid/%s/ids?count=%d", url.PathEscape(a.PUUID), count)
+	if queue != allQueues {
+		path += fmt.Sprintf("&queue=%d", queue)
+	}
+	data, err := makeRoutedRequest(a.Route, "regional", path, riotChatWait)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// ---------- Match result ----------
+
+// How a finished match went for puuid. found is false while match-v5 doesn't
+// have the match yet, which lasts a minute or so after the game ends.
+type MatchResult struct {
+	Win    bool
+	Remake bool // ended by an early surrender, so it doesn't count
+}
+
+func GetMatchResult(matchID, puuid string, maxWait time.Duration) (result MatchResult, found bool, err error) {
+	m, err := GetMatch(matchID, maxWait)
+	if errors.Is(err, errMatchNotFound) {
+		return MatchResult{}, false, nil
+	}
+	if err != nil {
+		return MatchResult{}, false, err
+	}
+	p := m.Participant(puuid)
+	if p == nil {
+		return MatchResult{}, false, fmt.Errorf("%s isn't in match %s", puuid, matchID)
+	}
+	return MatchResult{Win: p.Win, Remake: m.IsRemake(p)}, true, nil
+}
+
+// ---------- Last match ----------
+
+// The most recent match any of the accounts played, with the account's
+// participant. nil when none of them has played a match.
+func GetLastMatch(accounts []RiotAccount) (*Match, *MatchParticipant, error) {
+	var latest *Match
+	var player *MatchParticipant
+	for _, a := range accounts {
+		ids, err := GetMatchIDs(a, 1, allQueues)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		m, err := GetMatch(ids[0], riotChatWait)
+		if err != nil {
+			return nil, nil, err
+		}
+		if latest == nil || m.Info.GameCreation > latest.Info.GameCreation {
+			latest, player = m, m.Participant(a.PUUID)
+		}
+	}
+	if latest != nil && player == nil {
+		return nil, nil, fmt.Errorf("account isn't in match %s", latest.Metadata.MatchID)
+	}
+	return latest, player, nil
+}
+
+// "Ahri 8/2/11, 215 CS, 31:12 Ranked Solo/Duo - Win"
+func describeMatch(m *Match, p *MatchParticipant) string {
+	result := "Loss"
+	switch {
+	case m.IsRemake(p):
+		result = "Remake"
+	case p.Win:
+		result = "Win"
+	}
+	champion := p.ChampionName
+	if champion == "" {
+		champion = GetChampionName(p.ChampionID)
+	}
+	return fmt.Sprintf("Last game: %s %d/%d/%d, %d CS, %d:%02d %s - %s", champion, p.Kills, p.Deaths, p.Assists,
+		p.TotalMinionsKilled+p.NeutralMinionsKilled, m.Info.GameDuration/60, m.Info.GameDuration%60,
+		queueName(m.Info.QueueID), result)
+}
+
+// ---------- Streak ----------
+
+const (
+	streakMatches   = 10
+	remakeThreshold = 5 * 60 // seconds; shorter games are remakes
+)
+
+// Whether the account won each of its recent ranked solo games, newest first
+func GetRecentResults(a RiotAccount) ([]bool, error) {
+	ids, err := GetMatchIDs(a, streakMatches, soloQueueID)
+	if err != nil {
+		return nil, err
+	}
+	var wins []bool
+	for _, m := range FetchMatches(ids, riotChatWait) {
+		if m == nil {
+			continue
+		}
+		if p := m.Participant(a.PUUID); p != nil && !m.IsRemake(p) {
+			wins = append(wins, p.Win)
+		}
+	}
+	return wins, nil
+}
+
+// "On a 4 game win streak | WWWWL WLLWW", newest game first
+func describeStreak(wins []bool) string {
+	if len(wins) == 0 {
+		return "No recent ranked games."
+	}
+	n := 1
+	for n < len(wins) && wins[n] == wins[0] {
+		n++
+	}
+	var streak string
+	switch {
+	case n == 1 && wins[0]:
+		streak = "Won the last game"
+	case n == 1:
+		streak = "Lost the last game"
+	case wins[0]:
+		streak = fmt.Sprintf("On a %d game win streak", n)
+	default:
+		streak = fmt.Sprintf("%d losses in a row, send help", n)
+	}
+	var b strings.Builder
+	for i, w := range wins {
+		if i > 0 && i%5 == 0 {
+			b.WriteByte(' ')
+		}
+		if w {
+			b.WriteByte('W')
+		} else {
+			b.WriteByte('L')
+		}
+	}
+	return streak + " | " + b.String()
+}
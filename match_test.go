@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// A finished match of duration seconds with p as the only participant kept
+func testMatch(duration int64, p MatchParticipant) *Match {
+	m := &Match{}
+	m.Info.GameDuration = duration
+	m.Info.Participants = []MatchParticipant{p}
+	return m
+}
+
+func TestIsRemake(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  int64
+		surrender bool
+		want      bool
+	}{
+		{"remake", 3*60 + 20, true, true},
+		{"short game without a vote", 4 * 60, false, false},
+		{"surrender at 15", 15 * 60, true, false},
+		{"just past the threshold", remakeThreshold, true, false},
+		{"full game", 32 * 60, false, false},
+	}
+	for _, tt := range tests {
+		m := testMatch(tt.duration, MatchParticipant{PUUID: "main-puuid", GameEndedInEarlySurrender: tt.surrender})
+		if got := m.IsRemake(&m.Info.Participants[0]); got != tt.want {
+			t.Errorf("%s: IsRemake = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTallyMatches(t *testing.T) {
+	win := func(champ string, k, d, a int) *Match {
+		return testMatch(30*60, MatchParticipant{PUUID: "main-puuid", ChampionName: champ, Kills: k, Deaths: d, Assists: a, Win: true})
+	}
+	loss := func(puuid, champ string, k, d, a int) *Match {
+		return testMatch(25*60, MatchParticipant{PUUID: puuid, ChampionName: champ, Kills: k, Deaths: d, Assists: a})
+	}
+	remake := testMatch(3*60, MatchParticipant{PUUID: "main-puuid", ChampionName: "Teemo", Kills: 1, GameEndedInEarlySurrender: true})
+
+	tests := []struct {
+		name    string
+		matches []*Match
+		want    StreamStatsCacheEntry
+	}{
+		{
+			name: "no games",
+			want: StreamStatsCacheEntry{},
+		},
+		{
+			name:    "remake left out",
+			matches: []*Match{win("Ahri", 8, 2, 5), remake, loss("main-puuid", "Ahri", 2, 6, 3)},
+			want: StreamStatsCacheEntry{
+				Wins: 1, Losses: 1, Winrate: 50, Remakes: 1,
+				Kills: 10, Deaths: 8, Assists: 8,
+				Champions: []ChampionRecord{{Name: "Ahri", Wins: 1, Losses: 1}},
+			},
+		},
+		{
+			name:    "only remakes",
+			matches: []*Match{remake, remake},
+			want:    StreamStatsCacheEntry{Remakes: 2},
+		},
+		{
+			name:    "second account and failed fetches",
+			matches: []*Match{win("Ahri", 5, 1, 7), nil, loss("smurf-puuid", "Zed", 3, 4, 1), win("Lux", 2, 0, 9)},
+			want: StreamStatsCacheEntry{
+				Wins: 2, Losses: 1, Winrate: 2.0 / 3 * 100,
+				Kills: 10, Deaths: 5, Assists: 17,
+				Champions: []ChampionRecord{{Name: "Ahri", Wins: 1}, {Name: "Lux", Wins: 1}, {Name: "Zed", Losses: 1}},
+			},
+		},
+		{
+			name:    "someone else's match",
+			matches: []*Match{loss("stranger-puuid", "Yasuo", 0, 10, 0)},
+			want:    StreamStatsCacheEntry{},
+		},
+	}
+	for _, tt := range tests {
+		got := tallyMatches(tt.matches, []string{"main-puuid", "smurf-puuid"})
+		if got.Wins != tt.want.Wins || got.Losses != tt.want.Losses || got.Remakes != tt.want.Remakes || math.Abs(got.Winrate-tt.want.Winrate) > 1e-9 {
+			t.Errorf("%s: %d-%d, %d remakes, %.2f%%; want %d-%d, %d remakes, %.2f%%", tt.name,
+				got.Wins, got.Losses, got.Remakes, got.Winrate, tt.want.Wins, tt.want.Losses, tt.want.Remakes, tt.want.Winrate)
+		}
+		if got.Kills != tt.want.Kills || got.Deaths != tt.want.Deaths || got.Assists != tt.want.Assists {
+			t.Errorf("%s: KDA %d/%d/%d, want %d/%d/%d", tt.name,
+				got.Kills, got.Deaths, got.Assists, tt.want.Kills, tt.want.Deaths, tt.want.Assists)
+		}
+		if !slices.Equal(got.Champions, tt.want.Champions) {
+			t.Errorf("%s: champions %v, want %v", tt.name, got.Champions, tt.want.Champions)
+		}
+	}
+}
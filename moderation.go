@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+var (
+	modActions   = map[string]*modActionCounts{}
+	modActionsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// Moderation actions seen in a channel during the current stream
+type modActionCounts struct {
+	StreamStart int64
+	Timeouts    int
+	Bans        int
+	Deletions   int
+}
+
+// ---------- Handlers ----------
+
+// CLEARCHAT: a timeout or ban when a user is given, otherwise a full chat clear
+func handleClearChat(msg Message) {
+	channel := msg.Channel()
+	target := msg.Trailing
+	if target == "" {
+		log.Printf("[#%s] Chat was cleared by a moderator", channel)
+		return
+	}
+
+	targetID := msg.Tags["target-user-id"]
+	if duration := msg.Tags["ban-duration"]; duration != "" {
+		log.Printf("[#%s] %s (id %s) timed out for %ss", channel, target, targetID, duration)
+		recordModAction(channel, func(c *modActionCounts) { c.Timeouts++ })
+	} else {
+		log.Printf("[#%s] %s (id %s) banned", channel, target, targetID)
+		recordModAction(channel, func(c *modActionCounts) { c.Bans++ })
+	}
+}
+
+// CLEARMSG: a single message was deleted
+func handleClearMsg(msg Message) {
+	channel := msg.Channel()
+	log.Printf("[#%s] Message from %s deleted: %q", channel, msg.Tags["login"], msg.Trailing)
+	recordModAction(channel, func(c *modActionCounts) { c.Deletions++ })
+}
+
+// Apply update to the channel's counts, starting fresh when a new stream began
+func recordModAction(channel string, update func(*modActionCounts)) {
+	start, err := CachedStreamStart(channel)
+
+	modActionsMu.Lock()
+	defer modActionsMu.Unlock()
+	counts, ok := modActions[channel]
+	if !ok || (err == nil && counts.StreamStart != start) {
+		counts = &modActionCounts{StreamStart: start}
+		modActions[channel] = counts
+	}
+	update(counts)
+}
+
+// Moderation counts for the channel's current stream
+func GetModerationStats(channel string) modActionCounts {
+	start, err := CachedStreamStart(channel)
+
+	modActionsMu.Lock()
+	defer modActionsMu.Unlock()
+	counts, ok := modActions[channel]
+	if !ok || (err == nil && counts.StreamStart != start) {
+		return modActionCounts{StreamStart: start}
+	}
+	return *counts
+}
+
+// "3 timeouts, 1 ban, 2 deleted messages"
+func (c modActionCounts) String() string {
+	return fmt.Sprintf("%s, %s, %s",
+		plural(c.Timeouts, "timeout", "timeouts"),
+		plural(c.Bans, "ban", "bans"),
+		plural(c.Deletions, "deleted message", "deleted messages"))
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, singular)
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
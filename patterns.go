@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ---------- Config & Globals ----------
+const (
+	maxPatternLength   = 200
+	maxPatternCommands = 50
+)
+
+// A "regex" or "contains" command, compiled when commands.json is loaded
+type patternCommand struct {
+	Name   string
+	Regexp *regexp.Regexp // match "regex"
+	Substr string         // match "contains", lowercased
+}
+
+func isPatternMatch(match string) bool {
+	return match == "regex" || match == "contains"
+}
+
+// ---------- Loading ----------
+
+// Compile every pattern command in config, in name order so the first match
+// is stable across reloads, returning any problems found
+func compilePatterns(config *BotConfig) []string {
+	var names []string
+	for name, cfg := range config.Commands {
+		if isPatternMatch(cfg.Match) {
+			names = append(names, name)
+		}
+	}
+	var problems []string
+	if len(names) > maxPatternCommands {
+		problems = append(problems, fmt.Sprintf("%d regex/contains commands, at most %d are allowed", len(names), maxPatternCommands))
+		names = names[:0]
+	}
+	sort.Strings(names)
+
+	config.patterns = nil
+	for _, name := range names {
+		cfg := config.Commands[name]
+		if cfg.Pattern == "" {
+			problems = append(problems, fmt.Sprintf("command %q: match %q needs a pattern", name, cfg.Match))
+			continue
+		}
+		if len(cfg.Pattern) > maxPatternLength {
+			problems = append(problems, fmt.Sprintf("command %q: pattern is longer than %d characters", name, maxPatternLength))
+			continue
+		}
+
+		p := patternCommand{Name: name}
+		if cfg.Match == "regex" {
+			re, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("command %q: invalid pattern: %v", name, err))
+				continue
+			}
+			p.Regexp = re
+		} else {
+			p.Substr = strings.ToLower(cleanText(cfg.Pattern))
+		}
+		config.patterns = append(config.patterns, p)
+	}
+	return problems
+}
+
+// ---------- Matching ----------
+
+// First pattern command matching msg. A regex's capture groups become the
+// arguments, so {1} is the first group.
+func (c *BotConfig) matchPattern(msg string) (string, CommandConfig, []string, bool) {
+	lower := strings.ToLower(msg)
+	for _, p := range c.patterns {
+		if p.Regexp != nil {
+			if m := p.Regexp.FindStringSubmatch(msg); m != nil {
+				return p.Name, c.Commands[p.Name], m[1:], true
+			}
+		} else if strings.Contains(lower, p.Substr) {
+			return p.Name, c.Commands[p.Name], nil, true
+		}
+	}
+	return "", CommandConfig{}, nil, false
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// ---------- Permission levels ----------
+
+// Command permission levels, lowest first. Each level also admits everyone
+// above it, so the broadcaster can run anything.
+var permissionLevels = map[string]int{
+	"everyone":    0,
+	"subscriber":  1,
+	"vip":         2,
+	"moderator":   3,
+	"broadcaster": 4,
+}
+
+// Highest level the user holds
+func userLevel(u ChatUser) int {
+	switch {
+	case u.IsBroadcaster:
+		return permissionLevels["broadcaster"]
+	case u.IsMod:
+		return permissionLevels["moderator"]
+	case u.IsVIP:
+		return permissionLevels["vip"]
+	case u.IsSubscriber:
+		return permissionLevels["subscriber"]
+	}
+	return permissionLevels["everyone"]
+}
+
+// Whether the user may run a command requiring permission. An empty
+// permission means everyone; an unknown one locks the command to the
+// broadcaster rather than opening it up.
+func hasPermission(u ChatUser, permission string) bool {
+	return userLevel(u) >= permissionRank(permission)
+}
+
+func permissionRank(permission string) int {
+	if permission == "" {
+		return permissionLevels["everyone"]
+	}
+	required, ok := permissionLevels[strings.ToLower(permission)]
+	if !ok {
+		log.Printf("Unknown permission %q, allowing the broadcaster only", permission)
+		return permissionLevels["broadcaster"]
+	}
+	return required
+}
+
+// Permission a command needs. A built-in keeps the level it was registered
+// with even when commands.json overrides its entry with a lower one.
+func requiredPermission(cfg CommandConfig) string {
+	b, ok := builtinCommands[cfg.Endpoint]
+	if cfg.Type != "builtin" || !ok || permissionRank(b.Config.Permission) <= permissionRank(cfg.Permission) {
+		return cfg.Permission
+	}
+	return b.Config.Permission
+}
+
+// Whether the user skips the command's cooldown. The level comes from the
+// command's cooldown_exempt, then COOLDOWN_EXEMPT, and defaults to
+// moderator so mods and the broadcaster are never held up; "none" turns
+// the exemption off. Their use still starts the cooldown for everyone else.
+func cooldownExempt(u ChatUser, cfg CommandConfig) bool {
+	level := cfg.CooldownExempt
+	if level == "" {
+		level = os.Getenv("COOLDOWN_EXEMPT")
+	}
+	if level == "" {
+		level = "moderator"
+	}
+	if strings.EqualFold(level, "none") {
+		return false
+	}
+	return hasPermission(u, level)
+}
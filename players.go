@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultPlayerCacheDays = 7
+	playerRefreshInterval  = time.Hour
+)
+
+// How long a players.json entry is trusted before it's looked up again,
+// PLAYER_CACHE_TTL_DAYS (7 by default)
+func playerCacheTTL() time.Duration {
+	days := defaultPlayerCacheDays
+	if v := os.Getenv("PLAYER_CACHE_TTL_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("Ignoring invalid PLAYER_CACHE_TTL_DAYS %q", v)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// ---------- Refreshing ----------
+
+// Look the account up again by PUUID, which survives name changes, and
+// update every players.json entry for it
+func RefreshPlayer(a RiotAccount, maxWait time.Duration) (PlayerCacheEntry, error) {
+	p, err := lookupPlayer(a.Route, "/riot/account/v1/accounts/by-puuid/"+url.PathEscape(a.PUUID), maxWait)
+	if err != nil {
+		return PlayerCacheEntry{}, err
+	}
+
+	playerCacheLock.Lock()
+	defer playerCacheLock.Unlock()
+	cache := loadPlayerCache()
+	found := false
+	for key, old := range cache {
+		if old.PUUID == p.PUUID {
+			cache[key] = p
+			found = true
+		}
+	}
+	if !found {
+		cache[a.String()] = p
+	}
+	savePlayerCache(cache)
+	return p, nil
+}
+
+// When the account's players.json entry was last looked up, zero if it has none
+func playerCachedAt(puuid string) time.Time {
+	playerCacheLock.Lock()
+	defer playerCacheLock.Unlock()
+	for _, p := range loadPlayerCache() {
+		if p.PUUID == puuid {
+			return time.Unix(p.CachedAt, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// Look d's accounts up again, only those past the TTL unless force,
+// returning the accounts as they are now
+func (d *Dispatcher) refreshAccounts(force bool, maxWait time.Duration) ([]RiotAccount, error) {
+	ttl := playerCacheTTL()
+	for _, a := range d.Accounts() {
+		if !force && time.Since(playerCachedAt(a.PUUID)) < ttl {
+			continue
+		}
+		p, err := d.riot.RefreshPlayer(a, maxWait)
+		if err != nil {
+			return d.Accounts(), fmt.Errorf("%s: %w", a, err)
+		}
+		if p.GameName != a.GameName || p.TagLine != a.TagLine {
+			log.Printf("Riot account %s is now %s#%s", a, p.GameName, p.TagLine)
+		}
+		d.updateAccount(p)
+	}
+	return d.Accounts(), nil
+}
+
+// Look up accounts whose players.json entry is older than the TTL, at
+// startup and then every playerRefreshInterval
+func (d *Dispatcher) RunPlayerRefresher(ctx context.Context) {
+	ticker := time.NewTicker(playerRefreshInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.refreshAccounts(false, riotBackgroundWait); err != nil {
+			log.Printf("Refreshing Riot accounts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ---------- !refreshplayer ----------
+func init() {
+	registerBuiltin("refreshplayer", "refreshplayer", 10, "broadcaster", func(d *Dispatcher, c *CommandContext) {
+		// chat gets an answer in seconds; a rate-limited refresh is left to
+		// the hourly one
+		accounts, err := d.refreshAccounts(true, riotChatWait)
+		if err != nil {
+			log.Printf("Refreshing Riot accounts: %v", err)
+			c.Reply("Error refreshing the Riot account.")
+			return
+		}
+		names := make([]string, len(accounts))
+		for i, a := range accounts {
+			names[i] = a.String()
+		}
+		c.Reply("Refreshed " + strings.Join(names, ", "))
+	})
+}
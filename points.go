@@ -0,0 +1,231 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	pointsFile            = "points.json"
+	defaultPointsPerWatch = 10 // per watchTick watched
+	leaderboardSize       = 5
+	slowRankingWarning    = 100 * time.Millisecond
+)
+
+// Viewer points, opened in main
+var points *PointsStore
+
+// ---------- Types ----------
+
+// Points balances by user. Every change goes through one lock, so checks
+// like "can they afford it" and the deduction that follows can't interleave
+// with another command, a timer or the watch time tracker. Balances never
+// go below zero.
+type PointsStore struct {
+	mu       sync.Mutex
+	users    *UserStore[int]
+	perWatch int
+}
+
+// POINTS_PER_WATCH points per 5 minutes watched (10 by default, 0 turns
+// accrual off)
+func NewPointsStore(path string) *PointsStore {
+	p := &PointsStore{users: NewUserStore[int](path), perWatch: defaultPointsPerWatch}
+	if v := os.Getenv("POINTS_PER_WATCH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			p.perWatch = n
+		} else {
+			log.Printf("Ignoring invalid POINTS_PER_WATCH %q", v)
+		}
+	}
+	return p
+}
+
+// ---------- Access ----------
+
+func (p *PointsStore) Balance(u ChatUser) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, _ := p.users.Get(u)
+	return n
+}
+
+// Add n points (or take them away when negative, stopping at zero),
+// returning the new balance
+func (p *PointsStore) Add(u ChatUser, n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var balance int
+	p.users.Update(u, func(b *int) {
+		*b = max(*b+n, 0)
+		balance = *b
+	})
+	return balance
+}
+
+// Take n points if u has that many, reporting whether they did. The
+// balance is returned either way.
+func (p *PointsStore) Deduct(u ChatUser, n int) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	balance, _ := p.users.Get(u)
+	if n < 0 || balance < n {
+		return balance, false
+	}
+	p.users.Update(u, func(b *int) { *b -= n })
+	return balance - n, true
+}
+
+// Move n points from one user to another if from has them
+func (p *PointsStore) Transfer(from, to ChatUser, n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	balance, _ := p.users.Get(from)
+	if n < 0 || balance < n {
+		return false
+	}
+	p.users.Update(from, func(b *int) { *b -= n })
+	p.users.Update(to, func(b *int) { *b += n })
+	return true
+}
+
+// Take n points from each of users, or from none of them if any is short
+func (p *PointsStore) DeductEach(users []ChatUser, n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n < 0 {
+		return false
+	}
+	for _, u := range users {
+		if balance, _ := p.users.Get(u); balance < n {
+			return false
+		}
+	}
+	p.users.UpdateEach(users, func(b *int) { *b -= n })
+	return true
+}
+
+// Credit everyone watching for one watch tick
+func (p *PointsStore) AddWatching(users []ChatUser) {
+	if p.perWatch == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users.UpdateEach(users, func(b *int) { *b += p.perWatch })
+}
+
+// Write unsaved balances now, as on shutdown
+func (p *PointsStore) Flush() {
+	p.users.Flush()
+}
+
+// ---------- Ranking ----------
+
+type pointsBalance struct {
+	Key    string // ChatUser.Key
+	Name   string // display name as last seen, so no Helix lookup is needed
+	Points int
+}
+
+// Everyone with points, highest first, leaving out the bot and
+// IGNORED_USERS. Sorted on demand, a few milliseconds for 5000 users;
+// a slow sort is logged so a bigger channel notices.
+func (p *PointsStore) Ranking() []pointsBalance {
+	start := time.Now()
+	var ranking []pointsBalance
+	for key, e := range p.users.All() {
+		if e.Data <= 0 || ignoredUsers[strings.ToLower(e.Login)] {
+			continue
+		}
+		name := e.DisplayName
+		if name == "" {
+			name = e.Login
+		}
+		ranking = append(ranking, pointsBalance{Key: key, Name: name, Points: e.Data})
+	}
+	slices.SortFunc(ranking, func(a, b pointsBalance) int {
+		return cmp.Or(cmp.Compare(b.Points, a.Points), strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)))
+	})
+	if took := time.Since(start); took > slowRankingWarning {
+		log.Printf("Ranking %d point balances took %s", len(ranking), took)
+	}
+	return ranking
+}
+
+// u's place in the ranking (0 when they have no points) and how many are in it
+func (p *PointsStore) Position(u ChatUser) (int, int) {
+	ranking := p.Ranking()
+	key := u.Key()
+	for i, b := range ranking {
+		if b.Key == key {
+			return i + 1, len(ranking)
+		}
+	}
+	return 0, len(ranking)
+}
+
+// !rank points
+func pointsRankReply(c *CommandContext) {
+	pos, total := points.Position(c.Sender)
+	if pos == 0 {
+		c.Reply(fmt.Sprintf("%s doesn't have any points yet.", c.Sender.Name()))
+		return
+	}
+	c.Reply(fmt.Sprintf("%s is #%d of %d with %s.", c.Sender.Name(), pos, total, plural(points.Balance(c.Sender), "point", "points")))
+}
+
+// ---------- !points / !givepoints / !leaderboard ----------
+func init() {
+	registerBuiltin("points", "points", 5, "", func(d *Dispatcher, c *CommandContext) {
+		target := c.Sender
+		if len(c.Args) > 0 {
+			var ok bool
+			if target, ok = userArg(d, c, "points"); !ok {
+				return
+			}
+		}
+		c.Reply(fmt.Sprintf("%s has %s.", target.Name(), plural(points.Balance(target), "point", "points")))
+	})
+
+	registerBuiltin("givepoints", "givepoints", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		usage := fmt.Sprintf("Usage: %sgivepoints <user> <amount> (negative to take points away)", d.Config().Prefix)
+		if len(c.Args) < 2 {
+			c.Reply(usage)
+			return
+		}
+		n, err := strconv.Atoi(c.Args[1])
+		if err != nil || n == 0 {
+			c.Reply(usage)
+			return
+		}
+		target, ok := userArg(d, c, "givepoints")
+		if !ok {
+			return
+		}
+		balance := points.Add(target, n)
+		log.Printf("%s gave %d points to %s", c.Sender.Login, n, target.Login)
+		c.Reply(fmt.Sprintf("%s now has %s.", target.Name(), plural(balance, "point", "points")))
+	})
+
+	registerBuiltin("leaderboard", "leaderboard", 10, "", func(d *Dispatcher, c *CommandContext) {
+		ranking := points.Ranking()
+		if len(ranking) == 0 {
+			c.Reply("Nobody has any points yet.")
+			return
+		}
+		var parts []string
+		for i, b := range ranking[:min(leaderboardSize, len(ranking))] {
+			parts = append(parts, fmt.Sprintf("%d. %s (%d)", i+1, b.Name, b.Points))
+		}
+		c.Reply("Top points: " + strings.Join(parts, " | "))
+	})
+}
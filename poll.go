@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultPollDuration = 60 * time.Second
+	maxPollOptions      = 10
+)
+
+// Open poll per channel
+var (
+	polls   = map[string]*poll{}
+	pollsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+type poll struct {
+	Question string
+	Options  []string
+	votes    map[string]int // ChatUser.Key -> option index, the latest vote counts
+	timer    *time.Timer
+}
+
+// ---------- Voting ----------
+
+// Called by the dispatcher for every chat message. Returns true when the
+// message was a vote ("2" or "Ashe") in the channel's open poll.
+func castVote(channel string, u ChatUser, msg string) bool {
+	pollsMu.Lock()
+	defer pollsMu.Unlock()
+	p, ok := polls[channel]
+	if !ok {
+		return false
+	}
+	choice := p.option(strings.TrimSpace(cleanText(msg)))
+	if choice < 0 {
+		return false
+	}
+	p.votes[u.Key()] = choice
+	return true
+}
+
+// Index of the option text names, by number or name, or -1
+func (p *poll) option(text string) int {
+	if n, err := strconv.Atoi(text); err == nil {
+		if n >= 1 && n <= len(p.Options) {
+			return n - 1
+		}
+		return -1
+	}
+	for i, o := range p.Options {
+		if strings.EqualFold(text, o) {
+			return i
+		}
+	}
+	return -1
+}
+
+// "Jinx 5 (50%), Ashe 3 (30%), Caitlyn 2 (20%)"
+func (p *poll) results() string {
+	counts := make([]int, len(p.Options))
+	for _, choice := range p.votes {
+		counts[choice]++
+	}
+	parts := make([]string, len(p.Options))
+	for i, o := range p.Options {
+		parts[i] = fmt.Sprintf("%s %d (%.0f%%)", o, counts[i], 100*float64(counts[i])/float64(len(p.votes)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Close the channel's poll and announce the results
+func (d *Dispatcher) closePoll(channel string) {
+	pollsMu.Lock()
+	p, ok := polls[channel]
+	if ok {
+		p.timer.Stop()
+		delete(polls, channel)
+	}
+	pollsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if len(p.votes) == 0 {
+		d.bot.Say(channel, fmt.Sprintf("Poll closed: %s No votes were cast.", p.Question))
+		return
+	}
+	log.Printf("[#%s] Poll %q closed with %d votes", channel, p.Question, len(p.votes))
+	d.bot.Say(channel, fmt.Sprintf("Poll closed: %s %s | %s", p.Question, p.results(), plural(len(p.votes), "vote", "votes")))
+}
+
+// ---------- Parsing ----------
+
+// Split on spaces, keeping "double quoted" phrases together
+func splitQuoted(s string) []string {
+	var fields []string
+	var b strings.Builder
+	quoted, inField := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case r == ' ' && !quoted:
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return fields
+}
+
+// ---------- Commands ----------
+func init() {
+	registerBuiltin("poll", "poll", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		prefix := d.Config().Prefix
+		usage := fmt.Sprintf(`Usage: %spoll start "Question?" Option1 "Option 2" ... [seconds] | %spoll end | %spoll cancel`, prefix, prefix, prefix)
+		if len(c.Args) == 0 {
+			c.Reply(usage)
+			return
+		}
+
+		switch strings.ToLower(c.Args[0]) {
+		case "start":
+			fields := splitQuoted(strings.Join(c.Args[1:], " "))
+			duration := defaultPollDuration
+			if len(fields) > 0 {
+				if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+					duration = time.Duration(n) * time.Second
+					fields = fields[:len(fields)-1]
+				}
+			}
+			if len(fields) < 3 || duration <= 0 {
+				c.Reply(usage)
+				return
+			}
+			question, options := fields[0], fields[1:]
+			if len(options) > maxPollOptions {
+				c.Reply(fmt.Sprintf("A poll can have at most %d options.", maxPollOptions))
+				return
+			}
+			for _, o := range options {
+				// bare numbers would clash with voting by option number
+				if _, err := strconv.Atoi(o); err == nil {
+					c.Reply(fmt.Sprintf("%q can't be a poll option.", o))
+					return
+				}
+			}
+
+			pollsMu.Lock()
+			if p, ok := polls[c.Channel]; ok {
+				pollsMu.Unlock()
+				c.Reply(fmt.Sprintf("A poll is already running: %s", p.Question))
+				return
+			}
+			channel := c.Channel
+			polls[channel] = &poll{
+				Question: question,
+				Options:  options,
+				votes:    map[string]int{},
+				timer:    time.AfterFunc(duration, func() { d.closePoll(channel) }),
+			}
+			pollsMu.Unlock()
+
+			numbered := make([]string, len(options))
+			for i, o := range options {
+				numbered[i] = fmt.Sprintf("%d) %s", i+1, o)
+			}
+			d.bot.Say(c.Channel, fmt.Sprintf("Poll: %s %s | Type the number or name to vote, %s left",
+				question, strings.Join(numbered, " "), formatDuration(duration)))
+
+		case "end":
+			d.closePoll(c.Channel)
+
+		case "cancel":
+			pollsMu.Lock()
+			p, ok := polls[c.Channel]
+			if ok {
+				p.timer.Stop()
+				delete(polls, c.Channel)
+			}
+			pollsMu.Unlock()
+			if !ok {
+				c.Reply("There is no poll running.")
+				return
+			}
+			d.bot.Say(c.Channel, "The poll was cancelled.")
+
+		default:
+			c.Reply(usage)
+		}
+	})
+}
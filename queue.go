@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ---------- Config & Globals ----------
+const (
+	queueFile    = "queue.json"
+	queueShowTop = 5
+)
+
+// Viewer queues, opened in main
+var queues *QueueStore
+
+// ---------- Types ----------
+
+type queueEntry struct {
+	Key         string `json:"key"` // ChatUser.Key
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+func (e queueEntry) Name() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	return e.Login
+}
+
+// One channel's queue, started over for each stream
+type viewerQueue struct {
+	StreamStart int64        `json:"streamStart"`
+	Entries     []queueEntry `json:"entries"`
+}
+
+// JSON file of viewer queues by channel, saved after every change
+type QueueStore struct {
+	mu     sync.Mutex
+	path   string
+	queues map[string]*viewerQueue
+}
+
+func NewQueueStore(path string) *QueueStore {
+	s := &QueueStore{path: path, queues: make(map[string]*viewerQueue)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.queues); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// ---------- Store ----------
+
+// Run fn on the channel's queue for the current stream, saving afterwards
+// if it reports a change. The queue only starts over once Helix confirms a
+// different stream, never because it couldn't be reached.
+func (s *QueueStore) with(channel string, fn func(q *viewerQueue) bool) {
+	start, err := CachedStreamStart(channel)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[channel]
+	if !ok || (err == nil && q.StreamStart != start) {
+		q = &viewerQueue{StreamStart: start}
+		s.queues[channel] = q
+	}
+	if !fn(q) {
+		return
+	}
+
+	data, err := json.MarshalIndent(s.queues, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+}
+
+// 1-based position of the user, or 0
+func (q *viewerQueue) position(key string) int {
+	for i, e := range q.Entries {
+		if e.Key == key {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ---------- Commands ----------
+
+// To allow only subscribers to join, override !join in commands.json:
+// "!join": {"type": "builtin", "endpoint": "join", "permission": "subscriber"}
+func init() {
+	registerBuiltin("join", "join", 0, "", func(d *Dispatcher, c *CommandContext) {
+		queues.with(c.Channel, func(q *viewerQueue) bool {
+			if pos := q.position(c.Sender.Key()); pos > 0 {
+				c.Reply(fmt.Sprintf("You're already #%d in the queue.", pos))
+				return false
+			}
+			q.Entries = append(q.Entries, queueEntry{Key: c.Sender.Key(), Login: c.Sender.Login, DisplayName: c.Sender.DisplayName})
+			c.Reply(fmt.Sprintf("You're #%d in the queue.", len(q.Entries)))
+			return true
+		})
+	})
+
+	registerBuiltin("queue", "queue", 5, "", func(d *Dispatcher, c *CommandContext) {
+		queues.with(c.Channel, func(q *viewerQueue) bool {
+			if len(q.Entries) == 0 {
+				c.Reply("The queue is empty.")
+				return false
+			}
+			var names []string
+			for _, e := range q.Entries[:min(len(q.Entries), queueShowTop)] {
+				names = append(names, e.Name())
+			}
+			c.Reply(fmt.Sprintf("Queue (%d): %s", len(q.Entries), strings.Join(names, ", ")))
+			return false
+		})
+	})
+
+	registerBuiltin("position", "position", 0, "", func(d *Dispatcher, c *CommandContext) {
+		queues.with(c.Channel, func(q *viewerQueue) bool {
+			if pos := q.position(c.Sender.Key()); pos > 0 {
+				c.Reply(fmt.Sprintf("You're #%d of %d in the queue.", pos, len(q.Entries)))
+			} else {
+				c.Reply(fmt.Sprintf("You're not in the queue, type %sjoin to get in.", d.Config().Prefix))
+			}
+			return false
+		})
+	})
+
+	registerBuiltin("next", "next", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		queues.with(c.Channel, func(q *viewerQueue) bool {
+			if len(q.Entries) == 0 {
+				c.Reply("The queue is empty.")
+				return false
+			}
+			next := q.Entries[0]
+			q.Entries = q.Entries[1:]
+			d.bot.Say(c.Channel, fmt.Sprintf("Next up: @%s! (%d left in the queue)", next.Name(), len(q.Entries)))
+			return true
+		})
+	})
+
+	registerBuiltin("clearqueue", "clearqueue", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		queues.with(c.Channel, func(q *viewerQueue) bool {
+			n := len(q.Entries)
+			q.Entries = nil
+			c.Reply(fmt.Sprintf("Cleared the queue (%s removed).", plural(n, "person", "people")))
+			return n > 0
+		})
+	})
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const quotesFile = "quotes.json"
+
+// Saved quotes, opened in main
+var quotes *QuoteStore
+
+// ---------- Types ----------
+
+type Quote struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+	Game string `json:"game,omitempty"`
+	Date string `json:"date"` // YYYY-MM-DD
+}
+
+// JSON file of quotes. Ids only ever count up so "!quote 12" keeps
+// meaning the same quote after others are deleted.
+type QuoteStore struct {
+	mu     sync.Mutex
+	path   string
+	NextID int     `json:"next_id"`
+	Quotes []Quote `json:"quotes"`
+}
+
+func NewQuoteStore(path string) *QuoteStore {
+	s := &QuoteStore{path: path, NextID: 1}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	for _, q := range s.Quotes {
+		s.NextID = max(s.NextID, q.ID+1)
+	}
+	return s
+}
+
+// ---------- Store ----------
+
+func (s *QuoteStore) Add(text, game string) Quote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := Quote{ID: s.NextID, Text: text, Game: game, Date: time.Now().Format(time.DateOnly)}
+	s.NextID++
+	s.Quotes = append(s.Quotes, q)
+	s.saveLocked()
+	return q
+}
+
+func (s *QuoteStore) Delete(id int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, q := range s.Quotes {
+		if q.ID == id {
+			s.Quotes = append(s.Quotes[:i], s.Quotes[i+1:]...)
+			s.saveLocked()
+			return true
+		}
+	}
+	return false
+}
+
+func (s *QuoteStore) Get(id int) (Quote, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.Quotes {
+		if q.ID == id {
+			return q, true
+		}
+	}
+	return Quote{}, false
+}
+
+func (s *QuoteStore) Random() (Quote, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.Quotes) == 0 {
+		return Quote{}, false
+	}
+	return s.Quotes[rand.IntN(len(s.Quotes))], true
+}
+
+func (s *QuoteStore) saveLocked() {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+}
+
+// #12: "text" [League of Legends, 2026-10-14]
+func (q Quote) String() string {
+	if q.Game == "" {
+		return fmt.Sprintf("#%d: \"%s\" [%s]", q.ID, q.Text, q.Date)
+	}
+	return fmt.Sprintf("#%d: \"%s\" [%s, %s]", q.ID, q.Text, q.Game, q.Date)
+}
+
+// ---------- !quote / !addquote / !delquote ----------
+func init() {
+	registerBuiltin("quote", "quote", 5, "", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) == 0 {
+			q, ok := quotes.Random()
+			if !ok {
+				c.Reply("There are no quotes yet.")
+				return
+			}
+			c.Reply(q.String())
+			return
+		}
+
+		id, err := strconv.Atoi(strings.TrimPrefix(c.Args[0], "#"))
+		if err != nil {
+			c.Reply(fmt.Sprintf("Usage: %squote [id]", d.Config().Prefix))
+			return
+		}
+		q, ok := quotes.Get(id)
+		if !ok {
+			c.Reply(fmt.Sprintf("There is no quote #%d.", id))
+			return
+		}
+		c.Reply(q.String())
+	})
+
+	registerBuiltin("addquote", "addquote", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) == 0 {
+			c.Reply(fmt.Sprintf("Usage: %saddquote <text>", d.Config().Prefix))
+			return
+		}
+		game := ""
+		if title, g, err := CachedStreamInfo(c.Channel); err == nil && title != "Offline" {
+			game = g
+		}
+		q := quotes.Add(strings.Join(c.Args, " "), game)
+		log.Printf("%s added quote #%d", c.Sender.Login, q.ID)
+		c.Reply(fmt.Sprintf("Added quote #%d", q.ID))
+	})
+
+	registerBuiltin("delquote", "delquote", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) == 0 {
+			c.Reply(fmt.Sprintf("Usage: %sdelquote <id>", d.Config().Prefix))
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(c.Args[0], "#"))
+		if err != nil || !quotes.Delete(id) {
+			c.Reply(fmt.Sprintf("There is no quote %s.", c.Args[0]))
+			return
+		}
+		log.Printf("%s deleted quote #%d", c.Sender.Login, id)
+		c.Reply(fmt.Sprintf("Deleted quote #%d", id))
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const maxRaffleDuration = time.Hour
+
+// Latest raffle per channel, kept after it closes for !reroll
+var (
+	raffles   = map[string]*raffle{}
+	rafflesMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+type raffle struct {
+	Keyword  string
+	SubsOnly bool
+	Open     bool
+	Entrants []ChatUser
+	entered  map[string]bool // by ChatUser.Key
+	winners  map[string]bool
+	timer    *time.Timer
+}
+
+// ---------- Entering ----------
+
+// Called by the dispatcher for every chat message. Returns true when the
+// message was the open raffle's keyword, so it isn't treated as a command.
+func enterRaffle(channel string, u ChatUser, msg string) bool {
+	rafflesMu.Lock()
+	defer rafflesMu.Unlock()
+	r, ok := raffles[channel]
+	if !ok || !r.Open || !strings.EqualFold(strings.TrimSpace(cleanText(msg)), r.Keyword) {
+		return false
+	}
+	if r.SubsOnly && !u.IsSubscriber && !u.IsBroadcaster {
+		return true
+	}
+	if !r.entered[u.Key()] {
+		r.entered[u.Key()] = true
+		r.Entrants = append(r.Entrants, u)
+	}
+	return true
+}
+
+// ---------- Drawing ----------
+
+// Pick a winner who hasn't won this raffle yet. Caller holds rafflesMu.
+func (r *raffle) drawLocked() (ChatUser, bool) {
+	var eligible []ChatUser
+	for _, u := range r.Entrants {
+		if !r.winners[u.Key()] {
+			eligible = append(eligible, u)
+		}
+	}
+	if len(eligible) == 0 {
+		return ChatUser{}, false
+	}
+	winner := eligible[rand.IntN(len(eligible))]
+	r.winners[winner.Key()] = true
+	return winner, true
+}
+
+// Close the channel's raffle and announce the winner
+func (d *Dispatcher) closeRaffle(channel string) {
+	rafflesMu.Lock()
+	r, ok := raffles[channel]
+	if !ok || !r.Open {
+		rafflesMu.Unlock()
+		return
+	}
+	r.Open = false
+	r.timer.Stop()
+	winner, found := r.drawLocked()
+	entries := len(r.Entrants)
+	rafflesMu.Unlock()
+
+	if !found {
+		d.bot.Say(channel, "The raffle ended with no entries.")
+		return
+	}
+	log.Printf("[#%s] Raffle won by %s out of %d entries", channel, winner.Login, entries)
+	d.bot.Say(channel, fmt.Sprintf("The raffle is closed! The winner is @%s, out of %s!", winner.Name(), plural(entries, "entry", "entries")))
+}
+
+// "90", "90s", "2m"
+func parseRaffleDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// ---------- Commands ----------
+func init() {
+	registerBuiltin("raffle", "raffle", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		usage := fmt.Sprintf("Usage: %sraffle start <keyword> <duration> [subs] | %sraffle end | %sraffle cancel",
+			d.Config().Prefix, d.Config().Prefix, d.Config().Prefix)
+		if len(c.Args) == 0 {
+			c.Reply(usage)
+			return
+		}
+
+		switch strings.ToLower(c.Args[0]) {
+		case "start":
+			if len(c.Args) < 3 {
+				c.Reply(usage)
+				return
+			}
+			duration, err := parseRaffleDuration(c.Args[2])
+			if err != nil || duration <= 0 || duration > maxRaffleDuration {
+				c.Reply(fmt.Sprintf("%q isn't a duration up to %s, try 60 or 2m.", c.Args[2], maxRaffleDuration))
+				return
+			}
+			subsOnly := len(c.Args) > 3 && strings.HasPrefix(strings.ToLower(c.Args[3]), "sub")
+			keyword := c.Args[1]
+
+			rafflesMu.Lock()
+			if r, ok := raffles[c.Channel]; ok && r.Open {
+				rafflesMu.Unlock()
+				c.Reply(fmt.Sprintf("A raffle for %q is already running.", r.Keyword))
+				return
+			}
+			channel := c.Channel
+			raffles[channel] = &raffle{
+				Keyword:  keyword,
+				SubsOnly: subsOnly,
+				Open:     true,
+				entered:  map[string]bool{},
+				winners:  map[string]bool{},
+				timer:    time.AfterFunc(duration, func() { d.closeRaffle(channel) }),
+			}
+			rafflesMu.Unlock()
+
+			who := "Type"
+			if subsOnly {
+				who = "Subscribers, type"
+			}
+			d.bot.Say(c.Channel, fmt.Sprintf("Raffle open! %s %s in chat within %s to enter.", who, keyword, formatDuration(duration)))
+
+		case "end":
+			d.closeRaffle(c.Channel)
+
+		case "cancel":
+			rafflesMu.Lock()
+			r, ok := raffles[c.Channel]
+			if ok && r.Open {
+				r.timer.Stop()
+				delete(raffles, c.Channel)
+			}
+			rafflesMu.Unlock()
+			if !ok || !r.Open {
+				c.Reply("There is no raffle running.")
+				return
+			}
+			d.bot.Say(c.Channel, "The raffle was cancelled.")
+
+		default:
+			c.Reply(usage)
+		}
+	})
+
+	registerBuiltin("reroll", "reroll", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		rafflesMu.Lock()
+		r, ok := raffles[c.Channel]
+		if !ok || r.Open {
+			rafflesMu.Unlock()
+			c.Reply("There is no finished raffle to reroll.")
+			return
+		}
+		winner, found := r.drawLocked()
+		rafflesMu.Unlock()
+
+		if !found {
+			c.Reply("Everyone who entered has already won.")
+			return
+		}
+		d.bot.Say(c.Channel, fmt.Sprintf("Rerolled! The new winner is @%s!", winner.Name()))
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	rankSnapshotsFile     = "rank_snapshots.json"
+	rankSnapshotInterval  = time.Minute
+	rankSnapshotRetention = 7 * 24 * time.Hour
+)
+
+// Ranks at the start of each stream, opened in main
+var rankSnapshots *RankSnapshotStore
+
+// ---------- Types ----------
+
+// Every account's rank as the stream went live (or as the bot started, if
+// it was already live), keyed by the stream start. Saved to disk, so a
+// restart mid-stream keeps the baseline.
+type RankSnapshotStore struct {
+	mu        sync.Mutex
+	path      string
+	snapshots map[string]rankSnapshot // unix stream start as a string
+}
+
+type rankSnapshot struct {
+	TakenAt int64                    `json:"takenAt"`
+	Ranks   map[string][]LeagueEntry `json:"ranks"` // by puuid
+}
+
+func NewRankSnapshotStore(path string) *RankSnapshotStore {
+	s := &RankSnapshotStore{path: path, snapshots: make(map[string]rankSnapshot)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.snapshots); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// ---------- Access ----------
+
+// puuid's ranks at the start of the stream, if a snapshot was taken
+func (s *RankSnapshotStore) Get(streamStart int64, puuid string) ([]LeagueEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[strconv.FormatInt(streamStart, 10)]
+	if !ok {
+		return nil, false
+	}
+	ranks, ok := snap.Ranks[puuid]
+	return ranks, ok
+}
+
+func (s *RankSnapshotStore) has(streamStart int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.snapshots[strconv.FormatInt(streamStart, 10)]
+	return ok
+}
+
+// Record every account's current rank for the stream, dropping snapshots
+// of streams older than rankSnapshotRetention
+func (s *RankSnapshotStore) Take(streamStart int64, accounts []RiotAccount) error {
+	snap := rankSnapshot{TakenAt: time.Now().Unix(), Ranks: map[string][]LeagueEntry{}}
+	for _, a := range accounts {
+		ranks, err := GetCurrentRank(a)
+		if err != nil {
+			return fmt.Errorf("%s: %w", a, err)
+		}
+		snap.Ranks[a.PUUID] = ranks
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[strconv.FormatInt(streamStart, 10)] = snap
+	cutoff := time.Now().Add(-rankSnapshotRetention).Unix()
+	for key := range s.snapshots {
+		if start, err := strconv.ParseInt(key, 10, 64); err != nil || start < cutoff {
+			delete(s.snapshots, key)
+		}
+	}
+	data, err := json.MarshalIndent(s.snapshots, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(s.path, data)
+	}
+	if err != nil {
+		log.Printf("Error saving %s: %v", s.path, err)
+	}
+	return nil
+}
+
+// Take a snapshot for each live channel's stream that doesn't have one: at
+// startup, then whenever a stream goes live
+func RunRankSnapshots(ctx context.Context, bot *Bot, accounts []RiotAccount) {
+	ticker := time.NewTicker(rankSnapshotInterval)
+	defer ticker.Stop()
+	for {
+		for _, channel := range bot.Channels {
+			start, err := CachedStreamStart(channel)
+			if err != nil || start == 0 || rankSnapshots.has(start) {
+				continue
+			}
+			if err := rankSnapshots.Take(start, accounts); err != nil {
+				log.Printf("[#%s] Error taking rank snapshot: %v", channel, err)
+			} else {
+				log.Printf("[#%s] Took rank snapshot for the stream", channel)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ---------- LP ----------
+
+// "Solo: Gold II 40 LP → Gold I 12 LP, +72 LP | Flex: ..." for the queues
+// whose rank changed since the start of the stream
+func describeStreamLP(stats StreamStatsCacheEntry) string {
+	if stats.RankStart == nil {
+		return ""
+	}
+	var parts []string
+	for _, q := range []struct{ queue, label string }{{soloQueue, "Solo"}, {flexQueue, "Flex"}} {
+		end, ok := stats.RankEnd[q.queue]
+		if !ok {
+			continue
+		}
+		if change := describeLPChange(stats.RankStart[q.queue], end); change != "" {
+			parts = append(parts, q.label+": "+change)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+var tierOrder = []string{"IRON", "BRONZE", "SILVER", "GOLD", "PLATINUM", "EMERALD", "DIAMOND", "MASTER", "GRANDMASTER", "CHALLENGER"}
+
+var divisionOrder = map[string]int{"IV": 0, "III": 1, "II": 2, "I": 3}
+
+// Master and above have no divisions and share one ladder
+func isApexTier(tier string) bool {
+	return slices.Index(tierOrder, tier) >= slices.Index(tierOrder, "MASTER")
+}
+
+// LP counted from Iron IV 0 LP, so changes across divisions and tiers can be
+// subtracted. Reaching 100 LP in Diamond I is promotion, so it's the same
+// total as Master 0 LP; tell them apart with isApexTier, not the total.
+func totalLP(e LeagueEntry) int {
+	if isApexTier(e.Tier) {
+		return slices.Index(tierOrder, "MASTER")*400 + e.LeaguePoints
+	}
+	tier := max(slices.Index(tierOrder, e.Tier), 0)
+	return tier*400 + divisionOrder[e.Rank]*100 + e.LeaguePoints
+}
+
+// "Gold II 40 LP"
+func describeRank(e LeagueEntry) string {
+	if e.Tier == "" {
+		return "Unranked"
+	}
+	tier := strings.ToUpper(e.Tier[:1]) + strings.ToLower(e.Tier[1:])
+	if isApexTier(e.Tier) {
+		return fmt.Sprintf("%s %d LP", tier, e.LeaguePoints)
+	}
+	return fmt.Sprintf("%s %s %d LP", tier, e.Rank, e.LeaguePoints)
+}
+
+// "Gold II 40 LP → Gold I 12 LP, +72 LP", "" when unchanged
+func describeLPChange(start, end LeagueEntry) string {
+	if start.Tier == "" {
+		if end.Tier == "" {
+			return ""
+		}
+		return "placed in " + describeRank(end)
+	}
+	diff := totalLP(end) - totalLP(start)
+	if diff == 0 && start.Tier == end.Tier && start.Rank == end.Rank {
+		return ""
+	}
+	return fmt.Sprintf("%s → %s, %+d LP", describeRank(start), describeRank(end), diff)
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestDescribeRank(t *testing.T) {
+	tests := []struct {
+		entry LeagueEntry
+		want  string
+	}{
+		{LeagueEntry{}, "Unranked"},
+		{LeagueEntry{Tier: "GOLD", Rank: "II", LeaguePoints: 40}, "Gold II 40 LP"},
+		{LeagueEntry{Tier: "DIAMOND", Rank: "I", LeaguePoints: 100}, "Diamond I 100 LP"},
+		{LeagueEntry{Tier: "MASTER", Rank: "I", LeaguePoints: 0}, "Master 0 LP"},
+		{LeagueEntry{Tier: "CHALLENGER", Rank: "I", LeaguePoints: 1200}, "Challenger 1200 LP"},
+	}
+	for _, tt := range tests {
+		if got := describeRank(tt.entry); got != tt.want {
+			t.Errorf("describeRank(%+v) = %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeLPChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end LeagueEntry
+		want       string
+	}{
+		{"unchanged", LeagueEntry{Tier: "GOLD", Rank: "II", LeaguePoints: 40}, LeagueEntry{Tier: "GOLD", Rank: "II", LeaguePoints: 40}, ""},
+		{"placement", LeagueEntry{}, LeagueEntry{Tier: "SILVER", Rank: "I", LeaguePoints: 0}, "placed in Silver I 0 LP"},
+		{"division up", LeagueEntry{Tier: "GOLD", Rank: "II", LeaguePoints: 40}, LeagueEntry{Tier: "GOLD", Rank: "I", LeaguePoints: 12}, "Gold II 40 LP → Gold I 12 LP, +72 LP"},
+		{"promoted to master", LeagueEntry{Tier: "DIAMOND", Rank: "I", LeaguePoints: 100}, LeagueEntry{Tier: "MASTER", Rank: "I", LeaguePoints: 0}, "Diamond I 100 LP → Master 0 LP, +0 LP"},
+		{"demoted from master", LeagueEntry{Tier: "MASTER", Rank: "I", LeaguePoints: 10}, LeagueEntry{Tier: "DIAMOND", Rank: "I", LeaguePoints: 75}, "Master 10 LP → Diamond I 75 LP, -35 LP"},
+	}
+	for _, tt := range tests {
+		if got := describeLPChange(tt.start, tt.end); got != tt.want {
+			t.Errorf("%s: describeLPChange = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
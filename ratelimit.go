@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	chatRateWindow   = 30 * time.Second
+	joinRateWindow   = 10 * time.Second
+	sendQueueSize    = 50
+	controlQueueSize = 10
+	writeTimeout     = 10 * time.Second
+	partTimeout      = 5 * time.Second // how long shutdown waits for its PARTs to go out
+	// how long queued chat waits out a reconnect before it's dropped, and
+	// how often it checks
+	reconnectChatWait = 30 * time.Second
+	reconnectChatPoll = 100 * time.Millisecond
+
+	// Twitch drops a message identical to the previous one in the channel
+	// within this window, unless the sender is a moderator
+	duplicateWindow = 30 * time.Second
+	// appended to make a repeat differ; U+E0000 renders as nothing
+	duplicateBreaker = " \U000E0000"
+)
+
+var (
+	sendQueue    = make(chan outgoingMessage, sendQueueSize)
+	controlQueue = make(chan outgoingMessage, controlQueueSize)
+	chatLimiter  = newRateLimiter(chatRateWindow)
+	joinLimiter  = newRateLimiter(joinRateWindow)
+	forceModTier bool
+
+	// Twitch's published limits per account type, selected by TWITCH_RATE_TIER
+	rateTiers = map[string]rateTier{
+		"normal":   {Name: "normal", Chat: 20, ChatMod: 100, Joins: 20},
+		"known":    {Name: "known", Chat: 50, ChatMod: 100, Joins: 20},
+		"verified": {Name: "verified", Chat: 7500, ChatMod: 7500, Joins: 2000},
+	}
+	currentTier = rateTiers["normal"]
+
+	// last chat send and its text per channel, only touched by the sender goroutine
+	lastChatSent = map[string]time.Time{}
+	lastChatText = map[string]string{}
+)
+
+// ---------- Types ----------
+
+// Message budget per chatRateWindow and JOIN budget per joinRateWindow
+type rateTier struct {
+	Name    string
+	Chat    int // channels where the bot is not a moderator
+	ChatMod int // channels where the bot is a moderator
+	Joins   int
+}
+
+type outgoingMessage struct {
+	conn    net.Conn // for control lines, the connection they belong to
+	bot     *Bot     // for chat, sent on whatever connection the bot has by then
+	channel string
+	line    string
+	written chan struct{} // closed once the line was written, if set
+}
+
+// Sliding window limiter: a send is allowed while fewer than the caller's
+// limit of sends happened in the last window, so channels with different
+// budgets can share the same history
+type rateLimiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	sent   []time.Time
+}
+
+func newRateLimiter(window time.Duration) *rateLimiter {
+	return &rateLimiter{window: window}
+}
+
+// Record a send if the budget allows it, otherwise return how long to wait
+func (l *rateLimiter) reserve(limit int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for expired < len(l.sent) && now.Sub(l.sent[expired]) >= l.window {
+		expired++
+	}
+	l.sent = l.sent[expired:]
+
+	if len(l.sent) < limit {
+		l.sent = append(l.sent, now)
+		return 0
+	}
+	// wait until enough old sends expire to get back under this limit
+	return l.window - now.Sub(l.sent[len(l.sent)-limit])
+}
+
+// ---------- Sender ----------
+
+// Start the goroutine that writes queued messages. Control traffic (PONG,
+// PING) always goes out before chat, which is held to the rate limit.
+// Channels where USERSTATE reports the bot as a moderator get the higher
+// budget; TWITCH_BOT_IS_MOD=1 forces it everywhere.
+func StartSender() {
+	if name := os.Getenv("TWITCH_RATE_TIER"); name != "" {
+		tier, ok := rateTiers[strings.ToLower(name)]
+		if !ok {
+			log.Fatalf("Unknown TWITCH_RATE_TIER %q (use normal, known or verified)", name)
+		}
+		currentTier = tier
+	}
+	forceModTier = os.Getenv("TWITCH_BOT_IS_MOD") == "1"
+
+	limit := currentTier.Chat
+	if forceModTier {
+		limit = currentTier.ChatMod
+	}
+	log.Printf("Rate tier %s: %d messages per %s, %d joins per %s",
+		currentTier.Name, limit, chatRateWindow, currentTier.Joins, joinRateWindow)
+	go runSender()
+}
+
+func runSender() {
+	for {
+		sendNext()
+	}
+}
+
+// Write the next queued line, blocking until there is one. Pending control
+// traffic always goes first.
+func sendNext() {
+	select {
+	case m := <-controlQueue:
+		writeLine(m)
+		return
+	default:
+	}
+
+	select {
+	case m := <-controlQueue:
+		writeLine(m)
+	case m := <-sendQueue:
+		waitForBudget(m.channel)
+		conn, ok := waitForConn(m.bot)
+		if !ok {
+			log.Printf("Not reconnected within %s, dropping message to #%s: %q", reconnectChatWait, m.channel, m.line)
+			return
+		}
+		m.conn = conn
+		m.line = avoidDuplicate(m)
+		writeLine(m)
+		lastChatSent[m.channel] = time.Now()
+		lastChatText[m.channel] = chatText(m.line)
+	}
+}
+
+// Block until a chat message to channel fits the rate limit and the room's
+// slow mode, still writing any control messages that arrive in the meantime
+func waitForBudget(channel string) {
+	for {
+		wait := time.Until(lastChatSent[channel].Add(slowModeInterval(channel)))
+		if wait <= 0 {
+			limit := chatLimit(channel)
+			wait = chatLimiter.reserve(limit)
+			if wait > 0 {
+				log.Printf("Throttling: %d messages per %s reached (tier %s), delaying message to #%s by %s",
+					limit, chatRateWindow, currentTier.Name, channel, wait.Round(time.Millisecond))
+			}
+		}
+		if wait <= 0 {
+			return
+		}
+		writeControlFor(wait)
+	}
+}
+
+// The bot's current connection, waiting up to reconnectChatWait while it
+// reconnects. Chat queued before a reconnect goes out on the new
+// connection rather than the closed one.
+func waitForConn(b *Bot) (net.Conn, bool) {
+	deadline := time.Now().Add(reconnectChatWait)
+	for {
+		if conn := b.currentConn(); conn != nil {
+			return conn, true
+		}
+		if time.Now().After(deadline) {
+			return nil, false
+		}
+		writeControlFor(reconnectChatPoll)
+	}
+}
+
+// Write any control messages that arrive in the next d
+func writeControlFor(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case m := <-controlQueue:
+			writeLine(m)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// The line to send for m, with duplicateBreaker added when it would repeat
+// the last message in the channel within duplicateWindow. Consecutive
+// repeats alternate between the two forms.
+func avoidDuplicate(m outgoingMessage) string {
+	if forceModTier || isModIn(m.channel) ||
+		time.Since(lastChatSent[m.channel]) >= duplicateWindow ||
+		chatText(m.line) != lastChatText[m.channel] {
+		return m.line
+	}
+	line := strings.TrimSuffix(m.line, "\r\n")
+	if body, ok := strings.CutSuffix(line, actionSuffix); ok {
+		return body + duplicateBreaker + actionSuffix + "\r\n"
+	}
+	return line + duplicateBreaker + "\r\n"
+}
+
+// Message text of a PRIVMSG line, without tags or the channel
+func chatText(line string) string {
+	_, rest, _ := strings.Cut(line, "PRIVMSG ")
+	_, text, _ := strings.Cut(rest, " :")
+	return text
+}
+
+// Write with a deadline; a failed or stuck write closes the connection so
+// the reader errors out and the bot reconnects instead of hanging
+func writeLine(m outgoingMessage) {
+	if m.written != nil {
+		defer close(m.written)
+	}
+	m.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := fmt.Fprint(m.conn, m.line); err != nil {
+		log.Println("Error sending message:", err)
+		m.conn.Close()
+	}
+}
+
+// Message budget per window for sends to channel
+func chatLimit(channel string) int {
+	if forceModTier || isModIn(channel) {
+		return currentTier.ChatMod
+	}
+	return currentTier.Chat
+}
+
+// Block until another JOIN fits the tier's join budget
+func waitForJoin(channel string) {
+	for {
+		wait := joinLimiter.reserve(currentTier.Joins)
+		if wait <= 0 {
+			return
+		}
+		log.Printf("Throttling: %d joins per %s reached (tier %s), delaying JOIN #%s by %s",
+			currentTier.Joins, joinRateWindow, currentTier.Name, channel, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+	}
+}
+
+// Queue a control line (PONG, PING) ahead of any pending chat
+func sendControl(conn net.Conn, line string) {
+	select {
+	case controlQueue <- outgoingMessage{conn: conn, line: line}:
+	default:
+		log.Printf("Control queue full, dropping message: %q", line)
+	}
+}
+
+// Queue lines as control traffic and wait until the sender has written the
+// last of them. Unlike sendControl nothing is dropped, but it gives up after
+// timeout.
+func flushControl(conn net.Conn, lines []string, timeout time.Duration) bool {
+	if len(lines) == 0 {
+		return true
+	}
+	deadline := time.After(timeout)
+	done := make(chan struct{})
+	for i, line := range lines {
+		m := outgoingMessage{conn: conn, line: line}
+		if i == len(lines)-1 {
+			m.written = done
+		}
+		select {
+		case controlQueue <- m:
+		case <-deadline:
+			return false
+		}
+	}
+	select {
+	case <-done:
+		return true
+	case <-deadline:
+		return false
+	}
+}
+
+// Queue a PRIVMSG line for b, dropping it if the queue is already full
+func enqueue(b *Bot, channel, line string) {
+	select {
+	case sendQueue <- outgoingMessage{bot: b, channel: channel, line: line}:
+	default:
+		log.Printf("Send queue full, dropping message: %q", line)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A connection that records what's written to it
+type recordingConn struct {
+	net.Conn
+	mu    sync.Mutex
+	lines []string
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lines = append(c.lines, string(p))
+	return len(p), nil
+}
+
+func (c *recordingConn) SetWriteDeadline(time.Time) error { return nil }
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) written() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines...)
+}
+
+func TestControlTrafficGoesFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		// queues lines for b and returns how many sendNext calls it takes
+		// to write want
+		queue func(b *Bot) int
+		want  []string
+	}{
+		{
+			name: "pong behind 50 chat messages",
+			queue: func(b *Bot) int {
+				for i := range sendQueueSize {
+					enqueue(b, "streamer", fmt.Sprintf("PRIVMSG #streamer :message %d\r\n", i))
+				}
+				sendControl(b.currentConn(), "PONG :tmi.twitch.tv\r\n")
+				return 2
+			},
+			want: []string{"PONG :tmi.twitch.tv\r\n", "PRIVMSG #streamer :message 0\r\n"},
+		},
+		{
+			name: "control lines keep their order",
+			queue: func(b *Bot) int {
+				for i := range sendQueueSize {
+					enqueue(b, "streamer", fmt.Sprintf("PRIVMSG #streamer :message %d\r\n", i))
+				}
+				sendControl(b.currentConn(), "PONG :tmi.twitch.tv\r\n")
+				sendControl(b.currentConn(), "PING :keepalive\r\n")
+				return 3
+			},
+			want: []string{"PONG :tmi.twitch.tv\r\n", "PING :keepalive\r\n", "PRIVMSG #streamer :message 0\r\n"},
+		},
+		{
+			name: "pong while chat waits for budget",
+			queue: func(b *Bot) int {
+				// the budget is already spent, so the chat line waits out
+				// the window while the PONG arrives
+				for range currentTier.Chat {
+					chatLimiter.reserve(currentTier.Chat)
+				}
+				enqueue(b, "streamer", "PRIVMSG #streamer :throttled\r\n")
+				time.AfterFunc(20*time.Millisecond, func() { sendControl(b.currentConn(), "PONG :tmi.twitch.tv\r\n") })
+				return 1
+			},
+			want: []string{"PONG :tmi.twitch.tv\r\n", "PRIVMSG #streamer :throttled\r\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldLimiter := chatLimiter
+			chatLimiter = newRateLimiter(200 * time.Millisecond)
+			t.Cleanup(func() {
+				chatLimiter = oldLimiter
+				clear(lastChatSent)
+				clear(lastChatText)
+				queuedChat()
+				for len(controlQueue) > 0 {
+					<-controlQueue
+				}
+			})
+
+			conn := &recordingConn{}
+			b := NewBot("bot", "", []string{"streamer"})
+			b.setConn(&ircConn{Conn: conn})
+			for range tt.queue(b) {
+				sendNext()
+			}
+			got := conn.written()
+			if len(got) != len(tt.want) {
+				t.Fatalf("wrote %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("write %d is %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFlushControl(t *testing.T) {
+	conn := &recordingConn{}
+	parts := []string{"PART #one\r\n", "PART #two\r\n"}
+	done := make(chan bool)
+	go func() { done <- flushControl(conn, parts, time.Second) }()
+	for range parts {
+		sendNext()
+	}
+	if !<-done {
+		t.Fatal("flushControl gave up with the sender writing")
+	}
+	if got := conn.written(); len(got) != 2 || got[0] != parts[0] || got[1] != parts[1] {
+		t.Errorf("wrote %q, want %q", got, parts)
+	}
+
+	// nobody writes, so it has to give up
+	if flushControl(conn, parts[:1], 10*time.Millisecond) {
+		t.Error("flushControl reported a write that never happened")
+	}
+	<-controlQueue
+}
+
+func TestQueuedChatFollowsReconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		// swaps the bot from old to new after the chat line was queued
+		reconnect func(b *Bot, old, new *ircConn)
+		old, new  []string // written to each connection
+	}{
+		{
+			name:      "reconnected before the send",
+			reconnect: func(b *Bot, old, new *ircConn) { b.setConn(new) },
+			new:       []string{"PRIVMSG #streamer :hello\r\n"},
+		},
+		{
+			name: "still reconnecting at the send",
+			reconnect: func(b *Bot, old, new *ircConn) {
+				b.setConn(nil)
+				// the old connection's PONG still goes out while chat waits
+				time.AfterFunc(20*time.Millisecond, func() { sendControl(old, "PONG :tmi.twitch.tv\r\n") })
+				time.AfterFunc(50*time.Millisecond, func() { b.setConn(new) })
+			},
+			old: []string{"PONG :tmi.twitch.tv\r\n"},
+			new: []string{"PRIVMSG #streamer :hello\r\n"},
+		},
+		{
+			name:      "same connection",
+			reconnect: func(b *Bot, old, new *ircConn) {},
+			old:       []string{"PRIVMSG #streamer :hello\r\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				clear(lastChatSent)
+				clear(lastChatText)
+				queuedChat()
+			})
+			oldConn, newConn := &recordingConn{}, &recordingConn{}
+			old, new := &ircConn{Conn: oldConn}, &ircConn{Conn: newConn}
+			b := NewBot("bot", "", []string{"streamer"})
+			b.setConn(old)
+
+			b.Say("streamer", "hello")
+			tt.reconnect(b, old, new)
+			sendNext()
+
+			for _, c := range []struct {
+				name string
+				got  []string
+				want []string
+			}{{"old", oldConn.written(), tt.old}, {"new", newConn.written(), tt.new}} {
+				if fmt.Sprint(c.got) != fmt.Sprint(c.want) {
+					t.Errorf("%s connection got %q, want %q", c.name, c.got, c.want)
+				}
+			}
+		})
+	}
+}
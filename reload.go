@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const configPollInterval = 3 * time.Second
+
+// ---------- !reload ----------
+func init() {
+	registerBuiltin("reload", "reload", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		config, err := loadConfig(commandsFile)
+		if err != nil {
+			log.Printf("!reload by %s failed: %v", c.Sender.Login, err)
+			c.Reply(fmt.Sprintf("Reload failed, keeping the current commands: %s", chatError(err)))
+			return
+		}
+		d.SetConfig(config)
+
+		champions, err := ReloadChampionMap()
+		if err != nil {
+			c.Reply(fmt.Sprintf("Reloaded %d commands, but champions failed: %v", len(config.Commands), err))
+			return
+		}
+		c.Reply(fmt.Sprintf("Reloaded %d commands and %d champions", len(config.Commands), champions))
+	})
+}
+
+// ---------- Hot reload ----------
+
+// Poll path's modification time and swap the new config into the
+// dispatcher whenever it changes. A file that fails to load is logged and
+// the current config is kept.
+func WatchConfig(ctx context.Context, path string, d *Dispatcher) {
+	lastMod := modTime(path)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		mod := modTime(path)
+		if mod.IsZero() || mod.Equal(lastMod) {
+			continue
+		}
+		lastMod = mod
+
+		config, err := loadConfig(path)
+		if err != nil {
+			log.Printf("Not reloading %s, keeping the current commands: %v", path, err)
+			continue
+		}
+		d.SetConfig(config)
+		log.Printf("Reloaded %s: %d commands", path, len(config.Commands))
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
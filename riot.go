@@ -1,13 +1,18 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,6 +27,7 @@ var (
 	riotToken          string
 	platformStr        string
 	regionStr          string
+	statsQueue         = soloQueueID // STATS_QUEUE, what !stats counts without an argument
 	httpClient         *http.Client
 	playerCacheFile    = "players.json"
 	playerCacheLock    sync.Mutex
@@ -38,6 +44,8 @@ type PlayerCacheEntry struct {
 	TagLine    string `json:"tagLine"`
 	PUUID      string `json:"puuid"`
 	SummonerID string `json:"summonerId"`
+	Platform   string `json:"platform,omitempty"`
+	Region     string `json:"region,omitempty"`
 	CachedAt   int64  `json:"cachedAt"`
 }
 
@@ -53,6 +61,15 @@ type LeagueEntry struct {
 }
 
 type spectatorResponse struct {
+	GameID            int64  `json:"gameId"`
+	PlatformID        string `json:"platformId"`
+	GameStartTime     int64  `json:"gameStartTime"` // unix millis, 0 while loading
+	GameQueueConfigID int    `json:"gameQueueConfigId"`
+	Participants      []struct {
+		PUUID      string `json:"puuid"`
+		ChampionID int    `json:"championId"`
+		TeamID     int    `json:"teamId"` // 100 blue, 200 red
+	} `json:"participants"`
 	BannedChampions []struct {
 		ChampionID int `json:"championId"`
 		PickTurn   int `json:"pickTurn"`
@@ -67,12 +84,26 @@ type summonerV4Resp struct {
 }
 
 type StreamStatsCacheEntry struct {
-	Wins     int
-	Losses   int
-	Winrate  float64
-	LPStart  map[string]int
-	LPEnd    map[string]int
-	CachedAt int64
+	Wins    int
+	Losses  int
+	Winrate float64
+	Remakes int // left out of everything else
+	// totals over the same games
+	Kills     int
+	Deaths    int
+	Assists   int
+	Champions []ChampionRecord // most played first
+	// main account's rank per queue at the start of the stream and now;
+	// RankStart is nil without a snapshot from the start of the stream
+	RankStart map[string]LeagueEntry
+	RankEnd   map[string]LeagueEntry
+	CachedAt  int64
+}
+
+type ChampionRecord struct {
+	Name   string
+	Wins   int
+	Losses int
 }
 
 // ---------- Initialization ----------
@@ -86,14 +117,134 @@ func initEnv() {
 			platformStr = "na1"
 		}
 		if regionStr == "" {
-			regionStr = "americas"
+			regionStr = cmp.Or(platformRegions[strings.ToLower(platformStr)], "americas")
+		}
+		if v := os.Getenv("STATS_QUEUE"); v != "" {
+			if q, ok := parseQueue(v); ok {
+				statsQueue = q
+			} else {
+				log.Printf("Ignoring invalid STATS_QUEUE %q", v)
+			}
 		}
 		httpClient = &http.Client{Timeout: 15 * time.Second}
 	})
 }
 
 // ---------- Networking ----------
+
+// How long a request may wait out Riot's rate limit before giving up. Chat
+// commands fail fast rather than answer minutes late; background work like
+// betting and the startup lookup can afford to wait.
+const (
+	riotChatWait       = 2 * time.Second
+	riotBackgroundWait = 2 * time.Minute
+)
+
+// Retries for 5xx responses and connection errors, which Riot serves now
+// and then. Never for other 4xx, which would only fail again.
+const (
+	riotRetries       = 3
+	riotRetryBackoff  = 250 * time.Millisecond // doubled each retry, plus jitter
+	riotRetryDeadline = 5 * time.Second        // no retry starts after this
+)
+
+var errRiotRateLimited = errors.New("riot rate limit reached")
+
+// A response other than 200 or 429, so callers can tell a 404 from a
+// rejected key with errors.As
+type riotStatusError struct {
+	Code int
+	Body string
+}
+
+func (e *riotStatusError) Error() string {
+	return fmt.Sprintf("request failed %d: %s", e.Code, e.Body)
+}
+
+// Whether err is a Riot response with one of codes
+func isRiotStatus(err error, codes ...int) bool {
+	var se *riotStatusError
+	return errors.As(err, &se) && slices.Contains(codes, se.Code)
+}
+
+var riotLimits = &riotRateLimiter{}
+
+// Tracks Riot's app rate limit from response headers. Requests wait while
+// the limit is used up, instead of spending the rest of the window on 429s.
+type riotRateLimiter struct {
+	mu           sync.Mutex
+	blockedUntil time.Time
+}
+
+// Time left before requests may be made again
+func (l *riotRateLimiter) wait() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.blockedUntil)
+}
+
+func (l *riotRateLimiter) blockFor(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.blockedUntil) {
+		l.blockedUntil = until
+	}
+}
+
+// Note a response: a 429's Retry-After, or an app limit window that this
+// request used up ("20:1,100:120" against counts "20:1,37:120"). Riot
+// doesn't say when a window started, so a used up window blocks for its
+// full length.
+func (l *riotRateLimiter) observe(resp *http.Response) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		retry := time.Second
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retry = time.Duration(secs) * time.Second
+		}
+		log.Printf("Riot rate limit hit (%s), waiting %s", cmp.Or(resp.Header.Get("X-Rate-Limit-Type"), "unknown"), retry)
+		l.blockFor(retry)
+		return
+	}
+	limits := parseRateLimitHeader(resp.Header.Get("X-App-Rate-Limit"))
+	for window, count := range parseRateLimitHeader(resp.Header.Get("X-App-Rate-Limit-Count")) {
+		if limit, ok := limits[window]; ok && count >= limit {
+			l.blockFor(time.Duration(window) * time.Second)
+		}
+	}
+}
+
+// "20:1,100:120" as window seconds -> number
+func parseRateLimitHeader(h string) map[int]int {
+	windows := map[int]int{}
+	for _, part := range strings.Split(h, ",") {
+		n, window, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			continue
+		}
+		count, err1 := strconv.Atoi(n)
+		secs, err2 := strconv.Atoi(window)
+		if err1 == nil && err2 == nil {
+			windows[secs] = count
+		}
+	}
+	return windows
+}
+
+// GET a Riot API path, waiting up to riotChatWait for the rate limit
 func makeRequest(hostType string, path string) ([]byte, error) {
+	return makeRequestWithin(hostType, path, riotChatWait)
+}
+
+// makeRequest with a longer wait, on RIOT_PLATFORM / RIOT_REGION
+func makeRequestWithin(hostType string, path string, maxWait time.Duration) ([]byte, error) {
+	return makeRoutedRequest(defaultRiotRoute(), hostType, path, maxWait)
+}
+
+// GET a Riot API path from the route's platform or region host, waiting out
+// the rate limit (and retrying 429s) for up to maxWait before failing with
+// errRiotRateLimited. Transient failures are retried riotRetries times with
+// backoff.
+func makeRoutedRequest(route riotRoute, hostType string, path string, maxWait time.Duration) ([]byte, error) {
 	initEnv()
 	if riotToken == "" {
 		return nil, errors.New("RIOT_TOKEN not set")
@@ -102,50 +253,246 @@ func makeRequest(hostType string, path string) ([]byte, error) {
 	var host string
 	switch hostType {
 	case "platform":
-		host = platformStr + ".api.riotgames.com"
+		host = route.Platform + ".api.riotgames.com"
 	case "regional":
-		host = regionStr + ".api.riotgames.com"
+		host = route.Region + ".api.riotgames.com"
+	case "account":
+		// account-v1 isn't served from sea
+		host = strings.Replace(route.Region, "sea", "asia", 1) + ".api.riotgames.com"
 	default:
 		return nil, fmt.Errorf("invalid hostType: %s", hostType)
 	}
-	url := fmt.Sprintf("https://%s%s", host, path)
+	endpoint := fmt.Sprintf("https://%s%s", host, path)
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("X-Riot-Token", riotToken)
-	req.Header.Set("Accept", "application/json")
-	resp, err := httpClient.Do(req)
+	start := time.Now()
+	deadline := start.Add(maxWait)
+	retries := 0
+	for {
+		if wait := riotLimits.wait(); wait > 0 {
+			if time.Now().Add(wait).After(deadline) {
+				return nil, fmt.Errorf("%w, try again in %s", errRiotRateLimited, formatDuration(wait))
+			}
+			time.Sleep(wait)
+		}
+
+		req, _ := http.NewRequest("GET", endpoint, nil)
+		req.Header.Set("X-Riot-Token", riotToken)
+		req.Header.Set("Accept", "application/json")
+		var b []byte
+		resp, err := httpClient.Do(req)
+		if err == nil {
+			b, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			riotLimits.observe(resp)
+			switch {
+			case resp.StatusCode == http.StatusTooManyRequests:
+				continue // waits for Retry-After, or gives up, at the top
+			case resp.StatusCode >= 500:
+				err = &riotStatusError{Code: resp.StatusCode, Body: string(b)}
+			case resp.StatusCode != 200:
+				return nil, &riotStatusError{Code: resp.StatusCode, Body: string(b)}
+			}
+		}
+		if err == nil {
+			recordRiotSuccess()
+			return b, nil
+		}
+
+		backoff := riotRetryBackoff << retries
+		backoff += rand.N(backoff / 2)
+		if retries == riotRetries || time.Since(start)+backoff > riotRetryDeadline {
+			return nil, err
+		}
+		retries++
+		log.Printf("Riot request %s failed, retrying in %s: %v", path, backoff, err)
+		time.Sleep(backoff)
+	}
+}
+
+// Make one cheap request to find out whether RIOT_TOKEN still works, so an
+// expired development key stops the bot at startup instead of failing every
+// command. Only a rejected key is an error; being offline isn't. Skipped
+// with RIOT_SKIP_TOKEN_CHECK=1.
+func ValidateRiotToken() error {
+	if os.Getenv("RIOT_SKIP_TOKEN_CHECK") == "1" {
+		return nil
+	}
+	_, err := makeRequestWithin("platform", "/lol/status/v4/platform-data", riotBackgroundWait)
+	if isRiotStatus(err, http.StatusUnauthorized, http.StatusForbidden) {
+		return errors.New("RIOT_TOKEN is invalid or expired, regenerate it at https://developer.riotgames.com")
+	}
 	if err != nil {
-		return nil, err
+		log.Printf("Couldn't check RIOT_TOKEN: %v", err)
 	}
-	defer resp.Body.Close()
-	b, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("request failed %d: %s", resp.StatusCode, string(b))
+	return nil
+}
+
+// ---------- Routing ----------
+
+// Platform host an account lives on ("euw1") and the regional host serving
+// its matches ("europe")
+type riotRoute struct {
+	Platform string
+	Region   string
+}
+
+var platformRegions = map[string]string{
+	"na1": "americas", "br1": "americas", "la1": "americas", "la2": "americas",
+	"euw1": "europe", "eun1": "europe", "tr1": "europe", "ru": "europe", "me1": "europe",
+	"kr": "asia", "jp1": "asia",
+	"oc1": "sea", "sg2": "sea", "tw2": "sea", "vn2": "sea", "ph2": "sea", "th2": "sea",
+}
+
+// RIOT_PLATFORM and RIOT_REGION
+func defaultRiotRoute() riotRoute {
+	initEnv()
+	return riotRoute{Platform: platformStr, Region: regionStr}
+}
+
+// Check platform is a real one served by region, suggesting the fix for
+// "euw" or a region from the wrong continent
+func validateRiotRoute(platform, region string) error {
+	want, ok := platformRegions[platform]
+	if !ok {
+		if _, ok := platformRegions[platform+"1"]; ok {
+			return fmt.Errorf("unknown platform %q, did you mean %q?", platform, platform+"1")
+		}
+		return fmt.Errorf("unknown platform %q (known: %s)", platform, knownNames(mapKeys(platformRegions)))
+	}
+	if region != want {
+		return fmt.Errorf("platform %s is served by region %q, not %q", platform, want, region)
+	}
+	return nil
+}
+
+func mapKeys(m map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(m))
+	for k := range m {
+		keys[k] = true
+	}
+	return keys
+}
+
+// Region serving a match, from its id's platform prefix ("EUW1_123")
+func matchRoute(matchID string) riotRoute {
+	route := defaultRiotRoute()
+	if prefix, _, ok := strings.Cut(matchID, "_"); ok {
+		if region, ok := platformRegions[strings.ToLower(prefix)]; ok {
+			route = riotRoute{Platform: strings.ToLower(prefix), Region: region}
+		}
 	}
-	return b, nil
+	return route
+}
+
+// ---------- Accounts ----------
+
+// A League account the streamer plays on
+type RiotAccount struct {
+	GameName   string
+	TagLine    string
+	PUUID      string // filled in by ResolveRiotAccounts
+	SummonerID string // likewise, for TFT league lookups
+	Route      riotRoute
+}
+
+func (a RiotAccount) String() string {
+	return a.GameName + "#" + a.TagLine
+}
+
+// Accounts from SUMMONER_NAME, SUMMONER_TAG and SUMMONER_PLATFORM, which
+// may be comma separated lists matched up in order, the first being the
+// main account. One tag applies to every name, and a name written
+// "Name#Tag" brings its own. Accounts without a platform of their own are on
+// RIOT_PLATFORM / RIOT_REGION; with one, the region follows from it.
+func parseRiotAccounts(names, tags, platforms string) ([]RiotAccount, error) {
+	def := defaultRiotRoute()
+	if err := validateRiotRoute(def.Platform, def.Region); err != nil {
+		return nil, fmt.Errorf("RIOT_PLATFORM / RIOT_REGION: %w", err)
+	}
+	tagList := strings.Split(tags, ",")
+	platformList := strings.Split(platforms, ",")
+	var accounts []RiotAccount
+	for i, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		tag := strings.TrimSpace(tagList[min(i, len(tagList)-1)])
+		if n, t, ok := strings.Cut(name, "#"); ok {
+			name, tag = n, t
+		}
+		if tag == "" {
+			return nil, fmt.Errorf("no tag for summoner %q", name)
+		}
+		route := def
+		if platform := strings.ToLower(strings.TrimSpace(platformList[min(i, len(platformList)-1)])); platform != "" && platform != def.Platform {
+			route = riotRoute{Platform: platform, Region: platformRegions[platform]}
+			if err := validateRiotRoute(platform, route.Region); err != nil {
+				return nil, fmt.Errorf("SUMMONER_PLATFORM for %s#%s: %w", name, tag, err)
+			}
+		}
+		accounts = append(accounts, RiotAccount{GameName: name, TagLine: tag, Route: route})
+	}
+	if len(accounts) == 0 {
+		return nil, errors.New("no summoner names")
+	}
+	return accounts, nil
+}
+
+// Look up every account's PUUID and summoner id
+func ResolveRiotAccounts(riot RiotClient, accounts []RiotAccount) error {
+	for i := range accounts {
+		p, err := riot.GetOrCachePlayer(accounts[i].GameName, accounts[i].TagLine, accounts[i].Route)
+		if err != nil {
+			return fmt.Errorf("%s: %w", accounts[i], err)
+		}
+		accounts[i].PUUID = p.PUUID
+		accounts[i].SummonerID = p.SummonerID
+		// as Riot spells it, whatever the case in SUMMONER_NAME
+		accounts[i].GameName = cmp.Or(p.GameName, accounts[i].GameName)
+		accounts[i].TagLine = cmp.Or(p.TagLine, accounts[i].TagLine)
+	}
+	return nil
+}
+
+func accountPUUIDs(accounts []RiotAccount) []string {
+	puuids := make([]string, len(accounts))
+	for i, a := range accounts {
+		puuids[i] = a.PUUID
+	}
+	return puuids
 }
 
 // ---------- Player caching ----------
-func GetOrCachePlayer(gameName, tagLine string) (puuid string, err error) {
+// PUUID of a Riot ID, with its summoner on route's platform
+func GetOrCachePlayer(gameName, tagLine string, route riotRoute) (PlayerCacheEntry, error) {
 	playerCacheLock.Lock()
 	defer playerCacheLock.Unlock()
 
-	cache := PlayerCache{}
-	if _, err := os.Stat(playerCacheFile); err == nil {
-		data, _ := os.ReadFile(playerCacheFile)
-		_ = json.Unmarshal(data, &cache)
-	}
-
+	cache := loadPlayerCache()
 	key := fmt.Sprintf("%s#%s", gameName, tagLine)
-	if p, ok := cache[key]; ok {
-		return p.PUUID, nil
+	// entries from before platforms were saved are on the default one
+	if p, ok := cache[key]; ok && p.PUUID != "" && cmp.Or(p.Platform, platformStr) == route.Platform {
+		return p, nil
 	}
 
 	// Use Account V1 endpoint instead of Summoner V4
-	path := fmt.Sprintf("/riot/account/v1/accounts/by-riot-id/%s/%s", urlEscape(gameName), urlEscape(tagLine))
-	data, err := makeRequest("regional", path) // Use "regional" not "platform"
+	path := fmt.Sprintf("/riot/account/v1/accounts/by-riot-id/%s/%s", url.PathEscape(gameName), url.PathEscape(tagLine))
+	p, err := lookupPlayer(route, path, riotBackgroundWait)
 	if err != nil {
-		return "", err
+		return PlayerCacheEntry{}, err
+	}
+	cache[key] = p
+	savePlayerCache(cache)
+	return p, nil
+}
+
+// Riot ID and summoner of the account-v1 account at path, each request
+// waiting at most maxWait for the rate limiter
+func lookupPlayer(route riotRoute, path string, maxWait time.Duration) (PlayerCacheEntry, error) {
+	data, err := makeRoutedRequest(route, "account", path, maxWait) // Use "regional" not "platform"
+	if err != nil {
+		return PlayerCacheEntry{}, err
 	}
 
 	var accountResp struct {
@@ -154,43 +501,186 @@ func GetOrCachePlayer(gameName, tagLine string) (puuid string, err error) {
 		TagLine  string `json:"tagLine"`
 	}
 	if err := json.Unmarshal(data, &accountResp); err != nil {
-		return "", err
+		return PlayerCacheEntry{}, err
 	}
 
 	// Now get summoner ID using PUUID
-	summonerPath := fmt.Sprintf("/lol/summoner/v4/summoners/by-puuid/%s", accountResp.PUUID)
-	summonerData, err := makeRequest("platform", summonerPath)
+	summonerPath := fmt.Sprintf("/lol/summoner/v4/summoners/by-puuid/%s", url.PathEscape(accountResp.PUUID))
+	summonerData, err := makeRoutedRequest(route, "platform", summonerPath, maxWait)
 	if err != nil {
-		return "", err
+		return PlayerCacheEntry{}, err
 	}
 
 	var s summonerV4Resp
 	if err := json.Unmarshal(summonerData, &s); err != nil {
-		return "", err
+		return PlayerCacheEntry{}, err
 	}
 
-	cache[key] = PlayerCacheEntry{
+	return PlayerCacheEntry{
 		GameName:   accountResp.GameName,
 		TagLine:    accountResp.TagLine,
 		PUUID:      accountResp.PUUID,
 		SummonerID: s.ID,
+		Platform:   route.Platform,
+		Region:     route.Region,
 		CachedAt:   time.Now().Unix(),
+	}, nil
+}
+
+// players.json, empty if missing or corrupt. Caller holds playerCacheLock.
+func loadPlayerCache() PlayerCache {
+	cache := PlayerCache{}
+	if data, err := os.ReadFile(playerCacheFile); err == nil {
+		if err := json.Unmarshal(data, &cache); err != nil {
+			log.Printf("Error parsing %s: %v", playerCacheFile, err)
+		}
 	}
+	return cache
+}
+
+// Caller holds playerCacheLock
+func savePlayerCache(cache PlayerCache) {
 	b, _ := json.MarshalIndent(cache, "", "  ")
-	_ = os.WriteFile(playerCacheFile, b, 0644)
-	return accountResp.PUUID, nil
+	if err := writeFileAtomic(playerCacheFile, b); err != nil {
+		log.Printf("Error writing %s: %v", playerCacheFile, err)
+	}
 }
 
 // ---------- Champion cache ----------
-// ---------- Champion cache ----------
+
+// champions.json holds id -> name plus the Data Dragon version it was built
+// from under "version", which the id parsing skips
+const (
+	ddragonVersionsURL    = "https://ddragon.leagueoflegends.com/api/versions.json"
+	ddragonChampionsURL   = "https://ddragon.leagueoflegends.com/cdn/%s/data/en_US/championFull.json"
+	championsVersionKey   = "version"
+	championCheckInterval = time.Hour
+)
+
+// Data Dragon version championsMap was built from, "" if unknown
+var championsVersion string
+
+// Load champions.json, then bring it up to date from Data Dragon if a newer
+// patch is out. Offline, the file is used as it is.
 func LoadChampionMap() error {
+	championsMu.Lock()
+	loaded := championsMap != nil
+	var fileErr error
+	if !loaded {
+		fileErr = loadChampionMapLocked()
+	}
+	championsMu.Unlock()
+	if loaded {
+		return nil // Already loaded
+	}
+
+	if _, err := RefreshChampionMap(); err != nil {
+		if fileErr != nil {
+			return fmt.Errorf("%w (and Data Dragon failed: %v)", fileErr, err)
+		}
+		log.Printf("Couldn't update champions from Data Dragon, using %s: %v", championsCacheFile, err)
+	}
+	return nil
+}
+
+// Download the champion list when Data Dragon has a version other than the
+// one loaded, saving it to champions.json. Reports whether it changed.
+func RefreshChampionMap() (bool, error) {
+	initEnv()
+	var versions []string
+	if err := ddragonGet(ddragonVersionsURL, &versions); err != nil {
+		return false, err
+	}
+	if len(versions) == 0 {
+		return false, errors.New("no Data Dragon versions")
+	}
+	version := versions[0]
+
+	championsMu.Lock()
+	current := championsMap != nil && championsVersion == version
+	championsMu.Unlock()
+	if current {
+		return false, nil
+	}
+
+	var full struct {
+		Data map[string]struct {
+			Key  string `json:"key"` // numeric id as a string
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := ddragonGet(fmt.Sprintf(ddragonChampionsURL, version), &full); err != nil {
+		return false, err
+	}
+	loaded := make(map[int]string, len(full.Data))
+	file := map[string]string{championsVersionKey: version}
+	for _, c := range full.Data {
+		id, err := strconv.Atoi(c.Key)
+		if err != nil {
+			continue
+		}
+		loaded[id] = c.Name
+		file[c.Key] = c.Name
+	}
+	if len(loaded) == 0 {
+		return false, fmt.Errorf("no champions in Data Dragon %s", version)
+	}
+
 	championsMu.Lock()
 	defer championsMu.Unlock()
+	championsMap = loaded
+	championsVersion = version
+	b, _ := json.MarshalIndent(file, "", "  ")
+	if err := writeFileAtomic(championsCacheFile, b); err != nil {
+		log.Printf("Error writing %s: %v", championsCacheFile, err)
+	}
+	log.Printf("Loaded %d champions from Data Dragon %s", len(loaded), version)
+	return true, nil
+}
 
-	if championsMap != nil {
-		return nil // Already loaded
+// Check Data Dragon for a new patch every championCheckInterval
+func StartChampionRefresher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(championCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := RefreshChampionMap(); err != nil {
+					log.Printf("Checking Data Dragon for new champions: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func ddragonGet(url string, out any) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Data Dragon request failed %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Re-read champions.json even if it was already loaded, returning the count
+func ReloadChampionMap() (int, error) {
+	championsMu.Lock()
+	defer championsMu.Unlock()
+
+	if err := loadChampionMapLocked(); err != nil {
+		return 0, err
 	}
+	return len(championsMap), nil
+}
 
+// Caller holds championsMu
+func loadChampionMapLocked() error {
 	// Load from static file
 	data, err := os.ReadFile(championsCacheFile)
 	if err != nil {
@@ -204,14 +694,16 @@ func LoadChampionMap() error {
 	}
 
 	// Convert string keys to int keys
-	championsMap = make(map[int]string)
+	loaded := make(map[int]string)
 	for idStr, name := range championsStrMap {
 		id, err := strconv.Atoi(idStr)
 		if err != nil {
-			continue // Skip invalid entries
+			continue // Skip invalid entries, and the version
 		}
-		championsMap[id] = name
+		loaded[id] = name
 	}
+	championsMap = loaded
+	championsVersion = championsStrMap[championsVersionKey]
 
 	log.Printf("Loaded %d champions from %s", len(championsMap), championsCacheFile)
 	return nil
@@ -222,7 +714,7 @@ func GetChampionName(id int) string {
 	defer championsMu.Unlock()
 
 	if championsMap == nil {
-		if err := LoadChampionMap(); err != nil {
+		if err := loadChampionMapLocked(); err != nil {
 			log.Printf("Error loading champions: %v", err)
 			return fmt.Sprintf("Unknown(%d)", id)
 		}
@@ -235,87 +727,452 @@ func GetChampionName(id int) string {
 }
 
 // ---------- Current rank ----------
-func GetCurrentRank(puuid string) ([]LeagueEntry, error) {
-	path := fmt.Sprintf("/lol/league/v4/entries/by-puuid/%s", puuid)
-	data, err := makeRequest("platform", path)
+func GetCurrentRank(a RiotAccount) ([]LeagueEntry, error) {
+	path := fmt.Sprintf("/lol/league/v4/entries/by-puuid/%s", url.PathEscape(a.PUUID))
+	data, err := makeRoutedRequest(a.Route, "platform", path, riotChatWait)
 	if err != nil {
 		return nil, err
 	}
 	var ranks []LeagueEntry
-	_ = json.Unmarshal(data, &ranks)
+	if err := json.Unmarshal(data, &ranks); err != nil {
+		return nil, err
+	}
 	return ranks, nil
 }
 
-// ---------- Active game bans ----------
-func GetActiveMatchBans(puuid string) ([]string, error) {
-	path := fmt.Sprintf("/lol/spectator/v5/active-games/by-summoner/%s", puuid)
-	data, err := makeRequest("platform", path)
+const (
+	soloQueue = "RANKED_SOLO_5x5"
+	flexQueue = "RANKED_FLEX_SR"
+)
+
+// The entry for queue. Solo queue falls back to flex when the account has
+// only played flex this season.
+func pickRank(ranks []LeagueEntry, queue string) (LeagueEntry, bool) {
+	for _, r := range ranks {
+		if r.QueueType == queue {
+			return r, true
+		}
+	}
+	if queue == soloQueue {
+		return pickRank(ranks, flexQueue)
+	}
+	return LeagueEntry{}, false
+}
+
+// ---------- Active game ----------
+
+// The game puuid is playing, nil when they aren't in one. maxWait is how
+// long to wait out the rate limit.
+func GetActiveGame(a RiotAccount, maxWait time.Duration) (*spectatorResponse, error) {
+	path := fmt.Sprintf("/lol/spectator/v5/active-games/by-summoner/%s", url.PathEscape(a.PUUID))
+	data, err := makeRoutedRequest(a.Route, "platform", path, maxWait)
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
-			return []string{}, nil
+		if isRiotStatus(err, http.StatusNotFound) {
+			return nil, nil
 		}
 		return nil, err
 	}
 	var resp spectatorResponse
-	_ = json.Unmarshal(data, &resp)
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Match-v5 id of a spectator game, e.g. "NA1_5012345678"
+func (g *spectatorResponse) MatchID() string {
+	return fmt.Sprintf("%s_%d", strings.ToUpper(g.PlatformID), g.GameID)
+}
+
+// The game any of the accounts is in, checked in order, with the account
+// playing it. nil when none are in a game.
+func GetActiveGameOf(accounts []RiotAccount, maxWait time.Duration) (*spectatorResponse, RiotAccount, error) {
+	var firstErr error
+	for _, a := range accounts {
+		game, err := GetActiveGame(a, maxWait)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if game != nil {
+			return game, a, nil
+		}
+	}
+	return nil, RiotAccount{}, firstErr
+}
+
+func GetActiveMatchBans(accounts []RiotAccount) ([]string, error) {
+	resp, _, err := GetLiveGame(accounts)
+	if err != nil {
+		return nil, err
+	}
 	bans := []string{}
+	if resp == nil {
+		return bans, nil
+	}
 	for _, b := range resp.BannedChampions {
 		bans = append(bans, GetChampionName(b.ChampionID))
 	}
 	return bans, nil
 }
 
+// Names of queues by id, for the common ones
+var queueNames = map[int]string{
+	400:  "Normal Draft",
+	420:  "Ranked Solo/Duo",
+	430:  "Normal Blind",
+	440:  "Ranked Flex",
+	450:  "ARAM",
+	490:  "Quickplay",
+	700:  "Clash",
+	900:  "ARURF",
+	1700: "Arena",
+}
+
+func queueName(id int) string {
+	if id == allQueues {
+		return "All queues"
+	}
+	if name, ok := queueNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("Queue %d", id)
+}
+
+const (
+	allQueues   = 0
+	soloQueueID = 420
+	flexQueueID = 440
+)
+
+// What chat can call a queue in !winrate and STATS_QUEUE
+var queueAliases = map[string]int{
+	"all":    allQueues,
+	"solo":   soloQueueID,
+	"soloq":  soloQueueID,
+	"ranked": soloQueueID,
+	"flex":   flexQueueID,
+	"normal": 400,
+	"draft":  400,
+	"blind":  430,
+	"aram":   450,
+	"quick":  490,
+	"clash":  700,
+	"arurf":  900,
+	"arena":  1700,
+}
+
+// A queue alias or a queue id
+func parseQueue(s string) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if q, ok := queueAliases[s]; ok {
+		return q, true
+	}
+	if q, err := strconv.Atoi(s); err == nil && q > 0 {
+		return q, true
+	}
+	return 0, false
+}
+
+// ---------- Live game ----------
+
+const liveGameCacheTTL = 30 * time.Second
+
+var (
+	liveGameCache   = map[string]liveGameEntry{} // by the accounts' puuids
+	liveGameCacheMu sync.Mutex
+)
+
+type liveGameEntry struct {
+	Game     *spectatorResponse // nil when not in a game
+	PUUID    string             // the account playing
+	CachedAt time.Time
+}
+
+// Like GetActiveGameOf, kept for liveGameCacheTTL so !livegame, !bans and
+// !gametime spam shares one spectator call
+func GetLiveGame(accounts []RiotAccount) (*spectatorResponse, string, error) {
+	key := strings.Join(accountPUUIDs(accounts), ",")
+	liveGameCacheMu.Lock()
+	if e, ok := liveGameCache[key]; ok && time.Since(e.CachedAt) < liveGameCacheTTL {
+		liveGameCacheMu.Unlock()
+		return e.Game, e.PUUID, nil
+	}
+	liveGameCacheMu.Unlock()
+
+	game, account, err := GetActiveGameOf(accounts, riotChatWait)
+	if err != nil {
+		return nil, "", err
+	}
+	liveGameCacheMu.Lock()
+	liveGameCache[key] = liveGameEntry{Game: game, PUUID: account.PUUID, CachedAt: time.Now()}
+	liveGameCacheMu.Unlock()
+	return game, account.PUUID, nil
+}
+
+// "Ahri | 12:34 into Ranked Solo/Duo | Blue: ... | Red: ..."
+func describeLiveGame(game *spectatorResponse, puuid string) string {
+	var champion string
+	var blue, red []string
+	for _, p := range game.Participants {
+		name := GetChampionName(p.ChampionID)
+		if p.PUUID == puuid {
+			champion = name
+		}
+		if p.TeamID == 100 {
+			blue = append(blue, name)
+		} else {
+			red = append(red, name)
+		}
+	}
+	length := "Loading into " + queueName(game.GameQueueConfigID)
+	if game.GameStartTime > 0 {
+		length = gameClock(game) + " into " + queueName(game.GameQueueConfigID)
+	}
+	return fmt.Sprintf("Playing %s | %s | Blue: %s | Red: %s", cmp.Or(champion, "?"), length, strings.Join(blue, ", "), strings.Join(red, ", "))
+}
+
+// "Jinx 3W-1L, Kai'Sa 1W-2L" for the n most played champions
+func describeChampions(s StreamStatsCacheEntry, n int) string {
+	if len(s.Champions) == 0 {
+		return "No games this stream yet."
+	}
+	var parts []string
+	for _, r := range s.Champions[:min(n, len(s.Champions))] {
+		parts = append(parts, fmt.Sprintf("%s %dW-%dL", r.Name, r.Wins, r.Losses))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// "34/21/50, 4.0 KDA" over the stream's games
+func describeKDA(s StreamStatsCacheEntry) string {
+	if s.Wins+s.Losses == 0 {
+		return "No games this stream yet."
+	}
+	ratio := "Perfect"
+	if s.Deaths > 0 {
+		ratio = fmt.Sprintf("%.1f", float64(s.Kills+s.Assists)/float64(s.Deaths))
+	}
+	return fmt.Sprintf("%d/%d/%d, %s KDA", s.Kills, s.Deaths, s.Assists, ratio)
+}
+
+// ---------- Opponents ----------
+
+// How long GetOpponentRanks waits for all the lookups together
+const opponentRanksWait = 4 * time.Second
+
+// Enemy ranks of the game last asked about, which don't change during it
+var (
+	opponentRanks   = map[int64][]string{} // by game id
+	opponentRanksMu sync.Mutex
+)
+
+// Solo queue rank of each player on the other team from the account
+// playing game, "?" where the lookup failed or ran past opponentRanksWait.
+// Complete answers are kept for the rest of the game.
+func GetOpponentRanks(game *spectatorResponse, playing RiotAccount) []string {
+	opponentRanksMu.Lock()
+	if ranks, ok := opponentRanks[game.GameID]; ok {
+		opponentRanksMu.Unlock()
+		return ranks
+	}
+	opponentRanksMu.Unlock()
+
+	team := 0
+	for _, p := range game.Participants {
+		if p.PUUID == playing.PUUID {
+			team = p.TeamID
+		}
+	}
+	var enemies []string
+	for _, p := range game.Participants {
+		if p.TeamID != team {
+			enemies = append(enemies, p.PUUID)
+		}
+	}
+
+	type lookup struct {
+		i    int
+		rank string
+		ok   bool
+	}
+	results := make(chan lookup, len(enemies)) // buffered so late lookups don't block
+	for i, puuid := range enemies {
+		go func() {
+			entries, err := GetCurrentRank(RiotAccount{PUUID: puuid, Route: playing.Route})
+			if err != nil {
+				results <- lookup{i, "?", false}
+				return
+			}
+			entry, ok := pickRank(entries, soloQueue)
+			if !ok || entry.QueueType != soloQueue {
+				results <- lookup{i, "unranked", true}
+				return
+			}
+			results <- lookup{i, shortRank(entry), true}
+		}()
+	}
+
+	// the lookups share the chat's rate limit budget; whatever hasn't come
+	// back by the deadline is left as "?"
+	ranks := make([]string, len(enemies))
+	for i := range ranks {
+		ranks[i] = "?"
+	}
+	failed := false
+	deadline := time.NewTimer(opponentRanksWait)
+	defer deadline.Stop()
+collect:
+	for range enemies {
+		select {
+		case r := <-results:
+			ranks[r.i] = r.rank
+			failed = failed || !r.ok
+		case <-deadline.C:
+			failed = true
+			break collect
+		}
+	}
+
+	if !failed {
+		opponentRanksMu.Lock()
+		clear(opponentRanks)
+		opponentRanks[game.GameID] = ranks
+		opponentRanksMu.Unlock()
+	}
+	return ranks
+}
+
+// "Gold II", or just the tier from Master up
+func shortRank(e LeagueEntry) string {
+	if e.Tier == "" {
+		return "unranked"
+	}
+	tier := strings.ToUpper(e.Tier[:1]) + strings.ToLower(e.Tier[1:])
+	if isApexTier(e.Tier) {
+		return tier
+	}
+	return tier + " " + e.Rank
+}
+
+// "12:34" since the game started
+func gameClock(game *spectatorResponse) string {
+	elapsed := time.Since(time.UnixMilli(game.GameStartTime))
+	return fmt.Sprintf("%d:%02d", int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+}
+
+// "12:34 into the game", or loading while the game hasn't started
+func describeGameTime(game *spectatorResponse) string {
+	if game.GameStartTime == 0 {
+		return "In champ select / loading"
+	}
+	return gameClock(game) + " into the game"
+}
+
 // ---------- Stream stats ----------
-func GetStreamStats(puuid string, startTime int64) (StreamStatsCacheEntry, error) {
+
+// How long GetStreamStats answers from its cache, so wins and LP catch up
+// with new games
+const streamStatsTTL = 2 * time.Minute
+
+// Wins and losses in queue (or allQueues) since startTime across every
+// account, with the main one's (accounts[0]) rank now and in the stream's
+// rank snapshot. A match two of the accounts played in counts once, for
+// whichever comes first.
+func GetStreamStats(accounts []RiotAccount, startTime int64, queue int) (StreamStatsCacheEntry, error) {
+	puuids := accountPUUIDs(accounts)
 	// End time is always now
 	endTime := time.Now().Unix()
-	key := fmt.Sprintf("%s_%d", puuid, startTime)
+	key := fmt.Sprintf("%s_%d_%d", strings.Join(puuids, ","), startTime, queue)
 
 	streamCacheMu.Lock()
-	if val, ok := streamCache[key]; ok {
+	if val, ok := streamCache[key]; ok && time.Since(time.Unix(val.CachedAt, 0)) < streamStatsTTL {
 		streamCacheMu.Unlock()
 		return val, nil
 	}
 	streamCacheMu.Unlock()
 
-	path := fmt.Sprintf("/lol/match/v5/matches/by-puuid/%s/ids?startTime=%d&endTime=%d", puuid, startTime, endTime)
-	data, err := makeRequest("regional", path)
-	if err != nil {
-		return StreamStatsCacheEntry{}, err
-	}
 	var matchIDs []string
-	_ = json.Unmarshal(data, &matchIDs)
-
-	wins, losses := 0, 0
-	for _, matchID := range matchIDs {
-		matchPath := fmt.Sprintf("/lol/match/v5/matches/%s", matchID)
-		matchData, err := makeRequest("regional", matchPath)
+	seen := map[string]bool{}
+	for _, a := range accounts {
+		path := fmt.Sprintf("/lol/match/v5/matches/by-puuid/%s/ids?startTime=%d&endTime=%d", url.PathEscape(a.PUUID), startTime, endTime)
+		if queue != allQueues {
+			path += fmt.Sprintf("&queue=%d", queue)
+		}
+		data, err := makeRoutedRequest(a.Route, "regional", path, riotChatWait)
 		if err != nil {
-			continue
+			return StreamStatsCacheEntry{}, err
 		}
-		var matchJSON map[string]interface{}
-		_ = json.Unmarshal(matchData, &matchJSON)
-		info, ok := matchJSON["info"].(map[string]interface{})
-		if !ok {
-			continue
+		var ids []string
+		_ = json.Unmarshal(data, &ids)
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				matchIDs = append(matchIDs, id)
+			}
 		}
-		participants, ok := info["participants"].([]interface{})
-		if !ok {
+	}
+
+	entry := tallyMatches(FetchMatches(matchIDs, riotChatWait), puuids)
+	entry.RankEnd = map[string]LeagueEntry{}
+	entry.CachedAt = time.Now().Unix()
+	ranks, _ := GetCurrentRank(accounts[0])
+	for _, r := range ranks {
+		entry.RankEnd[r.QueueType] = r
+	}
+	if start, ok := rankSnapshots.Get(startTime, puuids[0]); ok {
+		entry.RankStart = map[string]LeagueEntry{}
+		for _, r := range start {
+			entry.RankStart[r.QueueType] = r
+		}
+	}
+
+	streamCacheMu.Lock()
+	streamCache[key] = entry
+	streamCacheMu.Unlock()
+
+	return entry, nil
+}
+
+// Wins, losses, remakes, KDA and champions of the matches for whichever of
+// puuids played each one; nil matches are skipped
+func tallyMatches(matches []*Match, puuids []string) StreamStatsCacheEntry {
+	ours := map[string]bool{}
+	for _, puuid := range puuids {
+		ours[puuid] = true
+	}
+	wins, losses, remakes := 0, 0, 0
+	var kills, deaths, assists int
+	records := map[string]*ChampionRecord{}
+	for _, match := range matches {
+		if match == nil {
 			continue
 		}
-		for _, p := range participants {
-			participant, ok := p.(map[string]interface{})
-			if !ok {
+		for _, p := range match.Info.Participants {
+			if !ours[p.PUUID] {
 				continue
 			}
-			if participant["puuid"] == puuid {
-				if win, ok := participant["win"].(bool); ok && win {
-					wins++
-				} else {
-					losses++
-				}
+			if match.IsRemake(&p) {
+				remakes++
 				break
 			}
+			kills += p.Kills
+			deaths += p.Deaths
+			assists += p.Assists
+			name := cmp.Or(p.ChampionName, GetChampionName(p.ChampionID))
+			if records[name] == nil {
+				records[name] = &ChampionRecord{Name: name}
+			}
+			if p.Win {
+				wins++
+				records[name].Wins++
+			} else {
+				losses++
+				records[name].Losses++
+			}
+			break
 		}
 	}
 
@@ -325,31 +1182,63 @@ func GetStreamStats(puuid string, startTime int64) (StreamStatsCacheEntry, error
 		winrate = float64(wins) / float64(total) * 100
 	}
 
-	ranks, _ := GetCurrentRank(puuid)
-	LPStart := map[string]int{}
-	LPEnd := map[string]int{}
-	for _, r := range ranks {
-		LPStart[r.QueueType] = r.LeaguePoints - (wins - losses) // approx start LP
-		LPEnd[r.QueueType] = r.LeaguePoints
-	}
-
 	entry := StreamStatsCacheEntry{
-		Wins:     wins,
-		Losses:   losses,
-		Winrate:  winrate,
-		LPStart:  LPStart,
-		LPEnd:    LPEnd,
-		CachedAt: time.Now().Unix(),
+		Wins:    wins,
+		Losses:  losses,
+		Winrate: winrate,
+		Remakes: remakes,
+		Kills:   kills,
+		Deaths:  deaths,
+		Assists: assists,
 	}
+	for _, r := range records {
+		entry.Champions = append(entry.Champions, *r)
+	}
+	slices.SortFunc(entry.Champions, func(a, b ChampionRecord) int {
+		return cmp.Or(cmp.Compare(b.Wins+b.Losses, a.Wins+a.Losses), strings.Compare(a.Name, b.Name))
+	})
+	return entry
+}
 
-	streamCacheMu.Lock()
-	streamCache[key] = entry
-	streamCacheMu.Unlock()
+// ---------- Shutdown ----------
 
-	return entry, nil
+// Wait for in-flight cache writes to finish so nothing is left half-written
+func FlushCaches() {
+	playerCacheLock.Lock()
+	defer playerCacheLock.Unlock()
+	championsMu.Lock()
+	defer championsMu.Unlock()
+}
+
+// ---------- Profile links ----------
+
+// op.gg names servers its own way
+var opggRegions = map[string]string{
+	"na1": "na", "br1": "br", "la1": "lan", "la2": "las",
+	"euw1": "euw", "eun1": "eune", "tr1": "tr", "ru": "ru", "me1": "me",
+	"kr": "kr", "jp1": "jp",
+	"oc1": "oce", "sg2": "sg", "tw2": "tw", "vn2": "vn", "ph2": "ph", "th2": "th",
+}
+
+// "https://op.gg/lol/summoners/euw/Name-Tag"
+func opggURL(a RiotAccount) string {
+	return fmt.Sprintf("https://op.gg/lol/summoners/%s/%s-%s", cmp.Or(opggRegions[a.Route.Platform], "na"),
+		url.PathEscape(a.GameName), url.PathEscape(a.TagLine))
+}
+
+// "https://u.gg/lol/profile/euw1/Name-Tag/overview"
+func uggURL(a RiotAccount) string {
+	return fmt.Sprintf("https://u.gg/lol/profile/%s/%s-%s/overview", a.Route.Platform,
+		url.PathEscape(a.GameName), url.PathEscape(a.TagLine))
 }
 
 // ---------- Helpers ----------
-func urlEscape(s string) string {
-	return strings.ReplaceAll(s, " ", "%20")
+
+// Write to a temp file and rename it over path so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
 }
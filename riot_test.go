@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A canned Riot response
+type riotReply struct {
+	status     int
+	retryAfter int // seconds, for 429s
+	body       string
+}
+
+// Sends every request, whatever its host, to target
+type rewriteTransport struct{ target *url.URL }
+
+func (rt rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = rt.target.Scheme, rt.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// Point makeRoutedRequest at a server answering with replies in order, the
+// last one again once they run out, and return the paths it was asked for
+func fakeRiot(t *testing.T, replies ...riotReply) func() []string {
+	t.Helper()
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reply := replies[min(len(paths), len(replies)-1)]
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+		if r.Header.Get("X-Riot-Token") != "test-token" {
+			reply = riotReply{status: http.StatusUnauthorized}
+		}
+		if reply.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(reply.retryAfter))
+		}
+		w.WriteHeader(reply.status)
+		w.Write([]byte(reply.body))
+	}))
+	target, _ := url.Parse(srv.URL)
+
+	initEnv()
+	oldToken, oldClient, oldLimits := riotToken, httpClient, riotLimits
+	riotToken = "test-token"
+	httpClient = &http.Client{Transport: rewriteTransport{target}, Timeout: 5 * time.Second}
+	riotLimits = &riotRateLimiter{}
+	t.Cleanup(func() {
+		srv.Close()
+		riotToken, httpClient, riotLimits = oldToken, oldClient, oldLimits
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+var testRoute = riotRoute{Platform: "euw1", Region: "europe"}
+
+func TestRiotRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []riotReply
+		maxWait  time.Duration
+		want     string // body, "" when the request should fail
+		err      error
+		requests int
+		minTook  time.Duration
+	}{
+		{
+			name:     "429 then 200",
+			replies:  []riotReply{{status: 429, retryAfter: 1}, {status: 200, body: `["EUW1_1"]`}},
+			maxWait:  5 * time.Second,
+			want:     `["EUW1_1"]`,
+			requests: 2,
+			minTook:  time.Second,
+		},
+		{
+			name:     "429 without a Retry-After",
+			replies:  []riotReply{{status: 429}, {status: 200, body: "{}"}},
+			maxWait:  5 * time.Second,
+			want:     "{}",
+			requests: 2,
+			minTook:  time.Second,
+		},
+		{
+			name:     "Retry-After past maxWait",
+			replies:  []riotReply{{status: 429, retryAfter: 30}, {status: 200, body: "{}"}},
+			maxWait:  riotChatWait,
+			err:      errRiotRateLimited,
+			requests: 1,
+		},
+		{
+			name:     "no limit hit",
+			replies:  []riotReply{{status: 200, body: "[]"}},
+			maxWait:  riotChatWait,
+			want:     "[]",
+			requests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeRiot(t, tt.replies...)
+			start := time.Now()
+			body, err := makeRoutedRequest(testRoute, "regional", "/lol/match/v5/matches/by-puuid/abc/ids", tt.maxWait)
+			took := time.Since(start)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("error %v, want %v", err, tt.err)
+				}
+			} else if err != nil || string(body) != tt.want {
+				t.Errorf("got %q, %v; want %q", body, err, tt.want)
+			}
+			if n := len(requests()); n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+			if took < tt.minTook {
+				t.Errorf("returned after %s, before the %s Riot asked for", took, tt.minTook)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitHeader(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[int]int
+	}{
+		{"20:1,100:120", map[int]int{1: 20, 120: 100}},
+		{" 20:1 , 37:120 ", map[int]int{1: 20, 120: 37}},
+		{"", map[int]int{}},
+		{"garbage,5:10,x:y", map[int]int{10: 5}},
+	}
+	for _, tt := range tests {
+		got := parseRateLimitHeader(tt.header)
+		if len(got) != len(tt.want) {
+			t.Errorf("parseRateLimitHeader(%q) = %v, want %v", tt.header, got, tt.want)
+			continue
+		}
+		for window, n := range tt.want {
+			if got[window] != n {
+				t.Errorf("parseRateLimitHeader(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRiotRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []riotReply
+		want     string // body, "" when the request should fail
+		status   int    // riotStatusError code when it fails
+		requests int
+	}{
+		{"503 then 200", []riotReply{{status: 503}, {status: 200, body: "{}"}}, "{}", 0, 2},
+		{"500, 502 then 200", []riotReply{{status: 500}, {status: 502}, {status: 200, body: "[]"}}, "[]", 0, 3},
+		{"always 503", []riotReply{{status: 503}}, "", 503, riotRetries + 1},
+		{"503 then 404", []riotReply{{status: 503}, {status: 404}}, "", 404, 2},
+		{"404", []riotReply{{status: 404}, {status: 200, body: "{}"}}, "", 404, 1},
+		{"400", []riotReply{{status: 400}, {status: 200, body: "{}"}}, "", 400, 1},
+		{"401", []riotReply{{status: 401}, {status: 200, body: "{}"}}, "", 401, 1},
+		{"403", []riotReply{{status: 403}, {status: 200, body: "{}"}}, "", 403, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeRiot(t, tt.replies...)
+			body, err := makeRoutedRequest(testRoute, "platform", "/lol/league/v4/entries/by-puuid/abc", riotChatWait)
+
+			if tt.status != 0 {
+				var se *riotStatusError
+				if !errors.As(err, &se) || se.Code != tt.status {
+					t.Errorf("error %v, want status %d", err, tt.status)
+				}
+			} else if err != nil || string(body) != tt.want {
+				t.Errorf("got %q, %v; want %q", body, err, tt.want)
+			}
+			if n := len(requests()); n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestRiotIDPathEscaping(t *testing.T) {
+	tests := []struct {
+		name              string
+		gameName, tagLine string
+		want              string // account-v1 path Riot is asked for
+	}{
+		{"plain", "Faker", "KR1", "/riot/account/v1/accounts/by-riot-id/Faker/KR1"},
+		{"spaces", "Hide on bush", "KR 1", "/riot/account/v1/accounts/by-riot-id/Hide%20on%20bush/KR%201"},
+		{"plus signs", "C++ main", "1+1", "/riot/account/v1/accounts/by-riot-id/C++%20main/1+1"},
+		{"cjk", "名字", "日本", "/riot/account/v1/accounts/by-riot-id/%E5%90%8D%E5%AD%97/%E6%97%A5%E6%9C%AC"},
+		{"hangul", "페이커", "KR1", "/riot/account/v1/accounts/by-riot-id/%ED%8E%98%EC%9D%B4%EC%BB%A4/KR1"},
+		{"reserved characters", "a/b?c#d", "%20", "/riot/account/v1/accounts/by-riot-id/a%2Fb%3Fc%23d/%2520"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir()) // GetOrCachePlayer keeps players.json in the working directory
+			requests := fakeRiot(t,
+				riotReply{status: 200, body: `{"puuid": "p/1+2", "gameName": "x", "tagLine": "y"}`},
+				riotReply{status: 200, body: `{"id": "summoner"}`})
+
+			p, err := GetOrCachePlayer(tt.gameName, tt.tagLine, testRoute)
+			if err != nil || p.PUUID != "p/1+2" {
+				t.Fatalf("got %+v, %v", p, err)
+			}
+			paths := requests()
+			if len(paths) != 2 {
+				t.Fatalf("requested %q, want an account and a summoner lookup", paths)
+			}
+			if paths[0] != tt.want {
+				t.Errorf("requested %s, want %s", paths[0], tt.want)
+			}
+			// the PUUID the account lookup returned is escaped too
+			if want := "/lol/summoner/v4/summoners/by-puuid/p%2F1+2"; paths[1] != want {
+				t.Errorf("requested %s, want %s", paths[1], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import "time"
+
+// What the dispatcher needs from the Riot API. riotAPI is the real thing;
+// anything else can stand in for it, so handlers can run against canned
+// responses without a RIOT_TOKEN.
+type RiotClient interface {
+	GetOrCachePlayer(gameName, tagLine string, route riotRoute) (PlayerCacheEntry, error)
+	RefreshPlayer(a RiotAccount, maxWait time.Duration) (PlayerCacheEntry, error)
+
+	GetCurrentRank(a RiotAccount) ([]LeagueEntry, error)
+	GetTFTRank(a RiotAccount) ([]LeagueEntry, error)
+
+	GetActiveGameOf(accounts []RiotAccount, maxWait time.Duration) (*spectatorResponse, RiotAccount, error)
+	GetLiveGame(accounts []RiotAccount) (*spectatorResponse, string, error)
+	GetActiveMatchBans(accounts []RiotAccount) ([]string, error)
+	GetOpponentRanks(game *spectatorResponse, playing RiotAccount) []string
+
+	GetStreamStats(accounts []RiotAccount, startTime int64, queue int) (StreamStatsCacheEntry, error)
+	GetTFTStreamStats(accounts []RiotAccount, startTime int64) (TFTStreamStats, error)
+	GetLastMatch(accounts []RiotAccount) (*Match, *MatchParticipant, error)
+	GetRecentResults(a RiotAccount) ([]bool, error)
+	GetMatchResult(matchID, puuid string, maxWait time.Duration) (MatchResult, bool, error)
+}
+
+// The Riot API through riot.go, with its rate limiter and caches
+type riotAPI struct{}
+
+func (riotAPI) GetOrCachePlayer(gameName, tagLine string, route riotRoute) (PlayerCacheEntry, error) {
+	return GetOrCachePlayer(gameName, tagLine, route)
+}
+
+func (riotAPI) RefreshPlayer(a RiotAccount, maxWait time.Duration) (PlayerCacheEntry, error) {
+	return RefreshPlayer(a, maxWait)
+}
+
+func (riotAPI) GetCurrentRank(a RiotAccount) ([]LeagueEntry, error) {
+	return GetCurrentRank(a)
+}
+
+func (riotAPI) GetTFTRank(a RiotAccount) ([]LeagueEntry, error) {
+	return GetTFTRank(a)
+}
+
+func (riotAPI) GetActiveGameOf(accounts []RiotAccount, maxWait time.Duration) (*spectatorResponse, RiotAccount, error) {
+	return GetActiveGameOf(accounts, maxWait)
+}
+
+func (riotAPI) GetLiveGame(accounts []RiotAccount) (*spectatorResponse, string, error) {
+	return GetLiveGame(accounts)
+}
+
+func (riotAPI) GetActiveMatchBans(accounts []RiotAccount) ([]string, error) {
+	return GetActiveMatchBans(accounts)
+}
+
+func (riotAPI) GetOpponentRanks(game *spectatorResponse, playing RiotAccount) []string {
+	return GetOpponentRanks(game, playing)
+}
+
+func (riotAPI) GetStreamStats(accounts []RiotAccount, startTime int64, queue int) (StreamStatsCacheEntry, error) {
+	return GetStreamStats(accounts, startTime, queue)
+}
+
+func (riotAPI) GetTFTStreamStats(accounts []RiotAccount, startTime int64) (TFTStreamStats, error) {
+	return GetTFTStreamStats(accounts, startTime)
+}
+
+func (riotAPI) GetLastMatch(accounts []RiotAccount) (*Match, *MatchParticipant, error) {
+	return GetLastMatch(accounts)
+}
+
+func (riotAPI) GetRecentResults(a RiotAccount) ([]bool, error) {
+	return GetRecentResults(a)
+}
+
+func (riotAPI) GetMatchResult(matchID, puuid string, maxWait time.Duration) (MatchResult, bool, error) {
+	return GetMatchResult(matchID, puuid, maxWait)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Canned Riot responses; a method with nothing canned returns errFake
+type fakeRiotClient struct {
+	ranks map[string][]LeagueEntry // by PUUID
+	bans  []string
+	stats StreamStatsCacheEntry
+
+	statsErr   error
+	statsCalls []fakeStatsCall
+}
+
+type fakeStatsCall struct {
+	start int64
+	queue int
+}
+
+var errFake = errors.New("not canned")
+
+func (f *fakeRiotClient) GetOrCachePlayer(gameName, tagLine string, route riotRoute) (PlayerCacheEntry, error) {
+	return PlayerCacheEntry{}, errFake
+}
+
+func (f *fakeRiotClient) RefreshPlayer(a RiotAccount, maxWait time.Duration) (PlayerCacheEntry, error) {
+	return PlayerCacheEntry{}, errFake
+}
+
+func (f *fakeRiotClient) GetCurrentRank(a RiotAccount) ([]LeagueEntry, error) {
+	ranks, ok := f.ranks[a.PUUID]
+	if !ok {
+		return nil, errFake
+	}
+	return ranks, nil
+}
+
+func (f *fakeRiotClient) GetTFTRank(a RiotAccount) ([]LeagueEntry, error) {
+	return nil, errFake
+}
+
+func (f *fakeRiotClient) GetActiveGameOf(accounts []RiotAccount, maxWait time.Duration) (*spectatorResponse, RiotAccount, error) {
+	return nil, RiotAccount{}, errFake
+}
+
+func (f *fakeRiotClient) GetLiveGame(accounts []RiotAccount) (*spectatorResponse, string, error) {
+	return nil, "", errFake
+}
+
+func (f *fakeRiotClient) GetActiveMatchBans(accounts []RiotAccount) ([]string, error) {
+	if f.bans == nil {
+		return nil, errFake
+	}
+	return f.bans, nil
+}
+
+func (f *fakeRiotClient) GetOpponentRanks(game *spectatorResponse, playing RiotAccount) []string {
+	return nil
+}
+
+func (f *fakeRiotClient) GetStreamStats(accounts []RiotAccount, startTime int64, queue int) (StreamStatsCacheEntry, error) {
+	f.statsCalls = append(f.statsCalls, fakeStatsCall{startTime, queue})
+	return f.stats, f.statsErr
+}
+
+func (f *fakeRiotClient) GetTFTStreamStats(accounts []RiotAccount, startTime int64) (TFTStreamStats, error) {
+	return TFTStreamStats{}, errFake
+}
+
+func (f *fakeRiotClient) GetLastMatch(accounts []RiotAccount) (*Match, *MatchParticipant, error) {
+	return nil, nil, errFake
+}
+
+func (f *fakeRiotClient) GetRecentResults(a RiotAccount) ([]bool, error) {
+	return nil, errFake
+}
+
+func (f *fakeRiotClient) GetMatchResult(matchID, puuid string, maxWait time.Duration) (MatchResult, bool, error) {
+	return MatchResult{}, false, errFake
+}
+
+// A stream that went live at start, or one Helix failed for with err
+type fakeTwitchClient struct {
+	start int64
+	err   error
+}
+
+func (f fakeTwitchClient) GetTwitchStreamInfo(channel string) (string, string, error) {
+	return "", "", errFake
+}
+
+func (f fakeTwitchClient) GetTwitchStreamStart(channel string) (int64, error) {
+	return f.start, f.err
+}
+
+var testAccounts = []RiotAccount{
+	{GameName: "Main", TagLine: "EUW", PUUID: "main-puuid"},
+	{GameName: "Smurf", TagLine: "EUW", PUUID: "smurf-puuid"},
+}
+
+// Run an api endpoint the way chat would and return what it replied
+func runEndpoint(riot RiotClient, twitch TwitchClient, accounts []RiotAccount, endpoint string, args ...string) []string {
+	d := NewDispatcher(nil, riot, twitch, accounts, &BotConfig{Prefix: "!"})
+	var replies []string
+	d.runAPI(&CommandContext{
+		Channel: "streamer",
+		Command: "cmd",
+		Args:    args,
+		Config:  CommandConfig{Type: "api", Endpoint: endpoint},
+		reply:   func(text string) { replies = append(replies, text) },
+	})
+	return replies
+}
+
+func TestRankInfo(t *testing.T) {
+	riot := &fakeRiotClient{ranks: map[string][]LeagueEntry{
+		"main-puuid": {
+			{QueueType: soloQueue, Tier: "GOLD", Rank: "II", LeaguePoints: 40},
+			{QueueType: flexQueue, Tier: "SILVER", Rank: "I", LeaguePoints: 75},
+		},
+		"smurf-puuid": {{QueueType: flexQueue, Tier: "PLATINUM", Rank: "IV", LeaguePoints: 12}},
+		"new-puuid":   {},
+	}}
+	tests := []struct {
+		name     string
+		accounts []RiotAccount
+		args     []string
+		want     string
+	}{
+		{"solo by default", testAccounts[:1], nil, "Current Rank: GOLD II 40"},
+		{"flex", testAccounts[:1], []string{"flex"}, "Current Rank (Flex): SILVER I 75"},
+		{"second account", testAccounts, []string{"2"}, "Smurf#EUW (Flex): PLATINUM IV 12"},
+		{"account out of range", testAccounts, []string{"3"}, "Usage: !rank [flex] [account 1-2]"},
+		{"unranked in flex", []RiotAccount{{GameName: "New", TagLine: "EUW", PUUID: "new-puuid"}}, []string{"flex"}, "Current Rank: Unranked in flex this season"},
+		{"lookup failed", []RiotAccount{{GameName: "Gone", TagLine: "EUW", PUUID: "gone-puuid"}}, nil, "Error fetching rank."},
+	}
+	for _, tt := range tests {
+		got := runEndpoint(riot, fakeTwitchClient{}, tt.accounts, "riot_rank_info", tt.args...)
+		if !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: replied %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCurrentBansInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		bans []string
+		want string
+	}{
+		{"in game", []string{"Yasuo", "Zed", "Master Yi"}, "Banned Champions: Yasuo, Zed, Master Yi"},
+		{"no bans", []string{}, "Banned Champions: "},
+		{"not in game", nil, "Not in an Active Match"},
+	}
+	for _, tt := range tests {
+		got := runEndpoint(&fakeRiotClient{bans: tt.bans}, fakeTwitchClient{}, testAccounts, "current_bans_info")
+		if !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: replied %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStreamStatsInfo(t *testing.T) {
+	const start = 1700000000
+	tests := []struct {
+		name      string
+		twitch    fakeTwitchClient
+		stats     StreamStatsCacheEntry
+		statsErr  error
+		args      []string
+		want      string
+		wantQueue int // queue GetStreamStats was asked for, -1 if it shouldn't be
+	}{
+		{
+			name:      "wins and losses",
+			twitch:    fakeTwitchClient{start: start},
+			stats:     StreamStatsCacheEntry{Wins: 3, Losses: 1, Winrate: 75},
+			want:      "Ranked Solo/Duo | Wins: 3 | Loss: 1 | Winrate: 75.00%",
+			wantQueue: soloQueueID,
+		},
+		{
+			name:      "remakes",
+			twitch:    fakeTwitchClient{start: start},
+			stats:     StreamStatsCacheEntry{Wins: 1, Losses: 1, Winrate: 50, Remakes: 1},
+			want:      "Ranked Solo/Duo | Wins: 1 | Loss: 1 | Winrate: 50.00%, 1 remake",
+			wantQueue: soloQueueID,
+		},
+		{
+			name:   "lp change",
+			twitch: fakeTwitchClient{start: start},
+			stats: StreamStatsCacheEntry{
+				Wins: 2, Winrate: 100,
+				RankStart: map[string]LeagueEntry{soloQueue: {Tier: "GOLD", Rank: "II", LeaguePoints: 40}},
+				RankEnd:   map[string]LeagueEntry{soloQueue: {Tier: "GOLD", Rank: "I", LeaguePoints: 12}},
+			},
+			want:      "Ranked Solo/Duo | Wins: 2 | Loss: 0 | Winrate: 100.00% | Solo: Gold II 40 LP → Gold I 12 LP, +72 LP",
+			wantQueue: soloQueueID,
+		},
+		{
+			name:   "no lp outside ranked",
+			twitch: fakeTwitchClient{start: start},
+			stats: StreamStatsCacheEntry{
+				Wins: 1, Winrate: 100,
+				RankStart: map[string]LeagueEntry{soloQueue: {Tier: "GOLD", Rank: "II", LeaguePoints: 40}},
+				RankEnd:   map[string]LeagueEntry{soloQueue: {Tier: "GOLD", Rank: "I", LeaguePoints: 12}},
+			},
+			args:      []string{"aram"},
+			want:      "ARAM | Wins: 1 | Loss: 0 | Winrate: 100.00%",
+			wantQueue: 450,
+		},
+		{
+			name:      "unknown queue",
+			twitch:    fakeTwitchClient{start: start},
+			args:      []string{"urf2"},
+			want:      `Unknown queue "urf2", try solo, flex, aram, normal, arena or all.`,
+			wantQueue: -1,
+		},
+		{
+			name:      "helix down",
+			twitch:    fakeTwitchClient{err: errFake},
+			want:      "Error fetching stream info.",
+			wantQueue: -1,
+		},
+		{
+			name:      "riot down",
+			twitch:    fakeTwitchClient{start: start},
+			statsErr:  errFake,
+			want:      "Error Fetching stream stats.",
+			wantQueue: soloQueueID,
+		},
+	}
+	for _, tt := range tests {
+		riot := &fakeRiotClient{stats: tt.stats, statsErr: tt.statsErr}
+		got := runEndpoint(riot, tt.twitch, testAccounts, "stream_stats_info", tt.args...)
+		if !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("%s: replied %q, want %q", tt.name, got, tt.want)
+		}
+		var want []fakeStatsCall
+		if tt.wantQueue >= 0 {
+			want = []fakeStatsCall{{start, tt.wantQueue}}
+		}
+		if !slices.Equal(riot.statsCalls, want) {
+			t.Errorf("%s: GetStreamStats calls %v, want %v", tt.name, riot.statsCalls, want)
+		}
+	}
+}
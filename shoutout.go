@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// ---------- !so ----------
+func init() {
+	registerBuiltin("so", "shoutout", 5, "moderator", func(d *Dispatcher, c *CommandContext) {
+		if len(c.Args) == 0 {
+			c.Reply(fmt.Sprintf("Usage: %sso <username>", d.Config().Prefix))
+			return
+		}
+		// mods usually type "!so @name"
+		login := strings.TrimPrefix(c.Args[0], "@")
+
+		user, err := GetTwitchUser(login)
+		if err != nil {
+			log.Printf("Shoutout lookup for %s: %v", login, err)
+			c.Reply("Couldn't look that channel up right now.")
+			return
+		}
+		if user == nil {
+			c.Reply(fmt.Sprintf("I couldn't find a Twitch user named %s.", login))
+			return
+		}
+
+		game, err := GetChannelGame(user.ID)
+		if err != nil {
+			log.Printf("Shoutout channel info for %s: %v", user.Login, err)
+		}
+		text := fmt.Sprintf("Go follow %s at twitch.tv/%s", user.DisplayName, user.Login)
+		if game != "" {
+			text += fmt.Sprintf(" — they were last playing %s!", game)
+		} else {
+			text += "!"
+		}
+		d.bot.Say(c.Channel, text)
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	fileVarTTL     = 30 * time.Second
+	maxFileVarSize = 400 // bytes, leaving room in a 500 byte chat message
+)
+
+var (
+	fileVarCache   = map[string]fileVarEntry{}
+	fileVarCacheMu sync.Mutex
+)
+
+type fileVarEntry struct {
+	Text      string
+	FetchedAt time.Time
+}
+
+// ---------- Templating ----------
+
+// Replace {name} placeholders with vars[name]. Unknown placeholders are left
+// as written so a typo in a response doesn't silently eat text.
+func renderTemplate(tmpl string, vars map[string]string) string {
+	return renderLazy(tmpl, vars, nil)
+}
+
+// Like renderTemplate, but placeholders missing from vars are looked up in
+// lazy, whose functions only run if the template uses them, once each
+func renderLazy(tmpl string, vars map[string]string, lazy map[string]func() string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+
+	var b strings.Builder
+	rest := tmpl
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end += open
+
+		b.WriteString(rest[:open])
+		name := rest[open+1 : end]
+		if value, ok := vars[name]; ok {
+			b.WriteString(value)
+		} else if fn, ok := lazy[name]; ok {
+			value := fn()
+			if vars == nil {
+				vars = map[string]string{}
+			}
+			vars[name] = value
+			b.WriteString(value)
+		} else if file, ok := strings.CutPrefix(name, "file:"); ok {
+			b.WriteString(fileVar(file))
+		} else {
+			b.WriteString(rest[open : end+1])
+		}
+		rest = rest[end+1:]
+	}
+	return b.String()
+}
+
+// ---------- Stream variables ----------
+
+// {uptime}, {title} and {game} for channel, fetched from Helix only when a
+// response references them
+func streamVars(channel string) map[string]func() string {
+	info := func(game bool) string {
+		title, g, err := CachedStreamInfo(channel)
+		if err != nil {
+			log.Printf("Stream info for template: %v", err)
+			return "unknown"
+		}
+		if game {
+			if g == "" {
+				return "nothing"
+			}
+			return g
+		}
+		return title
+	}
+	return map[string]func() string{
+		"uptime": func() string {
+			start, err := CachedStreamStart(channel)
+			if err != nil {
+				return "unknown"
+			}
+			if start == 0 {
+				return "offline"
+			}
+			return formatDuration(time.Since(time.Unix(start, 0)))
+		},
+		"title": func() string { return info(false) },
+		"game":  func() string { return info(true) },
+	}
+}
+
+// ---------- File variables ----------
+
+// Contents of a .txt file for {file:name.txt}, trimmed, capped and cached
+// briefly so editing the file updates the response. Only plain .txt names
+// are allowed, read from RESPONSE_FILES_DIR (default the working
+// directory), so a response can't pull in .env or other bot files.
+func fileVar(name string) string {
+	if name == "" || filepath.Base(name) != name || filepath.Ext(name) != ".txt" {
+		log.Printf("Warning: {file:%s} must name a .txt file in the response files directory", name)
+		return ""
+	}
+
+	fileVarCacheMu.Lock()
+	defer fileVarCacheMu.Unlock()
+	if e, ok := fileVarCache[name]; ok && time.Since(e.FetchedAt) < fileVarTTL {
+		return e.Text
+	}
+
+	dir := os.Getenv("RESPONSE_FILES_DIR")
+	if dir == "" {
+		dir = "."
+	}
+	text := ""
+	if data, err := readCapped(filepath.Join(dir, name), maxFileVarSize); err != nil {
+		log.Printf("Warning: {file:%s}: %v", name, err)
+	} else {
+		// one chat line, without a character the size cap cut in half
+		text = strings.ToValidUTF8(strings.Join(strings.Fields(string(data)), " "), "")
+	}
+	// cached even when missing so a broken reference warns once per TTL
+	fileVarCache[name] = fileVarEntry{Text: text, FetchedAt: time.Now()}
+	return text
+}
+
+// Up to limit bytes of the file at path
+func readCapped(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	vars := map[string]string{"user": "Alice", "channel": "streamer", "args": "to the moon", "1": "to", "2": "the"}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"no placeholders", "no placeholders"},
+		{"{user} in {channel} says {args}", "Alice in streamer says to the moon"},
+		{"{1}/{2}/{user}{user}", "to/the/AliceAlice"},
+		{"{nope} and {user}", "{nope} and Alice"},
+		{"{user} {UNKNOWN} {3}", "Alice {UNKNOWN} {3}"},
+		{"empty {} braces", "empty {} braces"},
+		{"unterminated {user", "unterminated {user"},
+		{"} stray {user} {", "} stray Alice {"},
+		{"{{user}}", "{{user}}"},
+		{"{file:../.env}", ""},
+	}
+	for _, tt := range tests {
+		if got := renderTemplate(tt.tmpl, vars); got != tt.want {
+			t.Errorf("renderTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestRenderLazy(t *testing.T) {
+	tests := []struct {
+		tmpl  string
+		want  string
+		calls int // times the lazy variable was computed
+	}{
+		{"{user} has {points} points, yes {points}", "Alice has 42 points, yes 42", 1},
+		{"{user} only", "Alice only", 0},
+		{"{points}{points}{points} and {missing}", "424242 and {missing}", 1},
+	}
+	for _, tt := range tests {
+		calls := 0
+		lazy := map[string]func() string{"points": func() string { calls++; return "42" }}
+		got := renderLazy(tt.tmpl, map[string]string{"user": "Alice"}, lazy)
+		if got != tt.want || calls != tt.calls {
+			t.Errorf("renderLazy(%q) = %q with %d lookups, want %q with %d", tt.tmpl, got, calls, tt.want, tt.calls)
+		}
+	}
+}
+
+func TestStreamVars(t *testing.T) {
+	// seed the Helix caches, so nothing here leaves the process
+	now := time.Now()
+	streamStartCacheMu.Lock()
+	streamStartCache["live"] = streamStartEntry{Start: now.Add(-90*time.Minute - 10*time.Second).Unix(), FetchedAt: now}
+	streamStartCache["offline"] = streamStartEntry{Start: 0, FetchedAt: now}
+	streamStartCacheMu.Unlock()
+	streamInfoCacheMu.Lock()
+	streamInfoCache["live"] = streamInfoEntry{Title: "ranked grind {user}", Game: "League of Legends", FetchedAt: now}
+	streamInfoCache["offline"] = streamInfoEntry{Title: "see you tomorrow", FetchedAt: now}
+	streamInfoCacheMu.Unlock()
+	t.Cleanup(func() {
+		for _, channel := range []string{"live", "offline"} {
+			forgetStreamInfo(channel)
+			streamStartCacheMu.Lock()
+			delete(streamStartCache, channel)
+			streamStartCacheMu.Unlock()
+		}
+	})
+
+	tests := []struct {
+		channel, tmpl, want string
+	}{
+		{"live", "{user}: {title} | {game} | live for {uptime}", "Alice: ranked grind {user} | League of Legends | live for 1h 30m"},
+		{"live", "{game} {game} {args}", "League of Legends League of Legends gg"},
+		{"live", "{uptime} {nope} {channel}", "1h 30m {nope} live"},
+		{"offline", "{title} ({game}) {uptime}", "see you tomorrow (nothing) offline"},
+	}
+	for _, tt := range tests {
+		vars := map[string]string{"user": "Alice", "channel": tt.channel, "args": "gg"}
+		if got := renderLazy(tt.tmpl, vars, streamVars(tt.channel)); got != tt.want {
+			t.Errorf("#%s %q = %q, want %q", tt.channel, tt.tmpl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const tftQueue = "RANKED_TFT"
+
+// Finished TFT matches by id, which never change
+var (
+	tftMatchCache   = map[string]*TFTMatch{}
+	tftMatchCacheMu sync.Mutex
+	tftStatsCache   = map[string]TFTStreamStats{}
+	tftStatsCacheMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// The parts of a tft-match-v1 match the bot uses
+type TFTMatch struct {
+	Info struct {
+		GameDatetime int64 `json:"game_datetime"` // unix millis
+		QueueID      int   `json:"queue_id"`
+		Participants []struct {
+			PUUID     string `json:"puuid"`
+			Placement int    `json:"placement"` // 1 to 8
+		} `json:"participants"`
+	} `json:"info"`
+}
+
+// TFT has no wins and losses, a top 4 finish is what counts
+type TFTStreamStats struct {
+	Games        int
+	Top4         int
+	AvgPlacement float64
+	CachedAt     int64
+}
+
+// ---------- Rank ----------
+
+// tft-league-v1 entries of an account, looked up by its summoner id
+func GetTFTRank(a RiotAccount) ([]LeagueEntry, error) {
+	if a.SummonerID == "" {
+		return nil, errors.New("no summoner id for " + a.String())
+	}
+	path := fmt.Sprintf("/tft/league/v1/entries/by-summoner/%s", url.PathEscape(a.SummonerID))
+	data, err := makeRoutedRequest(a.Route, "platform", path, riotChatWait)
+	if err != nil {
+		return nil, err
+	}
+	var entries []LeagueEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// !rank mapped to tft_rank_info: "[n]" picks the account
+func (d *Dispatcher) tftRankReply(c *CommandContext) {
+	accounts := d.Accounts()
+	account := accounts[0]
+	if len(c.Args) > 0 {
+		n, err := strconv.Atoi(c.Args[0])
+		if err != nil || n < 1 || n > len(accounts) {
+			c.Reply(fmt.Sprintf("Usage: %s%s [account 1-%d]", d.Config().Prefix, c.Command, len(accounts)))
+			return
+		}
+		account = accounts[n-1]
+	}
+
+	entries, err := d.riot.GetTFTRank(account)
+	if err != nil {
+		log.Printf("TFT rank error: %v", err)
+		c.Reply("Error fetching TFT rank.")
+		return
+	}
+	label := "TFT Rank"
+	if len(accounts) > 1 {
+		label = account.String() + " (TFT)"
+	}
+	for _, e := range entries {
+		if e.QueueType == tftQueue {
+			c.Reply(fmt.Sprintf("%s: %s %s %d", label, e.Tier, e.Rank, e.LeaguePoints))
+			return
+		}
+	}
+	c.Reply(fmt.Sprintf("%s: Unranked this set", label))
+}
+
+// ---------- Stream stats ----------
+
+func getTFTMatch(a RiotAccount, matchID string) (*TFTMatch, error) {
+	tftMatchCacheMu.Lock()
+	m, ok := tftMatchCache[matchID]
+	tftMatchCacheMu.Unlock()
+	if ok {
+		return m, nil
+	}
+	data, err := makeRoutedRequest(a.Route, "regional", "/tft/match/v1/matches/"+url.PathEscape(matchID), riotChatWait)
+	if err != nil {
+		return nil, err
+	}
+	m = &TFTMatch{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	tftMatchCacheMu.Lock()
+	tftMatchCache[matchID] = m
+	tftMatchCacheMu.Unlock()
+	return m, nil
+}
+
+// TFT games since startTime across every account, cached like
+// GetStreamStats. A lobby two of the accounts were in counts once.
+func GetTFTStreamStats(accounts []RiotAccount, startTime int64) (TFTStreamStats, error) {
+	key := fmt.Sprintf("%s_%d", strings.Join(accountPUUIDs(accounts), ","), startTime)
+	tftStatsCacheMu.Lock()
+	if val, ok := tftStatsCache[key]; ok && time.Since(time.Unix(val.CachedAt, 0)) < streamStatsTTL {
+		tftStatsCacheMu.Unlock()
+		return val, nil
+	}
+	tftStatsCacheMu.Unlock()
+
+	stats := TFTStreamStats{CachedAt: time.Now().Unix()}
+	seen := map[string]bool{}
+	placements := 0
+	for _, a := range accounts {
+		path := fmt.Sprintf("/tft/match/v1/matches/by-puuid/%s/ids?startTime=%d", url.PathEscape(a.PUUID), startTime)
+		data, err := makeRoutedRequest(a.Route, "regional", path, riotChatWait)
+		if err != nil {
+			return TFTStreamStats{}, err
+		}
+		var ids []string
+		_ = json.Unmarshal(data, &ids)
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			m, err := getTFTMatch(a, id)
+			if err != nil {
+				continue
+			}
+			for _, p := range m.Info.Participants {
+				if p.PUUID != a.PUUID {
+					continue
+				}
+				stats.Games++
+				placements += p.Placement
+				if p.Placement <= 4 {
+					stats.Top4++
+				}
+			}
+		}
+	}
+	if stats.Games > 0 {
+		stats.AvgPlacement = float64(placements) / float64(stats.Games)
+	}
+
+	tftStatsCacheMu.Lock()
+	tftStatsCache[key] = stats
+	tftStatsCacheMu.Unlock()
+	return stats, nil
+}
+
+// "Games: 5 | Top 4: 3 (60%) | Avg placement: 3.40"
+func describeTFTStats(s TFTStreamStats) string {
+	if s.Games == 0 {
+		return "No TFT games this stream yet."
+	}
+	return fmt.Sprintf("Games: %d | Top 4: %d (%.0f%%) | Avg placement: %.2f",
+		s.Games, s.Top4, float64(s.Top4)/float64(s.Games)*100, s.AvgPlacement)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	timerTick        = 10 * time.Second
+	minTimerInterval = 60 // seconds
+)
+
+// ---------- Types ----------
+
+// Recurring message, configured under "timers" in commands.json
+type TimerConfig struct {
+	Message      Responses `json:"message"`
+	Interval     int       `json:"interval"`                 // seconds between posts
+	MinChatLines int       `json:"min_chat_lines,omitempty"` // chat messages needed since the last post
+	Channel      string    `json:"channel,omitempty"`        // only post here instead of every joined channel
+}
+
+// Posts timers from the dispatcher's current config, so a hot reload picks
+// up new, changed and removed timers on the next tick
+type TimerRunner struct {
+	bot *Bot
+	d   *Dispatcher
+
+	mu    sync.Mutex
+	lines map[string]int            // chat lines seen per channel, ever
+	state map[string]*timerProgress // keyed by "<channel> <timer>"
+}
+
+type timerProgress struct {
+	LastPost     time.Time
+	LinesAtPost  int
+	NextResponse int
+}
+
+func NewTimerRunner(bot *Bot, d *Dispatcher) *TimerRunner {
+	return &TimerRunner{
+		bot:   bot,
+		d:     d,
+		lines: make(map[string]int),
+		state: make(map[string]*timerProgress),
+	}
+}
+
+// ---------- Running ----------
+
+// OnMessage handler counting chat activity for min_chat_lines
+func (t *TimerRunner) CountLine(msg Message) {
+	if ignoredUsers[strings.ToLower(msg.Nick())] {
+		return
+	}
+	t.mu.Lock()
+	t.lines[msg.Channel()]++
+	t.mu.Unlock()
+}
+
+func (t *TimerRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(timerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.tick()
+		}
+	}
+}
+
+func (t *TimerRunner) tick() {
+	config := t.d.Config()
+
+	names := make([]string, 0, len(config.Timers))
+	for name := range config.Timers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	live := map[string]bool{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		timer := config.Timers[name]
+		if len(timer.Message) == 0 {
+			continue
+		}
+		interval := max(timer.Interval, minTimerInterval)
+
+		for _, channel := range t.bot.Channels {
+			if timer.Channel != "" && strings.TrimPrefix(strings.ToLower(timer.Channel), "#") != channel {
+				continue
+			}
+			key := channel + " " + name
+			seen[key] = true
+
+			t.mu.Lock()
+			progress, ok := t.state[key]
+			if !ok {
+				// a new timer waits a full interval before its first post
+				progress = &timerProgress{LastPost: time.Now(), LinesAtPost: t.lines[channel]}
+				t.state[key] = progress
+			}
+			due := time.Since(progress.LastPost) >= time.Duration(interval)*time.Second &&
+				t.lines[channel]-progress.LinesAtPost >= timer.MinChatLines
+			t.mu.Unlock()
+			if !due || !t.bot.IsJoined(channel) {
+				continue
+			}
+
+			isLive, checked := live[channel]
+			if !checked {
+				isLive = streamIsLive(channel)
+				live[channel] = isLive
+			}
+			if !isLive {
+				continue
+			}
+
+			t.mu.Lock()
+			message := timer.Message[progress.NextResponse%len(timer.Message)]
+			progress.NextResponse++
+			progress.LastPost = time.Now()
+			progress.LinesAtPost = t.lines[channel]
+			t.mu.Unlock()
+
+			log.Printf("[#%s] Timer %s", channel, name)
+			t.bot.Say(channel, renderLazy(message, map[string]string{"channel": channel}, streamVars(channel)))
+		}
+	}
+
+	t.mu.Lock()
+	for key := range t.state {
+		if !seen[key] {
+			delete(t.state, key)
+		}
+	}
+	t.mu.Unlock()
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ---------- Config & Globals ----------
+const (
+	triviaQuestionsFile      = "questions.json" // bundled question bank
+	defaultTriviaPoints      = 50
+	defaultTriviaAnswerTime  = 30 // seconds
+	triviaPauseBetweenRounds = 10 * time.Second
+)
+
+// Running trivia session per channel
+var (
+	triviaSessions   = map[string]*triviaSession{}
+	triviaSessionsMu sync.Mutex
+)
+
+// ---------- Types ----------
+
+// Settings under "trivia" in commands.json. Its questions are asked along
+// with the bundled questions.json.
+type TriviaConfig struct {
+	Points     int              `json:"points,omitempty"`      // for a right answer, default 50
+	AnswerTime int              `json:"answer_time,omitempty"` // seconds per question, default 30
+	Questions  []TriviaQuestion `json:"questions,omitempty"`
+}
+
+type TriviaQuestion struct {
+	Question string   `json:"question"`
+	Answers  []string `json:"answers"` // any of these counts; the first is announced
+}
+
+// Questions are asked in a shuffled order until the bank runs out, so none
+// repeat within a session
+type triviaSession struct {
+	queue   []TriviaQuestion
+	current *TriviaQuestion // nil between questions
+	points  int
+	answer  time.Duration
+	timer   *time.Timer
+}
+
+func validateTrivia(t *TriviaConfig) []string {
+	var problems []string
+	if t.Points < 0 || t.AnswerTime < 0 {
+		problems = append(problems, fmt.Sprintf("%q: points and answer_time can't be negative", triviaSection))
+	}
+	for i, q := range t.Questions {
+		if strings.TrimSpace(q.Question) == "" || len(q.Answers) == 0 {
+			problems = append(problems, fmt.Sprintf("%q: question %d needs a \"question\" and at least one answer", triviaSection, i+1))
+			continue
+		}
+		for _, a := range q.Answers {
+			if triviaKey(a) == "" {
+				problems = append(problems, fmt.Sprintf("%q: question %d has an answer with no letters or digits", triviaSection, i+1))
+			}
+		}
+	}
+	return problems
+}
+
+// ---------- Questions ----------
+
+// The bundled questions plus any from commands.json
+func triviaQuestions(cfg TriviaConfig) []TriviaQuestion {
+	var questions []TriviaQuestion
+	data, err := os.ReadFile(triviaQuestionsFile)
+	if err == nil {
+		err = json.Unmarshal(data, &questions)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Error loading %s: %v", triviaQuestionsFile, err)
+	}
+	return append(questions, cfg.Questions...)
+}
+
+// Answers compare by letters and digits only, ignoring case, spaces and
+// punctuation, so "vel koz" matches "Vel'Koz"
+func triviaKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, cleanText(s))
+}
+
+func (q *TriviaQuestion) matches(msg string) bool {
+	key := triviaKey(msg)
+	for _, a := range q.Answers {
+		if key != "" && key == triviaKey(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// ---------- Running ----------
+
+// Ask the session's next question, or end it when none are left. Caller
+// holds triviaSessionsMu.
+func (d *Dispatcher) askTriviaLocked(channel string, s *triviaSession) {
+	if len(s.queue) == 0 {
+		delete(triviaSessions, channel)
+		d.bot.Say(channel, "That's every trivia question, thanks for playing!")
+		return
+	}
+	q := &s.queue[0]
+	s.queue = s.queue[1:]
+	s.current = q
+	s.timer = time.AfterFunc(s.answer, func() { d.triviaTimeout(channel, s, q) })
+	d.bot.Say(channel, fmt.Sprintf("Trivia: %s (%s to answer)", q.Question, formatDuration(s.answer)))
+}
+
+func (d *Dispatcher) triviaTimeout(channel string, s *triviaSession, q *TriviaQuestion) {
+	triviaSessionsMu.Lock()
+	defer triviaSessionsMu.Unlock()
+	if triviaSessions[channel] != s || s.current != q {
+		return // answered or stopped in the meantime
+	}
+	s.current = nil
+	d.bot.Say(channel, fmt.Sprintf("Time's up! The answer was %s.", q.Answers[0]))
+	d.nextTriviaLocked(channel, s)
+}
+
+// Caller holds triviaSessionsMu
+func (d *Dispatcher) nextTriviaLocked(channel string, s *triviaSession) {
+	s.timer = time.AfterFunc(triviaPauseBetweenRounds, func() {
+		triviaSessionsMu.Lock()
+		defer triviaSessionsMu.Unlock()
+		if triviaSessions[channel] == s && s.current == nil {
+			d.askTriviaLocked(channel, s)
+		}
+	})
+}
+
+// Called by the dispatcher for every chat message. Returns true when the
+// message answered the current question, so it isn't treated as a command.
+func (d *Dispatcher) answerTrivia(channel string, u ChatUser, msg string) bool {
+	triviaSessionsMu.Lock()
+	defer triviaSessionsMu.Unlock()
+	s, ok := triviaSessions[channel]
+	if !ok || s.current == nil || !s.current.matches(msg) {
+		return false
+	}
+	q := s.current
+	s.current = nil
+	s.timer.Stop()
+	balance := points.Add(u, s.points)
+	log.Printf("[#%s] %s answered trivia %q", channel, u.Login, q.Question)
+	d.bot.Say(channel, fmt.Sprintf("%s got it, the answer was %s! +%s (%d total)", u.Name(), q.Answers[0], plural(s.points, "point", "points"), balance))
+	d.nextTriviaLocked(channel, s)
+	return true
+}
+
+// ---------- !trivia ----------
+func init() {
+	registerBuiltin("trivia", "trivia", 0, "moderator", func(d *Dispatcher, c *CommandContext) {
+		usage := fmt.Sprintf("Usage: %strivia start | %strivia stop", d.Config().Prefix, d.Config().Prefix)
+		if len(c.Args) == 0 {
+			c.Reply(usage)
+			return
+		}
+		switch strings.ToLower(c.Args[0]) {
+		case "start":
+			cfg := d.Config().Trivia
+			questions := triviaQuestions(cfg)
+			if len(questions) == 0 {
+				c.Reply(fmt.Sprintf("There are no trivia questions, add some to %s or the %q section of commands.json.", triviaQuestionsFile, triviaSection))
+				return
+			}
+			rand.Shuffle(len(questions), func(i, j int) { questions[i], questions[j] = questions[j], questions[i] })
+
+			triviaSessionsMu.Lock()
+			defer triviaSessionsMu.Unlock()
+			if _, ok := triviaSessions[c.Channel]; ok {
+				c.Reply("Trivia is already running.")
+				return
+			}
+			s := &triviaSession{
+				queue:  questions,
+				points: cmp.Or(cfg.Points, defaultTriviaPoints),
+				answer: time.Duration(cmp.Or(cfg.AnswerTime, defaultTriviaAnswerTime)) * time.Second,
+			}
+			triviaSessions[c.Channel] = s
+			log.Printf("[#%s] Trivia started by %s with %d questions", c.Channel, c.Sender.Login, len(questions))
+			d.askTriviaLocked(c.Channel, s)
+
+		case "stop":
+			triviaSessionsMu.Lock()
+			s, ok := triviaSessions[c.Channel]
+			if ok {
+				s.timer.Stop()
+				delete(triviaSessions, c.Channel)
+			}
+			triviaSessionsMu.Unlock()
+			if !ok {
+				c.Reply("Trivia isn't running.")
+				return
+			}
+			d.bot.Say(c.Channel, "Trivia stopped, thanks for playing!")
+
+		default:
+			c.Reply(usage)
+		}
+	})
+}
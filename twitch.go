@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -25,6 +32,65 @@ type AppTokenResponse struct {
 
 var TwitchAppToken string
 
+const (
+	streamStartTTL    = time.Minute
+	streamStartErrTTL = 15 * time.Second // how long a failed lookup stands before Helix is asked again
+	helixTimeout      = 10 * time.Second
+	streamInfoTTL     = 10 * time.Second
+	liveStatusTTL     = time.Minute
+	twitchUserTTL     = 10 * time.Minute
+)
+
+var (
+	streamStartCache   = map[string]streamStartEntry{}
+	streamStartCacheMu sync.Mutex
+	streamInfoCache    = map[string]streamInfoEntry{}
+	streamInfoCacheMu  sync.Mutex
+	twitchUserCache    = map[string]twitchUserEntry{}
+	twitchUserCacheMu  sync.Mutex
+	liveStatusCache    = map[string]liveStatusEntry{}
+	liveStatusCacheMu  sync.Mutex
+)
+
+type streamStartEntry struct {
+	Start     int64
+	Err       error // Helix couldn't say
+	FetchedAt time.Time
+}
+
+func (e streamStartEntry) fresh() bool {
+	ttl := streamStartTTL
+	if e.Err != nil {
+		ttl = streamStartErrTTL
+	}
+	return time.Since(e.FetchedAt) < ttl
+}
+
+// For every request to Twitch: a hung Helix must not hang its callers
+var helixClient = &http.Client{Timeout: helixTimeout}
+
+type TwitchUser struct {
+	ID          string `json:"id"`
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name"`
+}
+
+type twitchUserEntry struct {
+	User      *TwitchUser // nil when no such user exists
+	FetchedAt time.Time
+}
+
+type liveStatusEntry struct {
+	Live      bool
+	FetchedAt time.Time
+}
+
+type streamInfoEntry struct {
+	Title     string
+	Game      string
+	FetchedAt time.Time
+}
+
 // Refresh Twitch App Token
 func RefreshAppToken() {
 	clientID := os.Getenv("TWITCH_CLIENT_ID")
@@ -38,7 +104,7 @@ func RefreshAppToken() {
 		clientID, clientSecret,
 	)
 
-	res, err := http.Post(url, "application/json", nil)
+	res, err := helixClient.Post(url, "application/json", nil)
 	if err != nil {
 		log.Println("Error refreshing Twitch App Token:", err)
 		return
@@ -55,13 +121,19 @@ func RefreshAppToken() {
 	log.Println("Twitch App Token refreshed successfully!")
 }
 
-// Start automatic token refresh
-func StartAppTokenRefresher() {
+// Start automatic token refresh, stopping when ctx is cancelled
+func StartAppTokenRefresher(ctx context.Context) {
 	RefreshAppToken() // initial refresh
 	ticker := time.NewTicker(50 * time.Minute)
 	go func() {
-		for range ticker.C {
-			RefreshAppToken()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				RefreshAppToken()
+			}
 		}
 	}()
 }
@@ -78,17 +150,22 @@ func GetTwitchStreamInfo(channel string) (string, string, error) {
 	req.Header.Set("Client-Id", clientID)
 	req.Header.Set("Authorization", "Bearer "+TwitchAppToken)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := helixClient.Do(req)
 	if err != nil {
 		return "", "", err
 	}
 	defer res.Body.Close()
+	// an expired token or an outage would otherwise decode as no stream
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("helix streams: status %d", res.StatusCode)
+	}
 
 	var stream StreamResponse
 	if err := json.NewDecoder(res.Body).Decode(&stream); err != nil {
 		return "", "", err
 	}
 
+	recordTwitchSuccess()
 	if len(stream.Data) == 0 {
 		return "Offline", "", nil
 	}
@@ -96,6 +173,9 @@ func GetTwitchStreamInfo(channel string) (string, string, error) {
 	return stream.Data[0].Title, stream.Data[0].GameName, nil
 }
 
+var errStreamOffline = errors.New("stream not live")
+
+// When channel's stream started, errStreamOffline when it isn't live
 func GetTwitchStreamStart(channel string) (int64, error) {
 	clientID := os.Getenv("TWITCH_CLIENT_ID")
 	if clientID == "" || TwitchAppToken == "" {
@@ -106,21 +186,247 @@ func GetTwitchStreamStart(channel string) (int64, error) {
 	req.Header.Set("Client-ID", clientID)
 	req.Header.Set("Authorization", "Bearer "+TwitchAppToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := helixClient.Do(req)
 	if err != nil {
 		return 0, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("helix streams: status %d", resp.StatusCode)
+	}
 	var res struct {
 		Data []struct {
 			StartedAt string `json:"started_at"`
 		} `json:"data"`
 	}
-	_ = json.NewDecoder(resp.Body).Decode(&res)
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return 0, err
+	}
+	recordTwitchSuccess()
 	if len(res.Data) == 0 {
-		return 0, fmt.Errorf("stream not live")
+		return 0, errStreamOffline
 	}
 
-	t, _ := time.Parse(time.RFC3339, res.Data[0].StartedAt)
+	t, err := time.Parse(time.RFC3339, res.Data[0].StartedAt)
+	if err != nil {
+		return 0, fmt.Errorf("helix streams: started_at: %w", err)
+	}
 	return t.Unix(), nil
 }
+
+// Stream start for channel, cached for a minute so per-message callers don't
+// hit Helix every time. Returns 0 when the stream is offline, and an error
+// when Helix couldn't say: callers keep whatever per-stream state they have
+// rather than take it for a new stream. Errors are cached for
+// streamStartErrTTL, so an outage costs a request every few seconds rather
+// than one per caller.
+func CachedStreamStart(channel string) (int64, error) {
+	streamStartCacheMu.Lock()
+	entry, ok := streamStartCache[channel]
+	streamStartCacheMu.Unlock()
+	if ok && entry.fresh() {
+		return entry.Start, entry.Err
+	}
+
+	start, err := GetTwitchStreamStart(channel)
+	if errors.Is(err, errStreamOffline) {
+		start, err = 0, nil
+	}
+
+	streamStartCacheMu.Lock()
+	streamStartCache[channel] = streamStartEntry{Start: start, Err: err, FetchedAt: time.Now()}
+	streamStartCacheMu.Unlock()
+	return start, err
+}
+
+var errStreamStartUnknown = errors.New("stream start not looked up yet")
+
+// The stream start CachedStreamStart last got, however old, without asking
+// Helix. For chat hooks on the IRC read loop, which RunStreamStartRefresher
+// keeps supplied.
+func knownStreamStart(channel string) (int64, error) {
+	streamStartCacheMu.Lock()
+	entry, ok := streamStartCache[channel]
+	streamStartCacheMu.Unlock()
+	if !ok {
+		return 0, errStreamStartUnknown
+	}
+	return entry.Start, entry.Err
+}
+
+// Look up each channel's stream start whenever its cached one goes stale,
+// stopping when ctx is cancelled
+func RunStreamStartRefresher(ctx context.Context, channels []string) {
+	ticker := time.NewTicker(streamStartErrTTL)
+	defer ticker.Stop()
+	for {
+		for _, channel := range channels {
+			CachedStreamStart(channel)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stream title and game, cached briefly so a response using both costs one
+// Helix call. Errors are not cached.
+func CachedStreamInfo(channel string) (string, string, error) {
+	streamInfoCacheMu.Lock()
+	entry, ok := streamInfoCache[channel]
+	streamInfoCacheMu.Unlock()
+	if ok && time.Since(entry.FetchedAt) < streamInfoTTL {
+		return entry.Title, entry.Game, nil
+	}
+
+	title, game, err := GetTwitchStreamInfo(channel)
+	if err != nil {
+		return "", "", err
+	}
+
+	streamInfoCacheMu.Lock()
+	streamInfoCache[channel] = streamInfoEntry{Title: title, Game: game, FetchedAt: time.Now()}
+	streamInfoCacheMu.Unlock()
+	return title, game, nil
+}
+
+// Whether channel is live, checked at most once a minute since online-only
+// commands and timers ask on every use. If Helix can't be reached or
+// answers with an error the stream counts as live, so nothing goes quiet
+// for a whole stream.
+func streamIsLive(channel string) bool {
+	liveStatusCacheMu.Lock()
+	entry, ok := liveStatusCache[channel]
+	liveStatusCacheMu.Unlock()
+	if ok && time.Since(entry.FetchedAt) < liveStatusTTL {
+		return entry.Live
+	}
+
+	title, _, err := GetTwitchStreamInfo(channel)
+	live := err != nil || title != "Offline"
+
+	liveStatusCacheMu.Lock()
+	liveStatusCache[channel] = liveStatusEntry{Live: live, FetchedAt: time.Now()}
+	liveStatusCacheMu.Unlock()
+	return live
+}
+
+// GET a Helix endpoint with the app token and decode the JSON response
+func helixGet(path string, out any) error {
+	if TwitchAppToken == "" {
+		return fmt.Errorf("Twitch App Token not set")
+	}
+	return helixRequest("GET", path, TwitchAppToken, nil, out)
+}
+
+// Call a Helix endpoint with token, sending body as JSON when non-nil and
+// decoding the response into out when non-nil
+func helixRequest(method, path, token string, body, out any) error {
+	clientID := os.Getenv("TWITCH_CLIENT_ID")
+	if clientID == "" {
+		return fmt.Errorf("TWITCH_CLIENT_ID not set")
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, _ := http.NewRequest(method, "https://api.twitch.tv/helix/"+path, reqBody)
+	req.Header.Set("Client-Id", clientID)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := helixClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &helixError{Path: path, Status: res.Status, StatusCode: res.StatusCode}
+	}
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			return err
+		}
+	}
+	recordTwitchSuccess()
+	return nil
+}
+
+// Non-2xx response from Helix
+type helixError struct {
+	Path       string
+	Status     string
+	StatusCode int
+}
+
+func (e *helixError) Error() string {
+	return fmt.Sprintf("helix %s: %s", e.Path, e.Status)
+}
+
+// Look up a user by login, cached for a few minutes so repeated shoutouts
+// don't cost a call each. Returns nil without an error when no user has
+// that login.
+func GetTwitchUser(login string) (*TwitchUser, error) {
+	login = strings.ToLower(login)
+	twitchUserCacheMu.Lock()
+	entry, ok := twitchUserCache[login]
+	twitchUserCacheMu.Unlock()
+	if ok && time.Since(entry.FetchedAt) < twitchUserTTL {
+		return entry.User, nil
+	}
+
+	var res struct {
+		Data []TwitchUser `json:"data"`
+	}
+	if err := helixGet("users?login="+url.QueryEscape(login), &res); err != nil {
+		return nil, err
+	}
+	var user *TwitchUser
+	if len(res.Data) > 0 {
+		user = &res.Data[0]
+	}
+
+	twitchUserCacheMu.Lock()
+	twitchUserCache[login] = twitchUserEntry{User: user, FetchedAt: time.Now()}
+	twitchUserCacheMu.Unlock()
+	return user, nil
+}
+
+// Category the broadcaster last streamed, "" if they never have
+func GetChannelGame(broadcasterID string) (string, error) {
+	_, game, err := GetChannelInfo(broadcasterID)
+	return game, err
+}
+
+// Title and category set on the channel, whether or not it's live
+func GetChannelInfo(broadcasterID string) (string, string, error) {
+	var res struct {
+		Data []struct {
+			Title    string `json:"title"`
+			GameName string `json:"game_name"`
+		} `json:"data"`
+	}
+	if err := helixGet("channels?broadcaster_id="+url.QueryEscape(broadcasterID), &res); err != nil {
+		return "", "", err
+	}
+	if len(res.Data) == 0 {
+		return "", "", nil
+	}
+	return res.Data[0].Title, res.Data[0].GameName, nil
+}
+
+// Drop the cached title and game so the next lookup sees a change
+func forgetStreamInfo(channel string) {
+	streamInfoCacheMu.Lock()
+	delete(streamInfoCache, channel)
+	streamInfoCacheMu.Unlock()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Point helixClient at a server answering every request with status and
+// body, forgetting anything cached for channel, and return how many
+// requests it has had
+func fakeHelix(t *testing.T, channel string, status int, body string) *atomic.Int32 {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	target, _ := url.Parse(srv.URL)
+
+	t.Setenv("TWITCH_CLIENT_ID", "test-client")
+	oldToken, oldClient := TwitchAppToken, helixClient
+	TwitchAppToken = "test-token"
+	helixClient = &http.Client{Transport: rewriteTransport{target}, Timeout: time.Second}
+	forget := func() {
+		streamStartCacheMu.Lock()
+		delete(streamStartCache, channel)
+		streamStartCacheMu.Unlock()
+		liveStatusCacheMu.Lock()
+		delete(liveStatusCache, channel)
+		liveStatusCacheMu.Unlock()
+	}
+	forget()
+	t.Cleanup(func() {
+		srv.Close()
+		TwitchAppToken, helixClient = oldToken, oldClient
+		forget()
+	})
+	return &requests
+}
+
+func TestCachedStreamStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    int64
+		wantErr bool
+	}{
+		{"live", 200, `{"data": [{"started_at": "2026-10-14T18:00:00Z"}]}`, time.Date(2026, 10, 14, 18, 0, 0, 0, time.UTC).Unix(), false},
+		{"offline", 200, `{"data": []}`, 0, false},
+		{"expired token", 401, `{"message": "Invalid OAuth token"}`, 0, true},
+		{"outage", 503, "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeHelix(t, "streamer", tt.status, tt.body)
+			if _, err := knownStreamStart("streamer"); err != errStreamStartUnknown {
+				t.Errorf("knownStreamStart before any lookup: %v, want %v", err, errStreamStartUnknown)
+			}
+			// failures are cached as well, so chat can't turn an outage
+			// into a request per message
+			for range 5 {
+				start, err := CachedStreamStart("streamer")
+				if start != tt.want || (err != nil) != tt.wantErr {
+					t.Fatalf("CachedStreamStart = %d, %v; want %d, error %v", start, err, tt.want, tt.wantErr)
+				}
+			}
+			start, err := knownStreamStart("streamer")
+			if start != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("knownStreamStart = %d, %v; want %d, error %v", start, err, tt.want, tt.wantErr)
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("%d requests to Helix, want 1", n)
+			}
+		})
+	}
+}
+
+func TestClaimFirstChatNeverAsksHelix(t *testing.T) {
+	b := NewBot("bot", "", []string{"streamer"})
+	b.setConn(&ircConn{})
+	d := &Dispatcher{bot: b}
+	oldChats, oldCounts := firstChats, firstChatCounts
+	t.Cleanup(func() { firstChats, firstChatCounts = oldChats, oldCounts })
+
+	tests := []struct {
+		name    string
+		known   *streamStartEntry // cached before the message, nil for nothing
+		claimed bool
+	}{
+		{"start unknown", nil, false},
+		{"lookup failed", &streamStartEntry{Err: errors.New("helix streams: status 503")}, false},
+		{"offline", &streamStartEntry{Start: 0}, false},
+		{"live", &streamStartEntry{Start: 1760464800}, true},
+		{"live, long ago looked up", &streamStartEntry{Start: 1760464800, FetchedAt: time.Now().Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			firstChats = NewFirstChatStore(filepath.Join(dir, firstChatFile))
+			firstChatCounts = NewUserStore[int](filepath.Join(dir, firstChatCountsFile))
+			t.Cleanup(firstChatCounts.Flush)
+			requests := fakeHelix(t, "streamer", 200, `{"data": []}`)
+			if tt.known != nil {
+				streamStartCacheMu.Lock()
+				streamStartCache["streamer"] = *tt.known
+				streamStartCacheMu.Unlock()
+			}
+
+			d.claimFirstChat("streamer", ChatUser{Login: "alice", UserID: "1"})
+			announced := len(queuedChat()) > 0
+			_, claimed := firstChats.holders["streamer"]
+			if claimed != tt.claimed || announced != tt.claimed {
+				t.Errorf("claimed %v, announced %v; want %v", claimed, announced, tt.claimed)
+			}
+			if n := requests.Load(); n != 0 {
+				t.Errorf("%d requests to Helix from the read loop", n)
+			}
+		})
+	}
+}
+
+func TestStreamIsLive(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		live   bool
+	}{
+		{"live", 200, `{"data": [{"title": "ranked", "game_name": "League of Legends"}]}`, true},
+		{"offline", 200, `{"data": []}`, false},
+		// Helix failing mustn't silence online-only commands and timers
+		{"expired token", 401, `{"message": "Invalid OAuth token"}`, true},
+		{"outage", 500, "", true},
+		{"rate limited", 429, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := fakeHelix(t, "streamer", tt.status, tt.body)
+			for range 3 {
+				if live := streamIsLive("streamer"); live != tt.live {
+					t.Fatalf("streamIsLive = %v, want %v", live, tt.live)
+				}
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("%d requests to Helix, want 1 a minute", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+// What the dispatcher's commands need from Helix about a channel's stream.
+// helixAPI is the real thing; like RiotClient it can be swapped for canned
+// responses.
+type TwitchClient interface {
+	GetTwitchStreamInfo(channel string) (title, game string, err error)
+	GetTwitchStreamStart(channel string) (int64, error)
+}
+
+// Helix through twitch.go, with the app token it keeps fresh
+type helixAPI struct{}
+
+func (helixAPI) GetTwitchStreamInfo(channel string) (string, string, error) {
+	return GetTwitchStreamInfo(channel)
+}
+
+func (helixAPI) GetTwitchStreamStart(channel string) (int64, error) {
+	return GetTwitchStreamStart(channel)
+}
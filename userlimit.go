@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	defaultUserCommandLimit  = 4
+	defaultUserCommandWindow = 30 * time.Second
+)
+
+// Commands one viewer may use per window across all commands, on top of
+// each command's own cooldown. Set up in main once .env is loaded.
+var userLimits *userCommandLimiter
+
+type userCommandLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	users     map[string]*rateLimiter // keyed by ChatUser.Key
+	lastPrune time.Time
+}
+
+// USER_COMMAND_LIMIT commands per USER_COMMAND_WINDOW seconds (4 per 30 by
+// default); a limit of 0 turns it off
+func NewUserCommandLimiter() *userCommandLimiter {
+	l := &userCommandLimiter{
+		limit:  defaultUserCommandLimit,
+		window: defaultUserCommandWindow,
+		users:  make(map[string]*rateLimiter),
+	}
+	if v := os.Getenv("USER_COMMAND_LIMIT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			l.limit = n
+		} else {
+			log.Printf("Ignoring invalid USER_COMMAND_LIMIT %q", v)
+		}
+	}
+	if v := os.Getenv("USER_COMMAND_WINDOW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			l.window = time.Duration(n) * time.Second
+		} else {
+			log.Printf("Ignoring invalid USER_COMMAND_WINDOW %q", v)
+		}
+	}
+	return l
+}
+
+// Record a command from u, reporting false once they are over budget.
+// Mods and the broadcaster are never limited.
+func (l *userCommandLimiter) Allow(u ChatUser) bool {
+	if l.limit == 0 || hasPermission(u, "moderator") {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastPrune) > l.window {
+		l.pruneLocked()
+	}
+	limiter, ok := l.users[u.Key()]
+	if !ok {
+		limiter = newRateLimiter(l.window)
+		l.users[u.Key()] = limiter
+	}
+	return limiter.reserve(l.limit) == 0
+}
+
+// Forget users with no commands left in the window
+func (l *userCommandLimiter) pruneLocked() {
+	now := time.Now()
+	for key, limiter := range l.users {
+		limiter.mu.Lock()
+		idle := len(limiter.sent) == 0 || now.Sub(limiter.sent[len(limiter.sent)-1]) >= l.window
+		limiter.mu.Unlock()
+		if idle {
+			delete(l.users, key)
+		}
+	}
+	l.lastPrune = now
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Changes are written out this long after the first unsaved one, so a
+// store updated on every chat message isn't rewritten on every message
+const userStoreSaveDelay = 5 * time.Second
+
+// ---------- Types ----------
+
+// Per-user data together with the name it was last seen under, so stores
+// can be keyed by user-id and still display something readable
+type UserEntry[T any] struct {
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName,omitempty"`
+	Data        T      `json:"data"`
+}
+
+// JSON file of per-user data keyed by Twitch user-id. Users seen without a
+// user-id (no tags) are stored under "login:<name>" until their id is known.
+type UserStore[T any] struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*UserEntry[T]
+	dirty   bool        // changed since the last save
+	saving  *time.Timer // pending save, nil when there's none
+}
+
+const legacyKeyPrefix = "login:"
+
+// Stable key for per-user state: the user-id when tags are available
+func (u ChatUser) Key() string {
+	if u.UserID != "" {
+		return u.UserID
+	}
+	return legacyKeyPrefix + strings.ToLower(u.Login)
+}
+
+// ---------- Loading ----------
+
+// Open the store at path. Files written before user-ids were used are keyed
+// by login name; those entries are kept under "login:<name>" and moved to
+// the user's id the next time that user is seen.
+func NewUserStore[T any](path string) *UserStore[T] {
+	s := &UserStore[T]{path: path, entries: make(map[string]*UserEntry[T])}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+		return s
+	}
+	for key, v := range raw {
+		// a UserEntry always has "data"; anything else is a plain login ->
+		// value entry from before, which a struct T would otherwise decode
+		// from as an entry with empty data
+		var probe struct {
+			Data json.RawMessage `json:"data"`
+		}
+		if json.Unmarshal(v, &probe) == nil && probe.Data != nil {
+			e := &UserEntry[T]{}
+			if err := json.Unmarshal(v, e); err != nil {
+				log.Printf("Error parsing %s entry %s, leaving it out: %v", path, key, err)
+				continue
+			}
+			s.entries[key] = e
+			continue
+		}
+		e := &UserEntry[T]{Login: key}
+		if err := json.Unmarshal(v, &e.Data); err != nil {
+			log.Printf("Error parsing %s entry %s, leaving it out: %v", path, key, err)
+			continue
+		}
+		s.entries[key] = e
+	}
+
+	migrated := 0
+	for key, e := range s.entries {
+		if !isUserID(key) && !strings.HasPrefix(key, legacyKeyPrefix) {
+			if e.Login == "" {
+				e.Login = key
+			}
+			delete(s.entries, key)
+			s.entries[legacyKeyPrefix+strings.ToLower(key)] = e
+			migrated++
+		}
+	}
+	if migrated > 0 {
+		log.Printf("Migrating %d name-keyed entries in %s to user-ids as users are seen", migrated, path)
+	}
+	return s
+}
+
+func isUserID(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ---------- Access ----------
+
+// Data stored for u, if any. A legacy login-keyed entry is found but left
+// where it is until an update moves it.
+func (s *UserStore[T]) Get(u ChatUser) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[u.Key()]; ok {
+		return e.Data, true
+	}
+	if e, ok := s.entries[legacyKeyPrefix+strings.ToLower(u.Login)]; ok && u.UserID != "" {
+		return e.Data, true
+	}
+	var zero T
+	return zero, false
+}
+
+// Modify (creating if needed) u's data, saving the store shortly after
+func (s *UserStore[T]) Update(u ChatUser, update func(*T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(&s.entryFor(u).Data)
+	s.changedLocked()
+}
+
+// Remove u's entry, under their id or a legacy login key, reporting
+// whether there was one
+func (s *UserStore[T]) Delete(u ChatUser) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	for _, key := range []string{u.Key(), legacyKeyPrefix + strings.ToLower(u.Login)} {
+		if _, ok := s.entries[key]; ok {
+			delete(s.entries, key)
+			found = true
+		}
+	}
+	if found {
+		s.changedLocked()
+	}
+	return found
+}
+
+// Modify (creating if needed) each user's data
+func (s *UserStore[T]) UpdateEach(users []ChatUser, update func(*T)) {
+	if len(users) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range users {
+		update(&s.entryFor(u).Data)
+	}
+	s.changedLocked()
+}
+
+// Drop entries keep returns false for, returning how many were removed
+func (s *UserStore[T]) Prune(keep func(UserEntry[T]) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for k, e := range s.entries {
+		if !keep(*e) {
+			delete(s.entries, k)
+			removed++
+		}
+	}
+	if removed > 0 {
+		s.changedLocked()
+	}
+	return removed
+}
+
+// All entries by key; the map and entries are copies
+func (s *UserStore[T]) All() map[string]UserEntry[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := make(map[string]UserEntry[T], len(s.entries))
+	for k, e := range s.entries {
+		all[k] = *e
+	}
+	return all
+}
+
+// Find or create u's entry, adopting a legacy login-keyed entry once the
+// id is known and refreshing the stored names. Caller holds s.mu and saves
+// the change.
+func (s *UserStore[T]) entryFor(u ChatUser) *UserEntry[T] {
+	key := u.Key()
+	e, ok := s.entries[key]
+	if !ok && u.UserID != "" {
+		legacyKey := legacyKeyPrefix + strings.ToLower(u.Login)
+		if legacy, found := s.entries[legacyKey]; found {
+			delete(s.entries, legacyKey)
+			s.entries[key] = legacy
+			e, ok = legacy, true
+		}
+	}
+	if !ok {
+		e = &UserEntry[T]{}
+		s.entries[key] = e
+	}
+	if u.Login != "" {
+		e.Login = u.Login
+	}
+	if u.DisplayName != "" {
+		e.DisplayName = u.DisplayName
+	}
+	return e
+}
+
+// ---------- Saving ----------
+
+// Schedule a save, unless one already is. Caller holds s.mu.
+func (s *UserStore[T]) changedLocked() {
+	s.dirty = true
+	if s.saving == nil {
+		s.saving = time.AfterFunc(userStoreSaveDelay, s.Flush)
+	}
+}
+
+// Write any unsaved changes now, as on shutdown
+func (s *UserStore[T]) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saving != nil {
+		s.saving.Stop()
+		s.saving = nil
+	}
+	if !s.dirty {
+		return
+	}
+	b, _ := json.MarshalIndent(s.entries, "", "  ")
+	if err := writeFileAtomic(s.path, b); err != nil {
+		log.Printf("Error writing %s: %v", s.path, err)
+		return
+	}
+	s.dirty = false
+}
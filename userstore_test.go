@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserStoreLegacyFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		want   watchData // alice's, seen with her id after the upgrade
+		legacy bool      // so seen without an id too
+		count  int       // entries kept
+	}{
+		{"entries", `{"1": {"login": "alice", "data": {"minutes": 42, "lastSeen": 7}}}`, watchData{Minutes: 42, LastSeen: 7}, false, 1},
+		{"keyed by login", `{"alice": {"minutes": 42, "lastSeen": 7}}`, watchData{Minutes: 42, LastSeen: 7}, true, 1},
+		{"keyed by legacy key", `{"login:alice": {"login": "Alice", "data": {"minutes": 42}}}`, watchData{Minutes: 42}, true, 1},
+		{"mixed", `{"alice": {"minutes": 42}, "2": {"login": "bob", "data": {"minutes": 1}}}`, watchData{Minutes: 42}, true, 2},
+		{"bad entry left out", `{"alice": {"minutes": 42}, "bob": {"minutes": "lots"}}`, watchData{Minutes: 42}, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), watchTimeFile)
+			os.WriteFile(path, []byte(tt.file), 0644)
+			s := NewUserStore[watchData](path)
+			t.Cleanup(s.Flush)
+
+			alice := ChatUser{Login: "alice", UserID: "1"}
+			if got, ok := s.Get(alice); !ok || got != tt.want {
+				t.Errorf("Get = %+v, %v; want %+v", got, ok, tt.want)
+			}
+			if n := len(s.All()); n != tt.count {
+				t.Errorf("kept %d entries, want %d", n, tt.count)
+			}
+			if got, ok := s.Get(ChatUser{Login: "alice"}); tt.legacy && (!ok || got != tt.want) {
+				t.Errorf("Get without a user-id = %+v, %v; want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserStoreGetLeavesTheStoreAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), firstChatCountsFile)
+	os.WriteFile(path, []byte(`{"alice": 3}`), 0644)
+	s := NewUserStore[int](path)
+
+	alice := ChatUser{Login: "alice", UserID: "1"}
+	if n, _ := s.Get(alice); n != 3 {
+		t.Fatalf("Get = %d, want 3", n)
+	}
+	s.Flush()
+	if all := s.All(); len(all) != 1 || all["login:alice"].Data != 3 {
+		t.Errorf("after Get the entries are %v, want alice's left under her login", all)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `{"alice": 3}` {
+		t.Errorf("Get wrote %s", data)
+	}
+
+	// the first update moves her entry to her id
+	s.Update(alice, func(n *int) { *n++ })
+	s.Flush()
+	var saved map[string]UserEntry[int]
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &saved); err != nil || len(saved) != 1 || saved["1"].Data != 4 || saved["1"].Login != "alice" {
+		t.Errorf("after Update the file holds %s", data)
+	}
+}
+
+func TestUserStoreBatchesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), watchTimeFile)
+	s := NewUserStore[watchData](path)
+	for i := range 100 {
+		s.Update(ChatUser{Login: "alice", UserID: "1"}, func(d *watchData) { d.Minutes = i })
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("written before the save delay: %v", err)
+	}
+	s.Flush()
+	reopened := NewUserStore[watchData](path)
+	if got, _ := reopened.Get(ChatUser{UserID: "1"}); got.Minutes != 99 {
+		t.Errorf("saved %d minutes, want 99", got.Minutes)
+	}
+}
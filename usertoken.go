@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	userTokensFile = "user_tokens.json"
+
+	// everything features using user tokens need; --authorize requests all of them
+	userTokenScopes = "moderator:read:followers channel:manage:broadcast user:manage:whispers moderation:read moderator:manage:chat_messages moderator:manage:banned_users"
+
+	// refresh a little early so a token never expires mid-request
+	userTokenRefreshMargin = 5 * time.Minute
+)
+
+// User tokens authorized with --authorize, opened in main
+var userTokens *UserTokenStore
+
+// ---------- Types ----------
+
+// OAuth user token for one Twitch account, refreshed as it expires
+type UserToken struct {
+	UserID       string   `json:"userId"`
+	Login        string   `json:"login"`
+	AccessToken  string   `json:"accessToken"`
+	RefreshToken string   `json:"refreshToken"`
+	Scopes       []string `json:"scopes"`
+	ExpiresAt    int64    `json:"expiresAt"` // unix seconds
+}
+
+// JSON file of user tokens by login
+type UserTokenStore struct {
+	mu     sync.Mutex
+	path   string
+	tokens map[string]*UserToken
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string   `json:"access_token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	Scope        []string `json:"scope"`
+	Message      string   `json:"message"` // set on errors
+}
+
+func NewUserTokenStore(path string) *UserTokenStore {
+	s := &UserTokenStore{path: path, tokens: make(map[string]*UserToken)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s: %v", path, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.tokens); err != nil {
+		log.Printf("Error parsing %s: %v", path, err)
+	}
+	return s
+}
+
+// ---------- Access ----------
+
+// Token to act in channel with scope: the broadcaster's own, or for
+// moderator scopes any authorized account's, since the bot or a mod can
+// authorize those. The token is refreshed first if it's about to expire.
+func (s *UserTokenStore) For(channel, scope string) (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candidates := []string{channel}
+	if strings.HasPrefix(scope, "moderator:") {
+		logins := make([]string, 0, len(s.tokens))
+		for login := range s.tokens {
+			if login != channel {
+				logins = append(logins, login)
+			}
+		}
+		sort.Strings(logins)
+		candidates = append(candidates, logins...)
+	}
+	for _, login := range candidates {
+		if t, ok := s.tokens[login]; ok && slices.Contains(t.Scopes, scope) {
+			return s.freshLocked(t)
+		}
+	}
+	return nil, fmt.Errorf("no user token with %s for %s, run with --authorize", scope, channel)
+}
+
+// Token for login's own account with scope, e.g. the bot's for whispers
+func (s *UserTokenStore) ForAccount(login, scope string) (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.tokens[strings.ToLower(login)]; ok && slices.Contains(t.Scopes, scope) {
+		return s.freshLocked(t)
+	}
+	return nil, fmt.Errorf("no user token with %s for %s, run with --authorize as %s", scope, login, login)
+}
+
+// Copy of t, refreshed first if it's about to expire. Caller holds s.mu.
+func (s *UserTokenStore) freshLocked(t *UserToken) (*UserToken, error) {
+	if time.Until(time.Unix(t.ExpiresAt, 0)) < userTokenRefreshMargin {
+		if err := s.refreshLocked(t); err != nil {
+			return nil, err
+		}
+	}
+	copied := *t
+	return &copied, nil
+}
+
+// Store t, replacing any earlier token for the same account
+func (s *UserTokenStore) Put(t *UserToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[strings.ToLower(t.Login)] = t
+	s.saveLocked()
+}
+
+// Refresh t now, e.g. after Helix rejected it, returning the new token
+func (s *UserTokenStore) Refresh(t *UserToken) (*UserToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.tokens[strings.ToLower(t.Login)]
+	if !ok {
+		return nil, fmt.Errorf("no user token for %s", t.Login)
+	}
+	// another caller may already have refreshed it
+	if stored.AccessToken == t.AccessToken {
+		if err := s.refreshLocked(stored); err != nil {
+			return nil, err
+		}
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+// Caller holds s.mu
+func (s *UserTokenStore) refreshLocked(t *UserToken) error {
+	res, err := postOAuthToken(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {t.RefreshToken},
+		"client_id":     {os.Getenv("TWITCH_CLIENT_ID")},
+		"client_secret": {os.Getenv("TWITCH_CLIENT_SECRET")},
+	})
+	if err != nil {
+		return fmt.Errorf("refreshing %s's token (run with --authorize again): %w", t.Login, err)
+	}
+	t.AccessToken = res.AccessToken
+	t.RefreshToken = res.RefreshToken
+	t.ExpiresAt = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second).Unix()
+	if len(res.Scope) > 0 {
+		t.Scopes = res.Scope
+	}
+	log.Printf("Refreshed Twitch user token for %s", t.Login)
+	s.saveLocked()
+	return nil
+}
+
+// Caller holds s.mu
+func (s *UserTokenStore) saveLocked() {
+	b, _ := json.MarshalIndent(s.tokens, "", "  ")
+	if err := writeFileAtomic(s.path, b); err != nil {
+		log.Printf("Error writing %s: %v", s.path, err)
+	}
+}
+
+// ---------- Helix ----------
+
+// Call Helix as t's account, refreshing and retrying once if the token was
+// revoked or expired early
+func helixAs(t *UserToken, method, path string, body, out any) error {
+	err := helixRequest(method, path, t.AccessToken, body, out)
+	var herr *helixError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	t, err = userTokens.Refresh(t)
+	if err != nil {
+		return err
+	}
+	return helixRequest(method, path, t.AccessToken, body, out)
+}
+
+// ---------- Authorizing ----------
+
+// --authorize: log in a Twitch account with the device code flow and save
+// its token. Run it as the broadcaster, or as the bot for mod-only scopes
+// and whispers.
+func authorizeUser() error {
+	clientID := os.Getenv("TWITCH_CLIENT_ID")
+	if clientID == "" {
+		return fmt.Errorf("TWITCH_CLIENT_ID not set")
+	}
+
+	res, err := helixClient.PostForm("https://id.twitch.tv/oauth2/device", url.Values{
+		"client_id": {clientID},
+		"scopes":    {userTokenScopes},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var device struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&device); err != nil {
+		return err
+	}
+	if device.DeviceCode == "" {
+		return fmt.Errorf("device authorization failed: %s", res.Status)
+	}
+
+	fmt.Printf("Open %s and enter the code %s\n", device.VerificationURI, device.UserCode)
+	interval := time.Duration(max(device.Interval, 1)) * time.Second
+	deadline := time.Now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+		tok, err := postOAuthToken(url.Values{
+			"client_id":   {clientID},
+			"scopes":      {userTokenScopes},
+			"device_code": {device.DeviceCode},
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		})
+		if err != nil {
+			if strings.Contains(err.Error(), "authorization_pending") {
+				continue
+			}
+			return err
+		}
+
+		login, userID, err := validateUserToken(tok.AccessToken)
+		if err != nil {
+			return err
+		}
+		userTokens.Put(&UserToken{
+			UserID:       userID,
+			Login:        login,
+			AccessToken:  tok.AccessToken,
+			RefreshToken: tok.RefreshToken,
+			Scopes:       tok.Scope,
+			ExpiresAt:    time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second).Unix(),
+		})
+		fmt.Printf("Authorized %s, token saved to %s\n", login, userTokensFile)
+		return nil
+	}
+	return fmt.Errorf("the code expired before it was entered")
+}
+
+// POST to the OAuth token endpoint, returning Twitch's message as the error
+// on failure
+func postOAuthToken(form url.Values) (*oauthTokenResponse, error) {
+	res, err := helixClient.PostForm("https://id.twitch.tv/oauth2/token", form)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var tok oauthTokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tok); err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return nil, fmt.Errorf("%s: %s", res.Status, tok.Message)
+	}
+	return &tok, nil
+}
+
+// Account a user token belongs to
+func validateUserToken(token string) (login, userID string, err error) {
+	req, _ := http.NewRequest("GET", "https://id.twitch.tv/oauth2/validate", nil)
+	req.Header.Set("Authorization", "OAuth "+token)
+	res, err := helixClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	var v struct {
+		Login  string `json:"login"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return "", "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("validating token: %s", res.Status)
+	}
+	return v.Login, v.UserID, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ---------- Types ----------
+
+// Every problem found in commands.json, reported together so one run of
+// --check is enough to fix them all
+type ConfigError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s has %d problem(s):\n  %s", e.Path, len(e.Problems), strings.Join(e.Problems, "\n  "))
+}
+
+// One line for chat: the first problem and how many more there are
+func (e *ConfigError) Summary() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0]
+	}
+	return fmt.Sprintf("%s (and %d more, see the log)", e.Problems[0], len(e.Problems)-1)
+}
+
+// Error text that fits in a chat message
+func chatError(err error) string {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		return configErr.Summary()
+	}
+	return err.Error()
+}
+
+// ---------- Validation ----------
+
+var (
+	commandTypes = map[string]bool{"static": true, "builtin": true, "api": true, "counter": true, "http": true, "exec": true}
+	replyModes   = map[string]bool{"thread": true, "mention": true, "plain": true}
+	matchModes   = map[string]bool{"exact": true, "regex": true, "contains": true}
+	respondVias  = map[string]bool{"chat": true, "whisper": true}
+)
+
+// Decode one command, rejecting fields CommandConfig doesn't have so a
+// typo like "cooldwon" doesn't go unnoticed
+func decodeCommand(data []byte, cmd *CommandConfig) error {
+	return decodeStrict(data, cmd)
+}
+
+// Decode data into v, rejecting fields v doesn't have
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Problems with one command, prefixed by its key as written in the file
+func validateCommand(key string, cmd CommandConfig) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("command %q: ", key)+fmt.Sprintf(format, args...))
+	}
+
+	switch cmd.Type {
+	case "":
+		add(`missing "type"`)
+	case "static":
+		if len(cmd.Response) == 0 {
+			add(`static commands need a "response"`)
+		}
+	case "api":
+		if cmd.Endpoint == "" {
+			add(`api commands need an "endpoint"`)
+		} else if !apiEndpoints[cmd.Endpoint] {
+			add("unknown api endpoint %q (known: %s)", cmd.Endpoint, knownNames(apiEndpoints))
+		}
+	case "builtin":
+		if _, ok := builtinCommands[cmd.Endpoint]; !ok {
+			known := map[string]bool{}
+			for name := range builtinCommands {
+				known[name] = true
+			}
+			add("unknown builtin %q (known: %s)", cmd.Endpoint, knownNames(known))
+		}
+	case "http":
+		if cmd.URL == "" {
+			add(`http commands need a "url"`)
+		} else if !strings.HasPrefix(cmd.URL, "https://") {
+			add("url must start with https://")
+		}
+	case "exec":
+		if len(cmd.Command) == 0 || cmd.Command[0] == "" {
+			add(`exec commands need a "command" list, e.g. ["./gear.sh"]`)
+		}
+		if cmd.Timeout < 0 {
+			add("timeout can't be negative")
+		}
+	case "counter":
+	default:
+		add("unknown type %q (known: %s)", cmd.Type, knownNames(commandTypes))
+	}
+
+	if cmd.Cooldown < 0 {
+		add("cooldown can't be negative")
+	}
+	for i, r := range cmd.Response {
+		if strings.TrimSpace(r) == "" {
+			add("response %d is empty", i+1)
+		}
+	}
+	if cmd.ReplyMode != "" && !replyModes[cmd.ReplyMode] {
+		add("unknown reply_mode %q (known: %s)", cmd.ReplyMode, knownNames(replyModes))
+	}
+	if cmd.RespondVia != "" && !respondVias[cmd.RespondVia] {
+		add("unknown respond_via %q (known: %s)", cmd.RespondVia, knownNames(respondVias))
+	}
+	if cmd.Match != "" && !matchModes[cmd.Match] {
+		add("unknown match %q (known: %s)", cmd.Match, knownNames(matchModes))
+	}
+	if cmd.Pattern != "" && !isPatternMatch(cmd.Match) {
+		add(`"pattern" only applies to match "regex" or "contains"`)
+	}
+	if _, ok := permissionLevels[strings.ToLower(cmd.Permission)]; cmd.Permission != "" && !ok {
+		add("unknown permission %q (known: %s)", cmd.Permission, knownLevels())
+	}
+	if _, ok := permissionLevels[strings.ToLower(cmd.CooldownExempt)]; cmd.CooldownExempt != "" && !ok && !strings.EqualFold(cmd.CooldownExempt, "none") {
+		add("unknown cooldown_exempt %q (known: %s, none)", cmd.CooldownExempt, knownLevels())
+	}
+	return problems
+}
+
+func validateTimers(timers map[string]TimerConfig) []string {
+	var problems []string
+	for name, t := range timers {
+		if len(t.Message) == 0 {
+			problems = append(problems, fmt.Sprintf("timer %q: missing \"message\"", name))
+		}
+		if t.Interval < minTimerInterval {
+			problems = append(problems, fmt.Sprintf("timer %q: interval must be at least %d seconds", name, minTimerInterval))
+		}
+		if t.MinChatLines < 0 {
+			problems = append(problems, fmt.Sprintf("timer %q: min_chat_lines can't be negative", name))
+		}
+	}
+	return problems
+}
+
+func validateGreetings(g *GreetingConfig) []string {
+	var problems []string
+	if len(g.Message) == 0 && len(g.SubscriberMessage) == 0 {
+		problems = append(problems, fmt.Sprintf("%q: missing \"message\"", greetingsSection))
+	}
+	if g.MaxPerMinute < 0 {
+		problems = append(problems, fmt.Sprintf("%q: max_per_minute can't be negative", greetingsSection))
+	}
+	return problems
+}
+
+func knownNames(set map[string]bool) string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func knownLevels() string {
+	return "everyone, subscriber, vip, moderator, broadcaster"
+}
+
+// Point a JSON syntax error at its line and column instead of a byte offset
+func describeJSONError(data []byte, err error) string {
+	var syntax *json.SyntaxError
+	if !errors.As(err, &syntax) {
+		return err.Error()
+	}
+	before := data[:min(int(syntax.Offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Sprintf("line %d, column %d: %v", line, col, err)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---------- Config & Globals ----------
+const (
+	watchTimeFile = "watchtime.json"
+
+	watchTick         = 5 * time.Minute
+	watchActiveWindow = 15 * time.Minute // chatting this recently counts as watching
+
+	// users idle this long with less than watchPruneMinutes are dropped
+	watchPruneAfter   = 90 * 24 * time.Hour
+	watchPruneMinutes = 60
+)
+
+// Watch time per user, opened in main
+var watchTimes *UserStore[watchData]
+
+// ---------- Types ----------
+
+type watchData struct {
+	Minutes  int   `json:"minutes"`
+	LastSeen int64 `json:"lastSeen"` // unix seconds
+}
+
+// Credits watch time every watchTick to users who chatted within
+// watchActiveWindow in a channel that is live. Helix's chatter list needs a
+// moderator user token, so chat activity is the only signal.
+type WatchTimeTracker struct {
+	bot *Bot
+
+	mu        sync.Mutex
+	recent    map[string]map[string]recentChatter // channel -> ChatUser.Key
+	lastPrune time.Time
+}
+
+type recentChatter struct {
+	User ChatUser
+	At   time.Time
+}
+
+func NewWatchTimeTracker(bot *Bot) *WatchTimeTracker {
+	return &WatchTimeTracker{bot: bot, recent: make(map[string]map[string]recentChatter)}
+}
+
+// ---------- Running ----------
+
+// OnMessage handler noting who is active in each channel
+func (w *WatchTimeTracker) Seen(msg Message) {
+	u := newChatUser(msg.Nick(), msg.Tags)
+	if ignoredUsers[strings.ToLower(u.Login)] {
+		return
+	}
+	channel := msg.Channel()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.recent[channel] == nil {
+		w.recent[channel] = make(map[string]recentChatter)
+	}
+	w.recent[channel][u.Key()] = recentChatter{User: u, At: time.Now()}
+}
+
+func (w *WatchTimeTracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(watchTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.tick()
+		}
+	}
+}
+
+func (w *WatchTimeTracker) tick() {
+	now := time.Now()
+	credited := map[string]bool{}
+	var users []ChatUser
+	for _, channel := range w.bot.Channels {
+		// unlike timers, time only accrues when Helix confirms the stream is live
+		title, _, err := CachedStreamInfo(channel)
+		live := err == nil && title != "Offline"
+
+		w.mu.Lock()
+		for key, r := range w.recent[channel] {
+			if now.Sub(r.At) > watchActiveWindow {
+				delete(w.recent[channel], key)
+				continue
+			}
+			// watching two channels at once still only counts once
+			if live && !credited[key] {
+				credited[key] = true
+				users = append(users, r.User)
+			}
+		}
+		w.mu.Unlock()
+	}
+
+	minutes := int(watchTick / time.Minute)
+	watchTimes.UpdateEach(users, func(d *watchData) {
+		d.Minutes += minutes
+		d.LastSeen = now.Unix()
+	})
+	points.AddWatching(users)
+
+	if now.Sub(w.lastPrune) >= 24*time.Hour {
+		w.lastPrune = now
+		cutoff := now.Add(-watchPruneAfter).Unix()
+		if n := watchTimes.Prune(func(e UserEntry[watchData]) bool {
+			return e.Data.Minutes >= watchPruneMinutes || e.Data.LastSeen >= cutoff
+		}); n > 0 {
+			log.Printf("Pruned %d inactive users from %s", n, watchTimeFile)
+		}
+	}
+}
+
+// ---------- !watchtime ----------
+func init() {
+	registerBuiltin("watchtime", "watchtime", 5, "", func(d *Dispatcher, c *CommandContext) {
+		data, ok := watchTimes.Get(c.Sender)
+		if !ok || data.Minutes == 0 {
+			c.Reply(fmt.Sprintf("%s hasn't been watching long enough to count yet.", c.Sender.Name()))
+			return
+		}
+		c.Reply(fmt.Sprintf("%s has watched for %s", c.Sender.Name(), formatWatchTime(data.Minutes)))
+	})
+}
+
+// Minutes as "Xh Ym"
+func formatWatchTime(minutes int) string {
+	return fmt.Sprintf("%dh %dm", minutes/60, minutes%60)
+}
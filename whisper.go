@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"unicode/utf8"
+)
+
+// ---------- Config & Globals ----------
+const (
+	whisperScope      = "user:manage:whispers"
+	maxWhisperLength  = 500 // Helix allows more for known recipients, 500 is safe for all
+	whisperFailNotice = "I couldn't whisper you, check that your whispers are open."
+)
+
+// ---------- Whispers ----------
+
+// Send a command's response as a whisper from the bot's account. Twitch
+// doesn't reliably deliver IRC whispers from unverified bots, so this uses
+// Helix with a token saved by --authorize as the bot. When it fails the
+// user gets a short public notice, or with WHISPER_FALLBACK=log only a log
+// line.
+func (d *Dispatcher) whisper(msg Message, to ChatUser, text string) {
+	if d.bot.ReadOnly {
+		log.Printf("[read-only] Would whisper %s: %s", to.Login, text)
+		return
+	}
+	if err := sendWhisper(d.bot.Username, to, text); err != nil {
+		log.Printf("Whisper to %s failed: %v", to.Login, err)
+		if os.Getenv("WHISPER_FALLBACK") != "log" {
+			d.bot.sendPrivmsg(msg.Channel(), "", false, fmt.Sprintf("@%s %s", to.Name(), whisperFailNotice))
+		}
+	}
+}
+
+func sendWhisper(from string, to ChatUser, text string) error {
+	token, err := userTokens.ForAccount(from, whisperScope)
+	if err != nil {
+		return err
+	}
+	toID := to.UserID
+	if toID == "" {
+		user, err := GetTwitchUser(to.Login)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return fmt.Errorf("no Twitch user %s", to.Login)
+		}
+		toID = user.ID
+	}
+	if utf8.RuneCountInString(text) > maxWhisperLength {
+		text = string([]rune(text)[:maxWhisperLength])
+	}
+	path := "whispers?from_user_id=" + url.QueryEscape(token.UserID) + "&to_user_id=" + url.QueryEscape(toID)
+	return helixAs(token, "POST", path, map[string]string{"message": text}, nil)
+}